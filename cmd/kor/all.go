@@ -12,13 +12,12 @@ var allCmd = &cobra.Command{
 	Short: "Gets unused resources",
 	Args:  cobra.ExactArgs(0),
 	Run: func(cmd *cobra.Command, args []string) {
-		clientset := kor.GetKubeClient(kubeconfig)
+		clientset, err := kor.GetKubeClientWithOpts(kubeconfig, opts)
+		exitOnError(err)
 
-		if response, err := kor.GetUnusedAll(includeExcludeLists, filterOptions, clientset, outputFormat, opts); err != nil {
-			fmt.Println(err)
-		} else {
-			fmt.Println(response)
-		}
+		response, err := kor.GetUnusedAll(includeExcludeLists, filterOptions, clientset, outputFormat, opts)
+		exitOnError(err)
+		fmt.Println(response)
 	},
 }
 
@@ -2,6 +2,7 @@ package kor
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/yonahd/kor/pkg/kor"
@@ -13,15 +14,62 @@ var configmapCmd = &cobra.Command{
 	Short:   "Gets unused configmaps",
 	Args:    cobra.ExactArgs(0),
 	Run: func(cmd *cobra.Command, args []string) {
-		clientset := kor.GetKubeClient(kubeconfig)
-		if response, err := kor.GetUnusedConfigmaps(includeExcludeLists, filterOptions, clientset, outputFormat, opts); err != nil {
-			fmt.Println(err)
-		} else {
-			fmt.Println(response)
+		clientset, err := kor.GetKubeClientWithOpts(kubeconfig, opts)
+		exitOnError(err)
+		if opts.ScanKEDA || opts.ScanGatewayAPI {
+			opts.DynamicClient, err = kor.GetDynamicClientWithOpts(kubeconfig, opts)
+			exitOnError(err)
 		}
+		opts.MetadataClient, err = kor.GetMetadataClientWithOpts(kubeconfig, opts)
+		exitOnError(err)
+		response, err := kor.GetUnusedConfigmaps(includeExcludeLists, filterOptions, clientset, outputFormat, opts)
+		exitOnError(err)
+		fmt.Println(response)
+	},
+}
+
+var configmapMarkCmd = &cobra.Command{
+	Use:   "mark",
+	Short: "Labels unused configmaps as marked for deletion by sweep",
+	Args:  cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		clientset, err := kor.GetKubeClientWithOpts(kubeconfig, opts)
+		exitOnError(err)
+		if opts.ScanKEDA || opts.ScanGatewayAPI {
+			opts.DynamicClient, err = kor.GetDynamicClientWithOpts(kubeconfig, opts)
+			exitOnError(err)
+		}
+		marked, err := kor.MarkUnusedConfigmaps(includeExcludeLists, filterOptions, clientset, opts)
+		for _, configmap := range marked {
+			fmt.Printf("Marked configmap %s\n", configmap)
+		}
+		exitOnError(err)
+	},
+}
+
+var sweepGrace time.Duration
+
+var configmapSweepCmd = &cobra.Command{
+	Use:   "sweep",
+	Short: "Deletes the configmaps marked by mark for longer than the grace period that are still unused",
+	Args:  cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		clientset, err := kor.GetKubeClientWithOpts(kubeconfig, opts)
+		exitOnError(err)
+		if opts.ScanKEDA || opts.ScanGatewayAPI {
+			opts.DynamicClient, err = kor.GetDynamicClientWithOpts(kubeconfig, opts)
+			exitOnError(err)
+		}
+		deleted, err := kor.SweepMarkedConfigmaps(includeExcludeLists, filterOptions, clientset, sweepGrace, opts)
+		for _, configmap := range deleted {
+			fmt.Printf("Deleted configmap %s\n", configmap)
+		}
+		exitOnError(err)
 	},
 }
 
 func init() {
+	configmapSweepCmd.Flags().DurationVar(&sweepGrace, "grace", 7*24*time.Hour, "Minimum time a configmap stays marked before it is deleted")
+	configmapCmd.AddCommand(configmapMarkCmd, configmapSweepCmd)
 	rootCmd.AddCommand(configmapCmd)
 }
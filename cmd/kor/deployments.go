@@ -13,12 +13,11 @@ var deployCmd = &cobra.Command{
 	Short:   "Gets unused deployments",
 	Args:    cobra.ExactArgs(0),
 	Run: func(cmd *cobra.Command, args []string) {
-		clientset := kor.GetKubeClient(kubeconfig)
-		if response, err := kor.GetUnusedDeployments(includeExcludeLists, filterOptions, clientset, outputFormat, opts); err != nil {
-			fmt.Println(err)
-		} else {
-			fmt.Println(response)
-		}
+		clientset, err := kor.GetKubeClientWithOpts(kubeconfig, opts)
+		exitOnError(err)
+		response, err := kor.GetUnusedDeployments(includeExcludeLists, filterOptions, clientset, outputFormat, opts)
+		exitOnError(err)
+		fmt.Println(response)
 	},
 }
 
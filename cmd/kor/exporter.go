@@ -10,9 +10,9 @@ var exporterCmd = &cobra.Command{
 	Short: "start prometheus exporter",
 	Args:  cobra.ExactArgs(0),
 	Run: func(cmd *cobra.Command, args []string) {
-		clientset := kor.GetKubeClient(kubeconfig)
-		kor.Exporter(includeExcludeLists, filterOptions, clientset, "json", opts)
-
+		clientset, err := kor.GetKubeClientWithOpts(kubeconfig, opts)
+		exitOnError(err)
+		exitOnError(kor.Exporter(includeExcludeLists, filterOptions, clientset, "json", opts))
 	},
 }
 
@@ -13,13 +13,12 @@ var hpaCmd = &cobra.Command{
 	Short:   "Gets unused hpas",
 	Args:    cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		clientset := kor.GetKubeClient(kubeconfig)
+		clientset, err := kor.GetKubeClientWithOpts(kubeconfig, opts)
+		exitOnError(err)
 
-		if response, err := kor.GetUnusedHpas(includeExcludeLists, filterOptions, clientset, outputFormat, opts); err != nil {
-			fmt.Println(err)
-		} else {
-			fmt.Println(response)
-		}
+		response, err := kor.GetUnusedHpas(includeExcludeLists, filterOptions, clientset, outputFormat, opts)
+		exitOnError(err)
+		fmt.Println(response)
 
 	},
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/yonahd/kor/pkg/kor"
@@ -16,22 +17,52 @@ var rootCmd = &cobra.Command{
 	Long: `kor is a CLI to to discover unused Kubernetes resources
 	kor can currently discover unused configmaps and secrets`,
 	Args: cobra.MinimumNArgs(1),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if namespacesFile != "" {
+			lists, err := kor.LoadNamespaceListsFile(namespacesFile, includeExcludeLists)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error while loading namespaces file '%s'", err)
+				os.Exit(1)
+			}
+			includeExcludeLists = lists
+		}
+		if err := includeExcludeLists.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error while validating namespace options '%s'", err)
+			os.Exit(1)
+		}
+		for _, value := range outputTargets {
+			target, err := kor.ParseOutputTarget(value)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error while parsing output target '%s'", err)
+				os.Exit(1)
+			}
+			opts.OutputTargets = append(opts.OutputTargets, target)
+		}
+		if err := opts.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error while validating options '%s'", err)
+			os.Exit(1)
+		}
+		if includeClusterInfo {
+			config, err := kor.GetKubeConfig(kubeconfig)
+			exitOnError(err)
+			opts.ClusterInfo = kor.NewClusterInfo(config)
+		}
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		resourceNames := args[0]
 
 		// Cheks whether the string contains a comma, indicating that it represents a list of resources
 		if strings.ContainsRune(resourceNames, 44) {
 			if outputFormat == "json" || outputFormat == "yaml" {
-				if response, err := kor.GetUnusedMultiStructured(includeExcludeLists, kubeconfig, outputFormat, resourceNames); err != nil {
-					fmt.Println(err)
-				} else {
-					fmt.Println(response)
-				}
+				response, err := kor.GetUnusedMultiStructured(includeExcludeLists, kubeconfig, outputFormat, resourceNames, opts)
+				exitOnError(err)
+				fmt.Println(response)
 			} else {
-				kor.GetUnusedMulti(includeExcludeLists, kubeconfig, resourceNames, opts)
+				exitOnError(kor.GetUnusedMulti(includeExcludeLists, kubeconfig, resourceNames, opts))
 			}
 		} else {
-			fmt.Printf("Subcommand %q was not found, try using 'kor --help' for available subcommands", args[0])
+			fmt.Fprintf(os.Stderr, "Subcommand %q was not found, try using 'kor --help' for available subcommands\n", args[0])
+			os.Exit(1)
 		}
 	},
 }
@@ -42,18 +73,97 @@ var (
 	includeExcludeLists kor.IncludeExcludeLists
 	opts                kor.Opts
 	filterOptions       = kor.NewFilterOptions()
+	includeClusterInfo  bool
+	namespacesFile      string
+	outputTargets       []string
 )
 
+// exitOnError prints err to stderr and exits with a non-zero status when err is set
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
 func Execute() {
 	utils.PrintLogo()
 	rootCmd.PersistentFlags().StringVarP(&kubeconfig, "kubeconfig", "k", "", "Path to kubeconfig file (optional)")
 	rootCmd.PersistentFlags().StringVarP(&includeExcludeLists.IncludeListStr, "include-namespaces", "n", "", "Namespaces to run on, splited by comma. Example: --include-namespace ns1,ns2,ns3. ")
 	rootCmd.PersistentFlags().StringVarP(&includeExcludeLists.ExcludeListStr, "exclude-namespaces", "e", "", "Namespaces to be excluded, splited by comma. Example: --exclude-namespace ns1,ns2,ns3. If --include-namespace is set, --exclude-namespaces will be ignored.")
-	rootCmd.PersistentFlags().StringVar(&outputFormat, "output", "table", "Output format (table, json or yaml)")
+	rootCmd.PersistentFlags().StringVar(&namespacesFile, "namespaces-file", "", "File with namespaces to include and exclude, one per line under an [include] or [exclude] section header. Added to --include-namespaces and --exclude-namespaces")
+	rootCmd.PersistentFlags().StringVar(&includeExcludeLists.NamespaceExcludeRegex, "exclude-namespaces-regex", "", "Regular expression matching whole namespace names to be excluded. Example: --exclude-namespaces-regex 'pr-.*'. If --include-namespace is set, --exclude-namespaces-regex will be ignored.")
+	rootCmd.PersistentFlags().StringVar(&opts.OptInLabel, "opt-in-label", "", "Only scan the namespaces labeled with this key=value label, including namespaces listed in --include-namespaces. Example: --opt-in-label kor/scan=true")
+	rootCmd.PersistentFlags().IntVar(&opts.Shard.Index, "shard-index", 0, "Index of the shard of namespaces to scan, from 0 to --shard-total minus one")
+	rootCmd.PersistentFlags().IntVar(&opts.Shard.Total, "shard-total", 0, "Number of shards namespaces are split into by a hash of their name, so several runs cover the cluster without overlap. 0 disables sharding")
+	rootCmd.PersistentFlags().StringArrayVar(&outputTargets, "output-target", nil, "Additional output of the configmap command as format=path, rendered from the same scan. Can be repeated. Example: --output-target json=report.json")
+	rootCmd.PersistentFlags().StringVar(&outputFormat, "output", "table", "Output format (table, json or yaml). The configmap command also supports custom-resource, rendering an OrphanReport custom resource, tree, rendering an indented tree of namespaces, kinds and configmaps, and remote-write, rendering the unused counts as timestamped samples for Prometheus remote-write")
+	rootCmd.PersistentFlags().StringVar(&opts.SinceResourceVersion, "since-resource-version", "", "Only scan namespaces with configmap or pod changes since the resource version reported by a previous run. Use 0 to scan every namespace and report the resource version")
+	rootCmd.PersistentFlags().StringSliceVar(&opts.ReferenceAnnotationKeys, "reference-annotation-keys", nil, "Pod and configmap annotation keys whose values name configmaps in use, splited by comma. Example: --reference-annotation-keys example.com/configmaps")
+	rootCmd.PersistentFlags().BoolVar(&opts.ReportStaleExceptions, "report-stale-exceptions", false, "Report the configmap exceptions that matched no configmap in the scanned namespaces")
+	rootCmd.PersistentFlags().BoolVar(&opts.ReportProtected, "report-protected", false, "Report the configmaps kept from being reported as unused and whether a built-in exception, custom exception, glob, label or annotation protects them")
+	rootCmd.PersistentFlags().StringVar(&opts.PrometheusTextfile, "prometheus-textfile", "", "Path to write the number of unused resources per namespace and kind to in the Prometheus text exposition format, for the node-exporter textfile collector")
+	rootCmd.PersistentFlags().BoolVar(&opts.QuietErrors, "quiet-errors", false, "Don't print the namespaces that failed to scan and other scan warnings to stderr")
+	rootCmd.PersistentFlags().StringVar(&opts.StateFile, "state-file", "", "Path to a file recording configmap references between runs. When set, only configmaps that were referenced by a previous run and no longer are get reported as unused")
+	rootCmd.PersistentFlags().StringVar(&opts.DisplayName, "display-name", "", "Resource kind name shown in table output headers")
+	rootCmd.PersistentFlags().StringVar(&opts.HeaderTemplate, "header-template", "", "Go template for the per-namespace table output header, rendered with .Kind, .Namespace and .Count. Example: --header-template '{{.Count}} unused {{.Kind}} in {{.Namespace}}'")
+	rootCmd.PersistentFlags().StringVar(&opts.ReportWebhookURL, "report-webhook-url", "", "URL to POST the json report of the configmap scan to")
+	rootCmd.PersistentFlags().StringToStringVar(&opts.ReportWebhookHeaders, "report-webhook-headers", nil, "Headers added to the report webhook request. Example: --report-webhook-headers Authorization='Bearer token'")
+	rootCmd.PersistentFlags().DurationVar(&opts.ReportWebhookTimeout, "report-webhook-timeout", 10*time.Second, "Timeout of the report webhook request")
+	rootCmd.PersistentFlags().BoolVar(&opts.ReportWebhookRequired, "report-webhook-required", false, "Fail the scan when the report can't be posted to --report-webhook-url instead of printing a warning")
 	rootCmd.PersistentFlags().StringVar(&opts.WebhookURL, "slack-webhook-url", "", "Slack webhook URL to send notifications to")
 	rootCmd.PersistentFlags().StringVar(&opts.Channel, "slack-channel", "", "Slack channel to send notifications to. --slack-channel requires --slack-auth-token to be set.")
 	rootCmd.PersistentFlags().StringVar(&opts.Token, "slack-auth-token", "", "Slack auth token to send notifications to. --slack-auth-token requires --slack-channel to be set.")
 	rootCmd.PersistentFlags().BoolVar(&opts.DeleteFlag, "delete", false, "Delete unused resources")
+	rootCmd.PersistentFlags().BoolVar(&opts.Canonical, "canonical", false, "Sort namespaces and configmap names so identical cluster state produces byte-identical output, e.g. for reports committed to git")
+	rootCmd.PersistentFlags().BoolVar(&opts.ClusterWideList, "cluster-wide-list", false, "List configmaps and pods once across all namespaces instead of once per namespace. Faster on clusters with many namespaces")
+	rootCmd.PersistentFlags().BoolVar(&opts.OmitEmptyNamespaces, "omit-empty-namespaces", false, "Leave namespaces without unused configmaps out of the output and report scan totals instead")
+	rootCmd.PersistentFlags().BoolVar(&opts.CategorizeEmpty, "categorize-empty", false, "Split the configmaps of each namespace in json and yaml output into unused-nonempty, unused-empty and empty-but-used categories, to review the unused configmaps holding data first")
+	rootCmd.PersistentFlags().StringVar(&opts.OwnerLabelKey, "owner-label-key", "", "Label holding the owner of a configmap, to add the owner of each unused configmap to json and yaml output and summarize the unused configmaps per owner. Example: --owner-label-key app.kubernetes.io/part-of")
+	rootCmd.PersistentFlags().BoolVar(&opts.IncludeUsed, "include-used", false, "Also output the configmaps found in use, to help debugging false positives")
+	rootCmd.PersistentFlags().BoolVar(&opts.IncludeResourcePaths, "include-resource-paths", false, "Report each unused configmap in json and yaml output as an object including its API path")
+	rootCmd.PersistentFlags().Int64Var(&opts.ListPageSize, "list-page-size", 500, "Number of pods or configmaps requested per list call. Smaller pages use less memory but take more round-trips to the API server")
+	rootCmd.PersistentFlags().BoolVar(&opts.AllowStaleReads, "allow-stale-reads", false, "List configmaps and pods from the API server cache instead of etcd. Reduces load on large clusters, but changes made just before the scan may be missed")
+	rootCmd.PersistentFlags().BoolVar(&opts.CheckDanglingKeys, "check-dangling-keys", false, "Warn about configmap keys referenced by pod volumes or environment variables that are missing from the configmap")
+	rootCmd.PersistentFlags().BoolVar(&opts.ScanWorkloadAnnotations, "scan-workload-annotations", false, "Also look up --reference-annotation-keys in the annotations of deployments, daemonsets and statefulsets")
+	rootCmd.PersistentFlags().BoolVar(&opts.ScanGatewayAPI, "scan-gateway-api", false, "Consider configmaps used when referenced by the backendRefs or extensionRefs of a Gateway API HTTPRoute, or the parametersRef of a Gateway or GatewayClass. Skipped if the Gateway API isn't installed")
+	rootCmd.PersistentFlags().BoolVar(&opts.ScanWebhookCA, "scan-webhook-ca", false, "Consider configmaps used when named by the kor/ca-configmap: <namespace>/<name> annotation of a validating or mutating webhook configuration")
+	rootCmd.PersistentFlags().BoolVar(&opts.ScanKEDA, "scan-keda", false, "Consider configmaps used when referenced by the configMapTargetRef of a KEDA TriggerAuthentication or ClusterTriggerAuthentication. Skipped if KEDA isn't installed")
+	rootCmd.PersistentFlags().BoolVar(&opts.ScanEnvValues, "scan-env-values", false, "Consider configmaps used when their exact name is set as a container environment variable value")
+	rootCmd.PersistentFlags().BoolVar(&opts.ScanJobTemplates, "scan-job-templates", false, "Consider configmaps used when referenced by the pod template of an existing job or cronjob, even if none of its pods exist")
+	rootCmd.PersistentFlags().BoolVar(&opts.IgnoreCompletedJobPods, "ignore-completed-job-pods", false, "Ignore configmap references from pods owned by jobs that are complete or failed")
+	rootCmd.PersistentFlags().BoolVar(&opts.IgnoreTerminatingPods, "ignore-terminating-pods", false, "Ignore configmap references from pods that are terminating, failed (including evicted) or succeeded")
+	rootCmd.PersistentFlags().BoolVar(&opts.IncludeResourceIdentity, "include-resource-identity", false, "Add the UID and resource version of each unused configmap to json and yaml output, to delete them with preconditions")
+	rootCmd.PersistentFlags().BoolVar(&opts.IncludeScanMetadata, "include-scan-metadata", false, "Add the scan start time, duration, kor version and options that shape the scan to json and yaml output. Credentials are never included")
+	rootCmd.PersistentFlags().BoolVar(&includeClusterInfo, "include-cluster-info", false, "Wrap json and yaml output in an envelope identifying the cluster the report was generated against")
+	rootCmd.PersistentFlags().BoolVar(&opts.FlatJSON, "flat-json", false, "Output json and yaml findings as a single list of namespace, kind and name objects instead of a map per namespace and kind")
+	rootCmd.PersistentFlags().IntVar(&opts.Concurrency, "concurrency", 1, "Number of namespaces to scan for unused configmaps in parallel")
+	rootCmd.PersistentFlags().BoolVar(&opts.AutoConcurrency, "auto-concurrency", false, "Derive the number of namespaces scanned in parallel from --qps and the latency of the first namespace scan, up to --max-concurrency. Overrides --concurrency")
+	rootCmd.PersistentFlags().IntVar(&opts.MaxConcurrency, "max-concurrency", 10, "Maximum number of namespaces scanned in parallel with --auto-concurrency")
+	rootCmd.PersistentFlags().BoolVar(&opts.ShowAge, "show-age", false, "Add the age of each unused configmap to the table output")
+	rootCmd.PersistentFlags().StringVar(&opts.TimeFormat, "time-format", "relative", "Go time layout the age of unused configmaps is rendered with by --show-age, or relative. Example: --time-format 2006-01-02")
+	rootCmd.PersistentFlags().StringVar(&opts.UserAgent, "user-agent", "", "User-Agent sent with all API requests, to identify kor in audit logs. Defaults to kor/<version>")
+	rootCmd.PersistentFlags().StringVar(&opts.ImpersonateUser, "as", "", "Username to impersonate for all API requests")
+	rootCmd.PersistentFlags().StringSliceVar(&opts.ImpersonateGroups, "as-group", nil, "Group to impersonate for all API requests, can be repeated to specify multiple groups")
+	rootCmd.PersistentFlags().Float32Var(&opts.QPS, "qps", 0, "Maximum number of requests per second sent to the Kubernetes API. 0 uses the client default")
+	rootCmd.PersistentFlags().IntVar(&opts.Burst, "burst", 0, "Maximum number of requests sent to the Kubernetes API in a burst above --qps. 0 uses the client default, or --qps when higher")
+	rootCmd.PersistentFlags().StringVar(&opts.MinDeleteConfidence, "min-delete-confidence", "high", "Lowest confidence of a reference that keeps a configmap from being deleted: low or high. With low, configmaps matched by env var value or annotation heuristics are kept")
+	rootCmd.PersistentFlags().StringVar(&opts.DeleteSelector, "delete-selector", "", "Label selector limiting --delete to the unused configmaps it matches, the others are only reported. Example: --delete-selector env=ephemeral")
+	rootCmd.PersistentFlags().DurationVar(&opts.PerNamespaceTimeout, "per-namespace-timeout", 0, "Maximum time spent scanning a single namespace, namespaces that time out are reported as failed. 0 means no timeout")
+	rootCmd.PersistentFlags().StringVar(&opts.PropagationPolicy, "propagation-policy", "", "Deletion propagation policy of deleted resources: Foreground, Background or Orphan. Defaults to the policy of each resource")
+	rootCmd.PersistentFlags().BoolVar(&opts.ExplainNamespaces, "explain-namespaces", false, "Print whether each namespace was selected for scanning and why to stderr: include-list, exclude-list, exclude-regex, label, shard, system-default or terminating")
+	rootCmd.PersistentFlags().StringVar(&opts.BackupDir, "backup-dir", "", "Directory the full yaml of each configmap is written to as <namespace>/<name>.yaml before deleting it")
+	rootCmd.PersistentFlags().BoolVar(&opts.RequireBackup, "require-backup", false, "Leave configmaps whose backup to --backup-dir failed in place instead of deleting them anyway")
+	rootCmd.PersistentFlags().BoolVar(&opts.ForceRemoveFinalizers, "force-remove-finalizers", false, "Remove the finalizers of unused configmaps once their deletion is accepted. Without it configmaps with finalizers are reported as undeletable and left in place")
+	rootCmd.PersistentFlags().BoolVar(&opts.GitHubAnnotations, "github-annotations", false, "Output a GitHub Actions warning annotation for each unused configmap instead of the findings, so they surface in workflow checks")
+	rootCmd.PersistentFlags().BoolVar(&opts.EmitDeleteCommands, "emit-delete-commands", false, "Output a kubectl delete command for each unused configmap instead of the findings, to review them before deleting. Nothing is deleted, even with --delete")
+	rootCmd.PersistentFlags().IntVar(&opts.DeleteConcurrency, "delete-concurrency", 1, "Number of resources deleted in parallel with --no-interactive or --confirm-each-namespace")
+	rootCmd.PersistentFlags().DurationVar(&opts.DeletedWorkloadsWindow, "deleted-workloads-window", 0, "Only report unused configmaps referenced by the pod template of a workload whose deletion was reported by a Deleted event within this window. Requires --state-file, which records the configmaps of each workload. Example: --deleted-workloads-window 24h")
+	rootCmd.PersistentFlags().StringVar(&opts.DeletedListFile, "deleted-list-file", "", "Path to a file replaced after each run with the configmaps deleted by the run, one namespace/name per line")
+	rootCmd.PersistentFlags().IntVar(&opts.MaxDeletions, "max-deletions", 0, "Maximum number of resources to delete per run, remaining unused resources are reported as skipped. 0 means no limit")
+	rootCmd.PersistentFlags().BoolVar(&opts.ConfirmEachNamespace, "confirm-each-namespace", false, "List the unused resources of each namespace and prompt once for confirmation before deleting them")
+	rootCmd.PersistentFlags().BoolVar(&opts.ReportEmptiedNamespaces, "report-emptied-namespaces", false, "With --delete, report the namespaces left without user resources after deleting their unused configmaps")
+	rootCmd.PersistentFlags().BoolVar(&opts.DeleteEmptiedNamespaces, "delete-emptied-namespaces", false, "With --delete, also delete the namespaces left without user resources after deleting their unused configmaps")
 	rootCmd.PersistentFlags().BoolVar(&opts.NoInteractive, "no-interactive", false, "Do not prompt for confirmation when deleting resources. Be careful using this flag!")
 	addFilterOptionsFlag(rootCmd, filterOptions)
 
@@ -69,6 +179,10 @@ func Execute() {
 
 func addFilterOptionsFlag(cmd *cobra.Command, opts *kor.FilterOptions) {
 	cmd.PersistentFlags().StringVarP(&opts.ExcludeLabels, "exclude-labels", "l", opts.ExcludeLabels, "Selector to filter out, Example: --exclude-labels key1=value1,key2=value2.")
-	cmd.PersistentFlags().StringVar(&opts.NewerThan, "newer-than", opts.NewerThan, "The maximum age of the resources to be considered unused. This flag cannot be used together with older-than flag. Example: --newer-than=1h2m")
-	cmd.PersistentFlags().StringVar(&opts.OlderThan, "older-than", opts.OlderThan, "The minimum age of the resources to be considered unused. This flag cannot be used together with newer-than flag. Example: --older-than=1h2m")
+	cmd.PersistentFlags().StringVar(&opts.ExcludeAnnotations, "exclude-annotations", opts.ExcludeAnnotations, "Annotation selector to filter out configmaps, with the equality and existence operators of label selectors. Example: --exclude-annotations lifecycle/keep or --exclude-annotations key1=value1")
+	cmd.PersistentFlags().StringVar(&opts.NewerThan, "newer-than", opts.NewerThan, "The maximum age of the resources to be considered unused. This flag cannot be used together with older-than flag. Accepts Go durations, days and ISO8601 durations. Example: --newer-than=1h2m, --newer-than=30d or --newer-than=P30D")
+	cmd.PersistentFlags().StringVar(&opts.OlderThan, "older-than", opts.OlderThan, "The minimum age of the resources to be considered unused. This flag cannot be used together with newer-than flag. Accepts Go durations, days and ISO8601 durations. Example: --older-than=1h2m, --older-than=30d or --older-than=P30D")
+	cmd.PersistentFlags().IntVar(&opts.MinDataBytes, "min-data-bytes", opts.MinDataBytes, "The size in bytes a configmap's data must exceed for it to be considered unused. Example: --min-data-bytes=1024")
+	cmd.PersistentFlags().StringVar(&opts.HasDataKey, "has-data-key", opts.HasDataKey, "Only consider configmaps containing this data key as unused. Example: --has-data-key=tls.crt")
+	cmd.PersistentFlags().StringSliceVar(&opts.ProtectedDataKeys, "protected-data-keys", opts.ProtectedDataKeys, "Glob patterns of data keys marking a configmap containing a matching key as used, splited by comma. Example: --protected-data-keys 'ca.crt,*.pem'")
 }
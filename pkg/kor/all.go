@@ -2,9 +2,6 @@ package kor
 
 import (
 	"bytes"
-	"encoding/json"
-	"fmt"
-	"os"
 
 	"k8s.io/client-go/kubernetes"
 )
@@ -19,100 +16,100 @@ type ResourceDiff struct {
 	diff         []string
 }
 
-func getUnusedCMs(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions) ResourceDiff {
+func getUnusedCMs(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions, opts Opts) ResourceDiff {
 	cmDiff, err := processNamespaceCM(clientset, namespace, filterOpts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get %s namespace %s: %v\n", "configmaps", namespace, err)
+		opts.printError("Failed to get %s namespace %s: %v\n", "configmaps", namespace, err)
 	}
 	namespaceCMDiff := ResourceDiff{"ConfigMap", cmDiff}
 	return namespaceCMDiff
 }
 
-func getUnusedSVCs(clientset kubernetes.Interface, namespace string) ResourceDiff {
+func getUnusedSVCs(clientset kubernetes.Interface, namespace string, opts Opts) ResourceDiff {
 	svcDiff, err := ProcessNamespaceServices(clientset, namespace)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get %s namespace %s: %v\n", "services", namespace, err)
+		opts.printError("Failed to get %s namespace %s: %v\n", "services", namespace, err)
 	}
 	namespaceSVCDiff := ResourceDiff{"Service", svcDiff}
 	return namespaceSVCDiff
 }
 
-func getUnusedSecrets(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions) ResourceDiff {
+func getUnusedSecrets(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions, opts Opts) ResourceDiff {
 	secretDiff, err := processNamespaceSecret(clientset, namespace, filterOpts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get %s namespace %s: %v\n", "secrets", namespace, err)
+		opts.printError("Failed to get %s namespace %s: %v\n", "secrets", namespace, err)
 	}
 	namespaceSecretDiff := ResourceDiff{"Secret", secretDiff}
 	return namespaceSecretDiff
 }
 
-func getUnusedServiceAccounts(clientset kubernetes.Interface, namespace string) ResourceDiff {
+func getUnusedServiceAccounts(clientset kubernetes.Interface, namespace string, opts Opts) ResourceDiff {
 	saDiff, err := processNamespaceSA(clientset, namespace)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get %s namespace %s: %v\n", "serviceaccounts", namespace, err)
+		opts.printError("Failed to get %s namespace %s: %v\n", "serviceaccounts", namespace, err)
 	}
 	namespaceSADiff := ResourceDiff{"ServiceAccount", saDiff}
 	return namespaceSADiff
 }
 
-func getUnusedDeployments(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions) ResourceDiff {
+func getUnusedDeployments(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions, opts Opts) ResourceDiff {
 	deployDiff, err := ProcessNamespaceDeployments(clientset, namespace, filterOpts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get %s namespace %s: %v\n", "deployments", namespace, err)
+		opts.printError("Failed to get %s namespace %s: %v\n", "deployments", namespace, err)
 	}
 	namespaceSADiff := ResourceDiff{"Deployment", deployDiff}
 	return namespaceSADiff
 }
 
-func getUnusedStatefulSets(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions) ResourceDiff {
+func getUnusedStatefulSets(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions, opts Opts) ResourceDiff {
 	stsDiff, err := ProcessNamespaceStatefulSets(clientset, namespace, filterOpts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get %s namespace %s: %v\n", "statefulSets", namespace, err)
+		opts.printError("Failed to get %s namespace %s: %v\n", "statefulSets", namespace, err)
 	}
 	namespaceSADiff := ResourceDiff{"StatefulSet", stsDiff}
 	return namespaceSADiff
 }
 
-func getUnusedRoles(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions) ResourceDiff {
+func getUnusedRoles(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions, opts Opts) ResourceDiff {
 	roleDiff, err := processNamespaceRoles(clientset, namespace, filterOpts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get %s namespace %s: %v\n", "roles", namespace, err)
+		opts.printError("Failed to get %s namespace %s: %v\n", "roles", namespace, err)
 	}
 	namespaceSADiff := ResourceDiff{"Role", roleDiff}
 	return namespaceSADiff
 }
 
-func getUnusedHpas(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions) ResourceDiff {
+func getUnusedHpas(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions, opts Opts) ResourceDiff {
 	hpaDiff, err := processNamespaceHpas(clientset, namespace, filterOpts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get %s namespace %s: %v\n", "hpas", namespace, err)
+		opts.printError("Failed to get %s namespace %s: %v\n", "hpas", namespace, err)
 	}
 	namespaceHpaDiff := ResourceDiff{"Hpa", hpaDiff}
 	return namespaceHpaDiff
 }
 
-func getUnusedPvcs(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions) ResourceDiff {
+func getUnusedPvcs(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions, opts Opts) ResourceDiff {
 	pvcDiff, err := processNamespacePvcs(clientset, namespace, filterOpts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get %s namespace %s: %v\n", "pvcs", namespace, err)
+		opts.printError("Failed to get %s namespace %s: %v\n", "pvcs", namespace, err)
 	}
 	namespacePvcDiff := ResourceDiff{"Pvc", pvcDiff}
 	return namespacePvcDiff
 }
 
-func getUnusedIngresses(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions) ResourceDiff {
+func getUnusedIngresses(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions, opts Opts) ResourceDiff {
 	ingressDiff, err := processNamespaceIngresses(clientset, namespace, filterOpts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get %s namespace %s: %v\n", "ingresses", namespace, err)
+		opts.printError("Failed to get %s namespace %s: %v\n", "ingresses", namespace, err)
 	}
 	namespaceIngressDiff := ResourceDiff{"Ingress", ingressDiff}
 	return namespaceIngressDiff
 }
 
-func getUnusedPdbs(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions) ResourceDiff {
+func getUnusedPdbs(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions, opts Opts) ResourceDiff {
 	pdbDiff, err := processNamespacePdbs(clientset, namespace, filterOpts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get %s namespace %s: %v\n", "pdbs", namespace, err)
+		opts.printError("Failed to get %s namespace %s: %v\n", "pdbs", namespace, err)
 	}
 	namespacePdbDiff := ResourceDiff{"Pdb", pdbDiff}
 	return namespacePdbDiff
@@ -121,32 +118,35 @@ func getUnusedPdbs(clientset kubernetes.Interface, namespace string, filterOpts
 func GetUnusedAll(includeExcludeLists IncludeExcludeLists, filterOpts *FilterOptions, clientset kubernetes.Interface, outputFormat string, opts Opts) (string, error) {
 	var outputBuffer bytes.Buffer
 
-	namespaces := SetNamespaceList(includeExcludeLists, clientset)
+	namespaces, err := SetNamespaceList(includeExcludeLists, clientset, opts)
+	if err != nil {
+		return "", err
+	}
 	response := make(map[string]map[string][]string)
 
 	for _, namespace := range namespaces {
 		var allDiffs []ResourceDiff
-		namespaceCMDiff := getUnusedCMs(clientset, namespace, filterOpts)
+		namespaceCMDiff := getUnusedCMs(clientset, namespace, filterOpts, opts)
 		allDiffs = append(allDiffs, namespaceCMDiff)
-		namespaceSVCDiff := getUnusedSVCs(clientset, namespace)
+		namespaceSVCDiff := getUnusedSVCs(clientset, namespace, opts)
 		allDiffs = append(allDiffs, namespaceSVCDiff)
-		namespaceSecretDiff := getUnusedSecrets(clientset, namespace, filterOpts)
+		namespaceSecretDiff := getUnusedSecrets(clientset, namespace, filterOpts, opts)
 		allDiffs = append(allDiffs, namespaceSecretDiff)
-		namespaceSADiff := getUnusedServiceAccounts(clientset, namespace)
+		namespaceSADiff := getUnusedServiceAccounts(clientset, namespace, opts)
 		allDiffs = append(allDiffs, namespaceSADiff)
-		namespaceDeploymentDiff := getUnusedDeployments(clientset, namespace, filterOpts)
+		namespaceDeploymentDiff := getUnusedDeployments(clientset, namespace, filterOpts, opts)
 		allDiffs = append(allDiffs, namespaceDeploymentDiff)
-		namespaceStatefulsetDiff := getUnusedStatefulSets(clientset, namespace, filterOpts)
+		namespaceStatefulsetDiff := getUnusedStatefulSets(clientset, namespace, filterOpts, opts)
 		allDiffs = append(allDiffs, namespaceStatefulsetDiff)
-		namespaceRoleDiff := getUnusedRoles(clientset, namespace, filterOpts)
+		namespaceRoleDiff := getUnusedRoles(clientset, namespace, filterOpts, opts)
 		allDiffs = append(allDiffs, namespaceRoleDiff)
-		namespaceHpaDiff := getUnusedHpas(clientset, namespace, filterOpts)
+		namespaceHpaDiff := getUnusedHpas(clientset, namespace, filterOpts, opts)
 		allDiffs = append(allDiffs, namespaceHpaDiff)
-		namespacePvcDiff := getUnusedPvcs(clientset, namespace, filterOpts)
+		namespacePvcDiff := getUnusedPvcs(clientset, namespace, filterOpts, opts)
 		allDiffs = append(allDiffs, namespacePvcDiff)
-		namespaceIngressDiff := getUnusedIngresses(clientset, namespace, filterOpts)
+		namespaceIngressDiff := getUnusedIngresses(clientset, namespace, filterOpts, opts)
 		allDiffs = append(allDiffs, namespaceIngressDiff)
-		namespacePdbDiff := getUnusedPdbs(clientset, namespace, filterOpts)
+		namespacePdbDiff := getUnusedPdbs(clientset, namespace, filterOpts, opts)
 		allDiffs = append(allDiffs, namespacePdbDiff)
 
 		output := FormatOutputAll(namespace, allDiffs)
@@ -161,15 +161,10 @@ func GetUnusedAll(includeExcludeLists IncludeExcludeLists, filterOpts *FilterOpt
 		response[namespace] = resourceMap
 	}
 
-	jsonResponse, err := json.MarshalIndent(response, "", "  ")
+	jsonResponse, err := marshalResponse(response, opts)
 	if err != nil {
 		return "", err
 	}
 
-	unusedAll, err := unusedResourceFormatter(outputFormat, outputBuffer, opts, jsonResponse)
-	if err != nil {
-		fmt.Printf("err: %v\n", err)
-	}
-
-	return unusedAll, nil
+	return unusedResourceFormatter(outputFormat, outputBuffer, opts, jsonResponse)
 }
@@ -0,0 +1,44 @@
+package kor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// backupConfigMap gets the full ConfigMap and writes it as yaml to <backupDir>/<namespace>/<name>.yaml, replacing
+// an earlier backup of the same ConfigMap. The metadata set by the API server is left out so the backup can be
+// applied again, and the files are only readable by the current user as ConfigMaps may hold sensitive settings.
+func backupConfigMap(clientset kubernetes.Interface, backupDir, namespace, name string) error {
+	configMap, err := clientset.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get configmap %s/%s: %w", namespace, name, err)
+	}
+	// typed clients drop the type meta, set it so the backup is a complete manifest
+	configMap.APIVersion = "v1"
+	configMap.Kind = "ConfigMap"
+	configMap.UID = ""
+	configMap.ResourceVersion = ""
+	configMap.Generation = 0
+	configMap.CreationTimestamp = metav1.Time{}
+	configMap.ManagedFields = nil
+	manifest, err := yaml.Marshal(configMap)
+	if err != nil {
+		return fmt.Errorf("failed to marshal configmap %s/%s: %w", namespace, name, err)
+	}
+
+	dir := filepath.Join(backupDir, namespace)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create backup directory %s: %w", dir, err)
+	}
+	path := filepath.Join(dir, name+".yaml")
+	if err := os.WriteFile(path, manifest, 0600); err != nil {
+		return fmt.Errorf("failed to write backup file %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package kor
+
+import "context"
+
+// NamespaceResult holds the unused ConfigMaps of a single namespace, or the error that prevented scanning it
+type NamespaceResult struct {
+	Namespace string
+	Unused    []string
+	Err       error
+}
+
+// ProcessNamespaces scans the ConfigMaps of each namespace with lister and emits one result per namespace on the
+// returned channel, in the order of namespaces. The channel is unbuffered, so the scan only moves on to the next
+// namespace once the previous result was received. It is closed after the last result or once ctx is done.
+func ProcessNamespaces(ctx context.Context, lister ResourceLister, namespaces []string, filterOpts *FilterOptions) <-chan NamespaceResult {
+	results := make(chan NamespaceResult)
+	go func() {
+		defer close(results)
+		for _, namespace := range namespaces {
+			if ctx.Err() != nil {
+				return
+			}
+			unused, err := ProcessNamespaceConfigmaps(lister, namespace, filterOpts)
+			select {
+			case results <- NamespaceResult{Namespace: namespace, Unused: unused, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return results
+}
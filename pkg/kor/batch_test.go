@@ -0,0 +1,65 @@
+package kor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func batchNamespaces(count int) []string {
+	namespaces := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		namespaces = append(namespaces, fmt.Sprintf("namespace-%d", i))
+	}
+	return namespaces
+}
+
+func batchLister() ResourceLister {
+	return &staticResourceLister{configmaps: []corev1.ConfigMap{
+		{ObjectMeta: metav1.ObjectMeta{Name: "configmap-1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "configmap-2"}},
+	}}
+}
+
+func TestProcessNamespaces(t *testing.T) {
+	namespaces := batchNamespaces(50)
+
+	var emitted []string
+	for result := range ProcessNamespaces(context.Background(), batchLister(), namespaces, &FilterOptions{}) {
+		if result.Err != nil {
+			t.Fatalf("Error processing namespace %s: %v", result.Namespace, result.Err)
+		}
+		if !equalSlices(result.Unused, []string{"configmap-1", "configmap-2"}) {
+			t.Errorf("Unexpected unused configmaps in namespace %s: %v", result.Namespace, result.Unused)
+		}
+		emitted = append(emitted, result.Namespace)
+	}
+
+	if !equalSlices(emitted, namespaces) {
+		t.Errorf("Expected every namespace to be emitted in order, got %v", emitted)
+	}
+}
+
+func TestProcessNamespacesCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	results := ProcessNamespaces(ctx, batchLister(), batchNamespaces(50), &FilterOptions{})
+
+	<-results
+	cancel()
+	for range results {
+	}
+}
+
+func BenchmarkProcessNamespaces(b *testing.B) {
+	namespaces := batchNamespaces(1000)
+	lister := batchLister()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for range ProcessNamespaces(context.Background(), lister, namespaces, &FilterOptions{}) {
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package kor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// webhookCAConfigMapAnnotation names the "<namespace>/<name>" ConfigMap holding the CA bundle of a webhook
+// configuration. kor sets no such annotation itself: it is a convention for webhooks whose CA bundle is copied from a
+// ConfigMap by a controller or a deployment pipeline, and is only read with Opts.ScanWebhookCA.
+const webhookCAConfigMapAnnotation = "kor/ca-configmap"
+
+// ResourceReference identifies a namespaced resource
+type ResourceReference struct {
+	Namespace string
+	Name      string
+}
+
+// ClusterReferenceCollector returns the ConfigMaps referenced by cluster-scoped resources, which can't be found
+// by scanning the namespace of the ConfigMap
+type ClusterReferenceCollector func(ctx context.Context, clientset kubernetes.Interface) ([]ResourceReference, error)
+
+// clusterReferenceCollector is a registered collector, only run when enabled reports the scan options opt into it
+type clusterReferenceCollector struct {
+	enabled func(opts Opts) bool
+	collect func(ctx context.Context, clientset kubernetes.Interface, opts Opts) ([]ResourceReference, error)
+}
+
+// dynamicReferenceCollector returns the collector listing custom resources through Opts.DynamicClient, enabled with
+// the option enabled returns and a dynamic client
+func dynamicReferenceCollector(enabled func(opts Opts) bool, collect func(ctx context.Context, client dynamic.Interface) ([]ResourceReference, error)) clusterReferenceCollector {
+	return clusterReferenceCollector{
+		enabled: func(opts Opts) bool {
+			return enabled(opts) && opts.DynamicClient != nil
+		},
+		collect: func(ctx context.Context, clientset kubernetes.Interface, opts Opts) ([]ResourceReference, error) {
+			return collect(ctx, opts.DynamicClient)
+		},
+	}
+}
+
+var (
+	clusterReferenceCollectorsMu sync.RWMutex
+	clusterReferenceCollectors   = map[string]clusterReferenceCollector{
+		"webhook-ca": {
+			enabled: func(opts Opts) bool { return opts.ScanWebhookCA },
+			collect: func(ctx context.Context, clientset kubernetes.Interface, opts Opts) ([]ResourceReference, error) {
+				return collectWebhookCAReferences(ctx, clientset)
+			},
+		},
+		"keda": dynamicReferenceCollector(func(opts Opts) bool { return opts.ScanKEDA }, collectKEDAReferences),
+		// the Gateway API version is found through the discovery client of the clientset
+		"gateway-api": {
+			enabled: func(opts Opts) bool { return opts.ScanGatewayAPI && opts.DynamicClient != nil },
+			collect: func(ctx context.Context, clientset kubernetes.Interface, opts Opts) ([]ResourceReference, error) {
+				return collectGatewayAPIReferences(ctx, opts.DynamicClient, clientset.Discovery())
+			},
+		},
+	}
+)
+
+// RegisterClusterReferenceCollector adds a collector run once per ConfigMap scan, replacing any collector
+// registered under the same name. ConfigMaps returned by a collector are considered used.
+func RegisterClusterReferenceCollector(name string, collector ClusterReferenceCollector) {
+	clusterReferenceCollectorsMu.Lock()
+	defer clusterReferenceCollectorsMu.Unlock()
+	clusterReferenceCollectors[name] = clusterReferenceCollector{collect: func(ctx context.Context, clientset kubernetes.Interface, opts Opts) ([]ResourceReference, error) {
+		return collector(ctx, clientset)
+	}}
+}
+
+// UnregisterClusterReferenceCollector removes the collector registered under name
+func UnregisterClusterReferenceCollector(name string) {
+	clusterReferenceCollectorsMu.Lock()
+	defer clusterReferenceCollectorsMu.Unlock()
+	delete(clusterReferenceCollectors, name)
+}
+
+// collectClusterReferences runs every registered collector the scan options enable, the opt-in webhook CA, KEDA and
+// Gateway API collectors only run with their option, and returns the referenced ConfigMap names per namespace. A
+// failing collector only produces a warning, since its references are an addition to the namespace scan.
+func collectClusterReferences(clientset kubernetes.Interface, opts Opts) (map[string][]string, []string) {
+	clusterReferenceCollectorsMu.RLock()
+	names := make([]string, 0, len(clusterReferenceCollectors))
+	for name, collector := range clusterReferenceCollectors {
+		if collector.enabled == nil || collector.enabled(opts) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	collectors := make([]clusterReferenceCollector, 0, len(names))
+	for _, name := range names {
+		collectors = append(collectors, clusterReferenceCollectors[name])
+	}
+	clusterReferenceCollectorsMu.RUnlock()
+
+	references := make(map[string][]string)
+	var warnings []string
+	for i, collector := range collectors {
+		collected, err := collector.collect(context.TODO(), clientset, opts)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("failed to collect references with %s: %v", names[i], err))
+			continue
+		}
+		for _, reference := range collected {
+			references[reference.Namespace] = append(references[reference.Namespace], reference.Name)
+		}
+	}
+	return references, warnings
+}
+
+// collectWebhookCAReferences returns the ConfigMaps named by the kor/ca-configmap annotation of validating and
+// mutating webhook configurations
+func collectWebhookCAReferences(ctx context.Context, clientset kubernetes.Interface) ([]ResourceReference, error) {
+	validating, err := clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	mutating, err := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var annotations []map[string]string
+	for _, configuration := range validating.Items {
+		annotations = append(annotations, configuration.Annotations)
+	}
+	for _, configuration := range mutating.Items {
+		annotations = append(annotations, configuration.Annotations)
+	}
+
+	var references []ResourceReference
+	for _, resourceAnnotations := range annotations {
+		namespace, name, found := strings.Cut(resourceAnnotations[webhookCAConfigMapAnnotation], "/")
+		if found && namespace != "" && name != "" {
+			references = append(references, ResourceReference{Namespace: namespace, Name: name})
+		}
+	}
+	return references, nil
+}
@@ -0,0 +1,340 @@
+package kor
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestGetUnusedConfigmapsClusterReferenceCollector(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	RegisterClusterReferenceCollector("test", func(ctx context.Context, clientset kubernetes.Interface) ([]ResourceReference, error) {
+		return []ResourceReference{{Namespace: testNamespace, Name: "configmap-3"}}, nil
+	})
+	defer UnregisterClusterReferenceCollector("test")
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+	if strings.Contains(output, "configmap-3") {
+		t.Errorf("Expected configmap-3 referenced by the collector to be used, got %s", output)
+	}
+}
+
+func TestCollectWebhookCAReferences(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	configuration := &admissionregistrationv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "policy-webhook",
+			Annotations: map[string]string{webhookCAConfigMapAnnotation: testNamespace + "/configmap-3"},
+		},
+	}
+	if _, err := clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations().Create(context.TODO(), configuration, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake webhook configuration: %v", err)
+	}
+
+	references, err := collectWebhookCAReferences(context.TODO(), clientset)
+	if err != nil {
+		t.Fatalf("Error collecting references: %v", err)
+	}
+	if len(references) != 1 || references[0] != (ResourceReference{Namespace: testNamespace, Name: "configmap-3"}) {
+		t.Errorf("Expected a reference to configmap-3, got %v", references)
+	}
+
+	if collected, _ := collectClusterReferences(clientset, Opts{}); len(collected[testNamespace]) != 0 {
+		t.Errorf("Expected the webhook CA collector to be opt-in, got %v", collected)
+	}
+	if collected, _ := collectClusterReferences(clientset, Opts{ScanWebhookCA: true}); !reflect.DeepEqual(collected[testNamespace], []string{"configmap-3"}) {
+		t.Errorf("Expected configmap-3 with ScanWebhookCA, got %v", collected)
+	}
+}
+
+func TestGetUnusedConfigmapsSystemReferences(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	if _, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}}, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating namespace kube-system: %v", err)
+	}
+	for _, name := range []string{"extension-apiserver-authentication", "leftover-config"} {
+		if _, err := clientset.CoreV1().ConfigMaps("kube-system").Create(context.TODO(), CreateTestConfigmap("kube-system", name), metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{IncludeListStr: "kube-system"}, &FilterOptions{}, clientset, "json", Opts{ReportProtected: true})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	var actualOutput struct {
+		Namespaces map[string]map[string][]string `json:"namespaces"`
+		Protected  []ProtectedResource            `json:"protected"`
+	}
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+	if unused := actualOutput.Namespaces["kube-system"]["ConfigMap"]; !reflect.DeepEqual(unused, []string{"leftover-config"}) {
+		t.Errorf("Expected only leftover-config to be unused, got %v", unused)
+	}
+	expected := []ProtectedResource{{ResourceName: "extension-apiserver-authentication", Namespace: "kube-system", Source: ProtectionSourceBuiltInException, Reason: systemExceptionReason}}
+	if !reflect.DeepEqual(actualOutput.Protected, expected) {
+		t.Errorf("Expected the system configmap to be protected as a system exception, got %v", actualOutput.Protected)
+	}
+}
+
+func TestGetUnusedConfigmapsScanKEDA(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	triggerAuthentication := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "keda.sh/v1alpha1",
+		"kind":       "TriggerAuthentication",
+		"metadata":   map[string]interface{}{"name": "queue-auth", "namespace": testNamespace},
+		"spec": map[string]interface{}{
+			"configMapTargetRef": []interface{}{
+				map[string]interface{}{"parameter": "host", "name": "configmap-3", "key": "host"},
+			},
+		},
+	}}
+	clusterTriggerAuthentication := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "keda.sh/v1alpha1",
+		"kind":       "ClusterTriggerAuthentication",
+		"metadata":   map[string]interface{}{"name": "shared-queue-auth"},
+		"spec": map[string]interface{}{
+			"configMapTargetRef": []interface{}{
+				map[string]interface{}{"parameter": "host", "name": "queue-config", "key": "host"},
+			},
+		},
+	}}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		kedaTriggerAuthenticationResource:        "TriggerAuthenticationList",
+		kedaClusterTriggerAuthenticationResource: "ClusterTriggerAuthenticationList",
+	}, triggerAuthentication, clusterTriggerAuthentication)
+
+	references, _ := collectClusterReferences(clientset, Opts{ScanKEDA: true, DynamicClient: dynamicClient})
+	if !reflect.DeepEqual(references[kedaClusterObjectNamespace], []string{"queue-config"}) {
+		t.Errorf("Expected the ClusterTriggerAuthentication configmap in the KEDA namespace to be used, got %v", references)
+	}
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{ScanKEDA: true, DynamicClient: dynamicClient})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+	if strings.Contains(output, "configmap-3") {
+		t.Errorf("Expected configmap-3 referenced by the TriggerAuthentication to be used, got %s", output)
+	}
+
+	output, err = GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{DynamicClient: dynamicClient})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+	if !strings.Contains(output, "configmap-3") {
+		t.Errorf("Expected the TriggerAuthentication to be ignored without ScanKEDA, got %s", output)
+	}
+}
+
+func TestCollectKEDAReferencesWithoutKEDA(t *testing.T) {
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		kedaTriggerAuthenticationResource:        "TriggerAuthenticationList",
+		kedaClusterTriggerAuthenticationResource: "ClusterTriggerAuthenticationList",
+	})
+	// the API server returns not found for resources of CRDs that aren't installed
+	dynamicClient.PrependReactor("list", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewNotFound(action.GetResource().GroupResource(), "")
+	})
+
+	references, err := collectKEDAReferences(context.TODO(), dynamicClient)
+	if err != nil {
+		t.Fatalf("Expected a cluster without KEDA to be skipped, got %v", err)
+	}
+	if len(references) != 0 {
+		t.Errorf("Expected no references, got %v", references)
+	}
+}
+
+func newGatewayAPIDynamicClient(t *testing.T, objects ...*unstructured.Unstructured) *dynamicfake.FakeDynamicClient {
+	resources := map[string]string{"GatewayClass": "gatewayclasses", "Gateway": "gateways", "HTTPRoute": "httproutes"}
+	listKinds := make(map[schema.GroupVersionResource]string)
+	for _, version := range gatewayAPIVersions {
+		for kind, resource := range resources {
+			listKinds[gatewayAPIResource(version, resource)] = kind + "List"
+		}
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds)
+	// the fake guesses "gatewaies" from the Gateway kind, so objects are added with their resource
+	for _, object := range objects {
+		resource := gatewayAPIResource(object.GroupVersionKind().Version, resources[object.GetKind()])
+		if err := dynamicClient.Tracker().Create(resource, object, object.GetNamespace()); err != nil {
+			t.Fatalf("Error creating %s: %v", object.GetKind(), err)
+		}
+	}
+	return dynamicClient
+}
+
+// gatewayAPIResourceLists returns the discovery resource lists of a cluster serving the Gateway API at versions, the
+// first one being preferred
+func gatewayAPIResourceLists(versions ...string) []*metav1.APIResourceList {
+	var lists []*metav1.APIResourceList
+	for _, version := range versions {
+		lists = append(lists, &metav1.APIResourceList{GroupVersion: gatewayAPIGroup + "/" + version})
+	}
+	return lists
+}
+
+func TestGetUnusedConfigmapsScanGatewayAPI(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	httpRoute := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "HTTPRoute",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": testNamespace},
+		"spec": map[string]interface{}{
+			"rules": []interface{}{
+				map[string]interface{}{
+					"filters": []interface{}{
+						map[string]interface{}{
+							"type":         "ExtensionRef",
+							"extensionRef": map[string]interface{}{"group": "", "kind": "ConfigMap", "name": "configmap-3"},
+						},
+					},
+					"backendRefs": []interface{}{
+						map[string]interface{}{"name": "web", "port": int64(80)},
+					},
+				},
+			},
+		},
+	}}
+	dynamicClient := newGatewayAPIDynamicClient(t, httpRoute)
+	clientset.Resources = gatewayAPIResourceLists("v1")
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{ScanGatewayAPI: true, DynamicClient: dynamicClient})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+	if strings.Contains(output, "configmap-3") {
+		t.Errorf("Expected configmap-3 referenced by the HTTPRoute extensionRef to be used, got %s", output)
+	}
+
+	output, err = GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{DynamicClient: dynamicClient})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+	if !strings.Contains(output, "configmap-3") {
+		t.Errorf("Expected the HTTPRoute to be ignored without ScanGatewayAPI, got %s", output)
+	}
+}
+
+func TestCollectGatewayAPIReferences(t *testing.T) {
+	gatewayClass := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "GatewayClass",
+		"metadata":   map[string]interface{}{"name": "proxy"},
+		"spec": map[string]interface{}{
+			"parametersRef": map[string]interface{}{"group": "", "kind": "ConfigMap", "name": "proxy-config", "namespace": "gateway-system"},
+		},
+	}}
+	gateway := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "Gateway",
+		"metadata":   map[string]interface{}{"name": "edge", "namespace": testNamespace},
+		"spec": map[string]interface{}{
+			"infrastructure": map[string]interface{}{
+				"parametersRef": map[string]interface{}{"group": "", "kind": "ConfigMap", "name": "edge-config"},
+			},
+		},
+	}}
+	httpRoute := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "HTTPRoute",
+		"metadata":   map[string]interface{}{"name": "static", "namespace": testNamespace},
+		"spec": map[string]interface{}{
+			"rules": []interface{}{
+				map[string]interface{}{
+					"backendRefs": []interface{}{
+						map[string]interface{}{"group": "", "kind": "ConfigMap", "name": "static-content", "namespace": "content"},
+						map[string]interface{}{
+							"name": "web",
+							"filters": []interface{}{
+								map[string]interface{}{"extensionRef": map[string]interface{}{"group": "", "kind": "ConfigMap", "name": "backend-filter"}},
+								map[string]interface{}{"extensionRef": map[string]interface{}{"group": "example.com", "kind": "ConfigMap", "name": "not-core"}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}}
+
+	discoveryClient := &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{Resources: gatewayAPIResourceLists("v1", "v1beta1")}}
+	references, err := collectGatewayAPIReferences(context.TODO(), newGatewayAPIDynamicClient(t, gatewayClass, gateway, httpRoute), discoveryClient)
+	if err != nil {
+		t.Fatalf("Error collecting references: %v", err)
+	}
+	expected := []ResourceReference{
+		{Namespace: "gateway-system", Name: "proxy-config"},
+		{Namespace: testNamespace, Name: "edge-config"},
+		{Namespace: "content", Name: "static-content"},
+		{Namespace: testNamespace, Name: "backend-filter"},
+	}
+	if !reflect.DeepEqual(references, expected) {
+		t.Errorf("Expected references %v, got %v", expected, references)
+	}
+}
+
+func TestCollectGatewayAPIReferencesWithoutGatewayAPI(t *testing.T) {
+	dynamicClient := newGatewayAPIDynamicClient(t)
+
+	references, err := collectGatewayAPIReferences(context.TODO(), dynamicClient, &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{}})
+	if err != nil {
+		t.Fatalf("Expected a cluster without the Gateway API to be skipped, got %v", err)
+	}
+	if len(references) != 0 {
+		t.Errorf("Expected no references, got %v", references)
+	}
+	if actions := dynamicClient.Actions(); len(actions) != 0 {
+		t.Errorf("Expected no Gateway API resources to be listed, got %v", actions)
+	}
+}
+
+func TestGatewayAPIVersion(t *testing.T) {
+	tests := []struct {
+		name         string
+		served       []string
+		expected     string
+		expectServed bool
+	}{
+		{name: "preferred v1", served: []string{"v1", "v1beta1"}, expected: "v1", expectServed: true},
+		{name: "preferred v1beta1", served: []string{"v1beta1", "v1"}, expected: "v1beta1", expectServed: true},
+		{name: "preferred version too old", served: []string{"v1alpha2", "v1beta1"}, expected: "v1beta1", expectServed: true},
+		{name: "only versions too old", served: []string{"v1alpha2"}},
+		{name: "not installed"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			discoveryClient := &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{Resources: gatewayAPIResourceLists(test.served...)}}
+			version, present, err := gatewayAPIVersion(discoveryClient)
+			if err != nil {
+				t.Fatalf("Error finding the Gateway API version: %v", err)
+			}
+			if version != test.expected || present != test.expectServed {
+				t.Errorf("Expected version %q (served: %v), got %q (served: %v)", test.expected, test.expectServed, version, present)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package kor
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// ReferenceConfidence is how certain kor is that a reference to a resource means the resource is in use
+type ReferenceConfidence int
+
+const (
+	// ConfidenceLow references are found by heuristics, such as a name matching an env var value or annotation
+	ConfidenceLow ReferenceConfidence = iota + 1
+	// ConfidenceHigh references are stated explicitly in a pod spec, or are kor exceptions
+	ConfidenceHigh
+)
+
+func (c ReferenceConfidence) String() string {
+	switch c {
+	case ConfidenceLow:
+		return "low"
+	case ConfidenceHigh:
+		return "high"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseReferenceConfidence parses "low" or "high", an empty value is ConfidenceHigh
+func ParseReferenceConfidence(value string) (ReferenceConfidence, error) {
+	switch value {
+	case "low":
+		return ConfidenceLow, nil
+	case "", "high":
+		return ConfidenceHigh, nil
+	default:
+		return 0, fmt.Errorf("invalid reference confidence %q, must be low or high", value)
+	}
+}
+
+// sources of the low confidence references
+const (
+	envValueReferenceSource   = "env var value"
+	annotationReferenceSource = "annotation"
+)
+
+// heuristicReference is a low confidence reference to a ConfigMap
+type heuristicReference struct {
+	name   string
+	source string
+}
+
+// KeptReference is a reference below ConfidenceHigh that kept an unused ConfigMap from being deleted
+type KeptReference struct {
+	ResourceName string `json:"resourceName"`
+	Namespace    string `json:"namespace"`
+	Confidence   string `json:"confidence"`
+	Source       string `json:"source"`
+}
+
+// minDeleteConfidenceLow reports whether low confidence references keep ConfigMaps from being deleted
+func minDeleteConfidenceLow(opts Opts) bool {
+	minConfidence, err := ParseReferenceConfidence(opts.MinDeleteConfidence)
+	return err == nil && minConfidence == ConfidenceLow
+}
+
+// retrieveHeuristicCM returns the low confidence references to candidates, whether or not the heuristics are
+// enabled for reporting. Annotations are only checked for the configured reference annotation keys.
+func retrieveHeuristicCM(lister ResourceLister, namespace string, candidates []string, opts Opts) ([]heuristicReference, error) {
+	envValueCM, err := retrieveEnvValueCM(lister, namespace, candidates)
+	if err != nil {
+		return nil, err
+	}
+	var annotationCM []string
+	if len(opts.ReferenceAnnotationKeys) > 0 {
+		if annotationCM, err = retrieveAnnotationCM(lister, namespace, opts.ReferenceAnnotationKeys, candidates); err != nil {
+			return nil, err
+		}
+	}
+
+	var references []heuristicReference
+	for _, name := range RemoveDuplicatesAndSort(envValueCM) {
+		references = append(references, heuristicReference{name: name, source: envValueReferenceSource})
+	}
+	for _, name := range RemoveDuplicatesAndSort(annotationCM) {
+		references = append(references, heuristicReference{name: name, source: annotationReferenceSource})
+	}
+	return references, nil
+}
+
+// protectReferencedCM splits the deletion candidates of a namespace into the ones that can be deleted and the
+// references keeping the others, when the minimum delete confidence is ConfidenceLow. Candidates only have
+// references below ConfidenceHigh, the low confidence ones are the references found by the namespace scan.
+func protectReferencedCM(namespace string, candidates []string, references []heuristicReference, opts Opts) ([]string, []KeptReference) {
+	if !minDeleteConfidenceLow(opts) || len(candidates) == 0 {
+		return candidates, nil
+	}
+
+	isCandidate := make(map[string]bool, len(candidates))
+	for _, name := range candidates {
+		isCandidate[name] = true
+	}
+	var kept []KeptReference
+	referenced := make(map[string]bool, len(references))
+	for _, reference := range references {
+		if !isCandidate[reference.name] || referenced[reference.name] {
+			continue
+		}
+		referenced[reference.name] = true
+		kept = append(kept, KeptReference{ResourceName: reference.name, Namespace: namespace, Confidence: ConfidenceLow.String(), Source: reference.source})
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].ResourceName < kept[j].ResourceName })
+
+	var deletable []string
+	for _, name := range candidates {
+		if !referenced[name] {
+			deletable = append(deletable, name)
+		}
+	}
+	return deletable, kept
+}
+
+// FormatKeptReferences formats the ConfigMaps kept from deletion and the references keeping them
+func FormatKeptReferences(kept []KeptReference) string {
+	var buf bytes.Buffer
+	table := tablewriter.NewWriter(&buf)
+	table.SetHeader([]string{"#", "Namespace", "Resource Name", "Confidence", "Source"})
+
+	for i, reference := range kept {
+		table.Append([]string{fmt.Sprintf("%d", i+1), reference.Namespace, reference.ResourceName, reference.Confidence, reference.Source})
+	}
+
+	table.Render()
+	return fmt.Sprintf("Kept from deletion by low confidence references:\n%s", buf.String())
+}
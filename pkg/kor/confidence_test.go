@@ -0,0 +1,80 @@
+package kor
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetUnusedConfigmapsMinDeleteConfidence(t *testing.T) {
+	for _, test := range []struct {
+		minDeleteConfidence string
+		expectDeleted       bool
+	}{
+		{minDeleteConfidence: "low", expectDeleted: false},
+		{minDeleteConfidence: "high", expectDeleted: true},
+	} {
+		t.Run(test.minDeleteConfidence, func(t *testing.T) {
+			clientset := createTestConfigmaps(t)
+			pod := CreateTestPod(testNamespace, "pod-env-value", "", nil)
+			pod.Spec.Containers = []corev1.Container{
+				{Name: "app", Env: []corev1.EnvVar{{Name: "CONFIG_NAME", Value: "configmap-3"}}},
+			}
+			if _, err := clientset.CoreV1().Pods(testNamespace).Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+				t.Fatalf("Error creating fake pod: %v", err)
+			}
+
+			opts := Opts{DeleteFlag: true, NoInteractive: true, MinDeleteConfidence: test.minDeleteConfidence}
+			output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+			if err != nil {
+				t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+			}
+
+			_, err = clientset.CoreV1().ConfigMaps(testNamespace).Get(context.TODO(), "configmap-3", metav1.GetOptions{})
+			if deleted := err != nil; deleted != test.expectDeleted {
+				t.Errorf("Expected configmap-3 deleted to be %t, got output %s", test.expectDeleted, output)
+			}
+			if test.expectDeleted {
+				return
+			}
+			var envelope struct {
+				Kept       []KeptReference                `json:"kept"`
+				Namespaces map[string]map[string][]string `json:"namespaces"`
+			}
+			if err := json.Unmarshal([]byte(output), &envelope); err != nil {
+				t.Fatalf("Error unmarshaling actual output: %v", err)
+			}
+			expectedKept := []KeptReference{{ResourceName: "configmap-3", Namespace: testNamespace, Confidence: "low", Source: "env var value"}}
+			if !reflect.DeepEqual(envelope.Kept, expectedKept) {
+				t.Errorf("Expected the kept references %v, got %v", expectedKept, envelope.Kept)
+			}
+			if !slicesContain(envelope.Namespaces[testNamespace]["ConfigMap"], "configmap-3-SKIPPED") {
+				t.Errorf("Expected configmap-3 to be reported as skipped, got %s", output)
+			}
+
+			table, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "table", opts)
+			if err != nil {
+				t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+			}
+			if !strings.Contains(table, "Kept from deletion by low confidence references") || !strings.Contains(table, "env var value") {
+				t.Errorf("Expected the table output to list the kept references, got %s", table)
+			}
+		})
+	}
+}
+
+func TestParseReferenceConfidence(t *testing.T) {
+	for value, expected := range map[string]ReferenceConfidence{"": ConfidenceHigh, "high": ConfidenceHigh, "low": ConfidenceLow} {
+		if got, err := ParseReferenceConfidence(value); err != nil || got != expected {
+			t.Errorf("Expected %q to parse as %s, got %s (%v)", value, expected, got, err)
+		}
+	}
+	if _, err := ParseReferenceConfidence("medium"); err == nil {
+		t.Error("Expected an error for an unknown confidence")
+	}
+}
@@ -0,0 +1,130 @@
+package kor
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// configMapRefKind is where in a pod spec a ConfigMap is referenced
+type configMapRefKind int
+
+const (
+	// volumeRef is a configMap volume
+	volumeRef configMapRefKind = iota
+	// projectedVolumeRef is a configMap source of a projected volume
+	projectedVolumeRef
+	// initVolumeMountRef is a ConfigMap mounted by an init container through a configMap or projected volume
+	initVolumeMountRef
+	// envRef is an env var of a container or ephemeral container
+	envRef
+	// envFromRef is an envFrom source of a container or ephemeral container
+	envFromRef
+	// envFromContainerRef is an envFrom source of a container, ephemeral containers excluded
+	envFromContainerRef
+	// envFromInitContainerRef is an env var or envFrom source of an init container, native sidecars included
+	envFromInitContainerRef
+)
+
+// configMapRef is a reference to a ConfigMap from a pod spec, along with the key of an env var or the items of a
+// volume it requires
+type configMapRef struct {
+	kind     configMapRefKind
+	name     string
+	key      string
+	items    []corev1.KeyToPath
+	optional bool
+}
+
+// extractConfigMapRefs walks the pod spec once and returns every ConfigMap it references through volumes, projected
+// volumes and the env and envFrom of containers, init containers and ephemeral containers, in spec order. Regular
+// container envFrom sources are returned both as envFromRef and envFromContainerRef.
+func extractConfigMapRefs(spec *corev1.PodSpec) []configMapRef {
+	return appendConfigMapRefs(nil, spec)
+}
+
+// appendConfigMapRefs appends the references extractConfigMapRefs returns to refs, so callers walking many pods
+// can reuse a buffer
+func appendConfigMapRefs(refs []configMapRef, spec *corev1.PodSpec) []configMapRef {
+	for _, volume := range spec.Volumes {
+		if volume.ConfigMap != nil {
+			refs = append(refs, configMapRef{kind: volumeRef, name: volume.ConfigMap.Name, items: volume.ConfigMap.Items, optional: isOptional(volume.ConfigMap.Optional)})
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil {
+					refs = append(refs, configMapRef{kind: projectedVolumeRef, name: source.ConfigMap.Name, items: source.ConfigMap.Items, optional: isOptional(source.ConfigMap.Optional)})
+				}
+			}
+		}
+	}
+	for i := range spec.Containers {
+		container := &spec.Containers[i]
+		refs = appendEnvRefs(refs, container.Env, envRef)
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.ConfigMapRef != nil {
+				optional := isOptional(envFrom.ConfigMapRef.Optional)
+				refs = append(refs,
+					configMapRef{kind: envFromRef, name: envFrom.ConfigMapRef.Name, optional: optional},
+					configMapRef{kind: envFromContainerRef, name: envFrom.ConfigMapRef.Name, optional: optional})
+			}
+		}
+	}
+	// native sidecars are init containers with restartPolicy Always, so their references are collected here too
+	for i := range spec.InitContainers {
+		initContainer := &spec.InitContainers[i]
+		for _, mount := range initContainer.VolumeMounts {
+			refs = appendVolumeMountRefs(refs, spec.Volumes, mount.Name)
+		}
+		refs = appendEnvRefs(refs, initContainer.Env, envFromInitContainerRef)
+		for _, envFrom := range initContainer.EnvFrom {
+			if envFrom.ConfigMapRef != nil {
+				refs = append(refs, configMapRef{kind: envFromInitContainerRef, name: envFrom.ConfigMapRef.Name, optional: isOptional(envFrom.ConfigMapRef.Optional)})
+			}
+		}
+	}
+	for i := range spec.EphemeralContainers {
+		ephemeralContainer := &spec.EphemeralContainers[i]
+		refs = appendEnvRefs(refs, ephemeralContainer.Env, envRef)
+		for _, envFrom := range ephemeralContainer.EnvFrom {
+			if envFrom.ConfigMapRef != nil {
+				refs = append(refs, configMapRef{kind: envFromRef, name: envFrom.ConfigMapRef.Name, optional: isOptional(envFrom.ConfigMapRef.Optional)})
+			}
+		}
+	}
+	return refs
+}
+
+// appendVolumeMountRefs appends an initVolumeMountRef for each ConfigMap the volume named volumeName mounts, as
+// volume mounts only name a volume of the pod spec
+func appendVolumeMountRefs(refs []configMapRef, volumes []corev1.Volume, volumeName string) []configMapRef {
+	for _, volume := range volumes {
+		if volume.Name != volumeName {
+			continue
+		}
+		if volume.ConfigMap != nil {
+			refs = append(refs, configMapRef{kind: initVolumeMountRef, name: volume.ConfigMap.Name, items: volume.ConfigMap.Items, optional: isOptional(volume.ConfigMap.Optional)})
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil {
+					refs = append(refs, configMapRef{kind: initVolumeMountRef, name: source.ConfigMap.Name, items: source.ConfigMap.Items, optional: isOptional(source.ConfigMap.Optional)})
+				}
+			}
+		}
+		break
+	}
+	return refs
+}
+
+func appendEnvRefs(refs []configMapRef, env []corev1.EnvVar, kind configMapRefKind) []configMapRef {
+	for _, envVar := range env {
+		if envVar.ValueFrom != nil && envVar.ValueFrom.ConfigMapKeyRef != nil {
+			keyRef := envVar.ValueFrom.ConfigMapKeyRef
+			refs = append(refs, configMapRef{kind: kind, name: keyRef.Name, key: keyRef.Key, optional: isOptional(keyRef.Optional)})
+		}
+	}
+	return refs
+}
+
+func isOptional(optional *bool) bool {
+	return optional != nil && *optional
+}
@@ -0,0 +1,75 @@
+package kor
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestExtractConfigMapRefs(t *testing.T) {
+	optional := true
+	restartPolicy := corev1.ContainerRestartPolicyAlways
+	envSource := func(name string) *corev1.ConfigMapEnvSource {
+		return &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: name}}
+	}
+	keyRef := func(name, key string) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}}
+	}
+
+	spec := corev1.PodSpec{
+		Volumes: []corev1.Volume{
+			{Name: "trust", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "registry-ca"},
+				Items:                []corev1.KeyToPath{{Key: "ca.crt", Path: "ca.crt"}},
+			}}},
+			{Name: "bundle", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+				{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "projected-config"}, Optional: &optional}},
+				{Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "projected-secret"}}},
+			}}}},
+			{Name: "scratch", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		},
+		Containers: []corev1.Container{{
+			Name:    "app",
+			Env:     []corev1.EnvVar{{Name: "MODE", ValueFrom: keyRef("app-config", "mode")}, {Name: "LITERAL", Value: "value"}},
+			EnvFrom: []corev1.EnvFromSource{{ConfigMapRef: envSource("app-env")}, {SecretRef: &corev1.SecretEnvSource{}}},
+		}},
+		InitContainers: []corev1.Container{{
+			Name:          "sidecar",
+			RestartPolicy: &restartPolicy,
+			Env:           []corev1.EnvVar{{Name: "LEVEL", ValueFrom: keyRef("sidecar-config", "level")}},
+			EnvFrom:       []corev1.EnvFromSource{{ConfigMapRef: envSource("sidecar-env")}},
+			VolumeMounts: []corev1.VolumeMount{
+				{Name: "trust", MountPath: "/etc/ssl/registry"},
+				{Name: "bundle", MountPath: "/etc/bundle"},
+				{Name: "scratch", MountPath: "/tmp"},
+			},
+		}},
+		EphemeralContainers: []corev1.EphemeralContainer{{EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Name:    "debug",
+			Env:     []corev1.EnvVar{{Name: "TARGET", ValueFrom: keyRef("debug-config", "target")}},
+			EnvFrom: []corev1.EnvFromSource{{ConfigMapRef: envSource("debug-env")}},
+		}}},
+	}
+
+	expected := []configMapRef{
+		{kind: volumeRef, name: "registry-ca", items: []corev1.KeyToPath{{Key: "ca.crt", Path: "ca.crt"}}},
+		{kind: projectedVolumeRef, name: "projected-config", optional: true},
+		{kind: envRef, name: "app-config", key: "mode"},
+		{kind: envFromRef, name: "app-env"},
+		{kind: envFromContainerRef, name: "app-env"},
+		{kind: initVolumeMountRef, name: "registry-ca", items: []corev1.KeyToPath{{Key: "ca.crt", Path: "ca.crt"}}},
+		{kind: initVolumeMountRef, name: "projected-config", optional: true},
+		{kind: envFromInitContainerRef, name: "sidecar-config", key: "level"},
+		{kind: envFromInitContainerRef, name: "sidecar-env"},
+		{kind: envRef, name: "debug-config", key: "target"},
+		{kind: envFromRef, name: "debug-env"},
+	}
+	if refs := extractConfigMapRefs(&spec); !reflect.DeepEqual(refs, expected) {
+		t.Errorf("Expected refs %+v, got %+v", expected, refs)
+	}
+
+	if refs := extractConfigMapRefs(&corev1.PodSpec{}); len(refs) != 0 {
+		t.Errorf("Expected no refs for an empty pod spec, got %+v", refs)
+	}
+}
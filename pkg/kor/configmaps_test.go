@@ -1,17 +1,34 @@
 package kor
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/kubernetes/scheme"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
 )
 
 func createTestConfigmaps(t *testing.T) *fake.Clientset {
@@ -101,7 +118,7 @@ func createTestConfigmaps(t *testing.T) *fake.Clientset {
 func TestRetrieveConfigMapNames(t *testing.T) {
 	clientset := createTestConfigmaps(t)
 
-	configMapNames, err := retrieveConfigMapNames(clientset, testNamespace, &FilterOptions{})
+	configMapNames, err := retrieveConfigMapNames(NewResourceLister(clientset), testNamespace, &FilterOptions{}, nil)
 
 	if err != nil {
 		t.Fatalf("Error retrieving configmap names: %v", err)
@@ -130,7 +147,7 @@ func TestProcessNamespaceCM(t *testing.T) {
 func TestRetrieveUsedCM(t *testing.T) {
 	clientset := createTestConfigmaps(t)
 
-	volumesCM, volumesProjectedCM, envCM, envFromCM, envFromContainerCM, envFromInitContainerCM, err := retrieveUsedCM(clientset, testNamespace)
+	volumesCM, volumesProjectedCM, envCM, envFromCM, envFromContainerCM, envFromInitContainerCM, err := retrieveUsedCM(NewResourceLister(clientset), testNamespace)
 
 	if err != nil {
 		t.Fatalf("Error retrieving used ConfigMaps: %v", err)
@@ -205,7 +222,2259 @@ func TestGetUnusedConfigmapsStructured(t *testing.T) {
 	}
 }
 
+func TestGetUnusedConfigmapsClusterInfo(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	opts := Opts{
+		NoInteractive: true,
+		ClusterInfo:   &ClusterInfo{Host: "https://cluster.example.com:6443"},
+	}
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	var actualOutput struct {
+		Cluster    *ClusterInfo                   `json:"cluster"`
+		Namespaces map[string]map[string][]string `json:"namespaces"`
+	}
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+
+	if actualOutput.Cluster == nil || actualOutput.Cluster.Host != "https://cluster.example.com:6443" {
+		t.Errorf("Expected cluster host to be populated, got %v", actualOutput.Cluster)
+	}
+	if !reflect.DeepEqual(actualOutput.Namespaces[testNamespace]["ConfigMap"], []string{"configmap-3"}) {
+		t.Errorf("Expected unused configmaps under namespaces, got %v", actualOutput.Namespaces)
+	}
+}
+
+func TestGetUnusedConfigmapsClusterWideList(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	otherNamespace := "other-namespace"
+	_, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: otherNamespace},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Error creating namespace %s: %v", otherNamespace, err)
+	}
+	_, err = clientset.CoreV1().ConfigMaps(otherNamespace).Create(context.TODO(), CreateTestConfigmap(otherNamespace, "configmap-1"), metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Error creating fake configmap: %v", err)
+	}
+
+	perNamespaceOutput, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	clientset.ClearActions()
+	clusterWideOutput, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{ClusterWideList: true})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	if perNamespaceOutput != clusterWideOutput {
+		t.Errorf("Expected cluster-wide output %s to match per-namespace output %s", clusterWideOutput, perNamespaceOutput)
+	}
+
+	listCalls := make(map[string]int)
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() != "list" {
+			continue
+		}
+		listCalls[action.GetResource().Resource]++
+		if action.GetResource().Resource != "namespaces" && action.GetNamespace() != metav1.NamespaceAll {
+			t.Errorf("Expected cluster-wide list of %s, got namespace %q", action.GetResource().Resource, action.GetNamespace())
+		}
+	}
+	if listCalls["configmaps"] != 1 || listCalls["pods"] != 1 {
+		t.Errorf("Expected a single configmaps and pods list call, got %v", listCalls)
+	}
+}
+
+// configMapReferenceTypes are the types through which a PodSpec can reference a ConfigMap by name
+var configMapReferenceTypes = map[reflect.Type]bool{
+	reflect.TypeOf(corev1.ConfigMapVolumeSource{}): true,
+	reflect.TypeOf(corev1.ConfigMapProjection{}):   true,
+	reflect.TypeOf(corev1.ConfigMapKeySelector{}):  true,
+	reflect.TypeOf(corev1.ConfigMapEnvSource{}):    true,
+}
+
+// unhandledConfigMapReferences lists PodSpec paths that intentionally aren't detected by retrieveUsedCM.
+// Any reference location added to the Kubernetes API must either be handled by retrieveUsedCM or be
+// listed here with the reason it is ignored, otherwise TestRetrieveUsedCMCoversPodSpec fails.
+var unhandledConfigMapReferences = map[string]string{}
+
+type configMapReferencePath struct {
+	fields []int
+	name   string
+}
+
+// findConfigMapReferences walks t and records the field path of every ConfigMap reference type it contains
+func findConfigMapReferences(t reflect.Type, parent configMapReferencePath, visiting map[reflect.Type]bool, found *[]configMapReferencePath) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr || fieldType.Kind() == reflect.Slice {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() != reflect.Struct {
+			continue
+		}
+
+		path := configMapReferencePath{
+			fields: append(append([]int{}, parent.fields...), i),
+			name:   strings.TrimPrefix(parent.name+"."+field.Name, "."),
+		}
+		if configMapReferenceTypes[fieldType] {
+			*found = append(*found, path)
+			continue
+		}
+		if visiting[fieldType] {
+			continue
+		}
+		visiting[fieldType] = true
+		findConfigMapReferences(fieldType, path, visiting, found)
+		delete(visiting, fieldType)
+	}
+}
+
+// setConfigMapReference allocates every pointer and slice along path and sets the referenced ConfigMap name
+func setConfigMapReference(spec *corev1.PodSpec, path configMapReferencePath, configMapName string) {
+	value := reflect.ValueOf(spec).Elem()
+	for _, index := range path.fields {
+		value = value.Field(index)
+		for value.Kind() == reflect.Ptr || value.Kind() == reflect.Slice {
+			if value.Kind() == reflect.Ptr {
+				if value.IsNil() {
+					value.Set(reflect.New(value.Type().Elem()))
+				}
+				value = value.Elem()
+			} else {
+				if value.Len() == 0 {
+					value.Set(reflect.MakeSlice(value.Type(), 1, 1))
+				}
+				value = value.Index(0)
+			}
+		}
+	}
+	value.FieldByName("Name").SetString(configMapName)
+}
+
+func TestRetrieveUsedCMCoversPodSpec(t *testing.T) {
+	var paths []configMapReferencePath
+	findConfigMapReferences(reflect.TypeOf(corev1.PodSpec{}), configMapReferencePath{}, map[reflect.Type]bool{}, &paths)
+	if len(paths) == 0 {
+		t.Fatalf("Expected to find ConfigMap references in PodSpec")
+	}
+
+	for _, path := range paths {
+		t.Run(path.name, func(t *testing.T) {
+			if reason, ok := unhandledConfigMapReferences[path.name]; ok {
+				t.Skipf("Not handled by retrieveUsedCM: %s", reason)
+			}
+
+			configMapName := strings.ToLower(strings.ReplaceAll(path.name, ".", "-"))
+			pod := CreateTestPod(testNamespace, "pod-1", "", nil)
+			setConfigMapReference(&pod.Spec, path, configMapName)
+
+			volumesCM, volumesProjectedCM, envCM, envFromCM, envFromContainerCM, envFromInitContainerCM, err := retrieveUsedCM(&staticResourceLister{pods: []corev1.Pod{*pod}}, testNamespace)
+			if err != nil {
+				t.Fatalf("Error retrieving used ConfigMaps: %v", err)
+			}
+
+			for _, used := range [][]string{volumesCM, volumesProjectedCM, envCM, envFromCM, envFromContainerCM, envFromInitContainerCM} {
+				for _, name := range used {
+					if name == configMapName {
+						return
+					}
+				}
+			}
+			t.Errorf("ConfigMap referenced through %s is not detected by retrieveUsedCM", path.name)
+		})
+	}
+}
+
+// createClusterIdentityNamespace creates the kube-system namespace findings are identified by and returns its UID
+func createClusterIdentityNamespace(t *testing.T, clientset *fake.Clientset) string {
+	t.Helper()
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: clusterIdentityNamespace, UID: "cluster-uid"}}
+	if _, err := clientset.CoreV1().Namespaces().Create(context.TODO(), namespace, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating namespace %s: %v", clusterIdentityNamespace, err)
+	}
+	return string(namespace.UID)
+}
+
+func TestGetUnusedConfigmapsResourcePaths(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	cluster := createClusterIdentityNamespace(t, clientset)
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{IncludeResourcePaths: true})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	var actualOutput map[string]map[string][]ResourceFinding
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+
+	expected := []ResourceFinding{{
+		Name:      "configmap-3",
+		Path:      "/api/v1/namespaces/test-namespace/configmaps/configmap-3",
+		FindingID: FindingID(cluster, testNamespace, "ConfigMap", "configmap-3"),
+	}}
+	if !reflect.DeepEqual(actualOutput[testNamespace]["ConfigMap"], expected) {
+		t.Errorf("Expected findings %v, got %v", expected, actualOutput[testNamespace]["ConfigMap"])
+	}
+}
+
+func TestGetUnusedConfigmapsResourceIdentity(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	cluster := createClusterIdentityNamespace(t, clientset)
+	configmap := CreateTestConfigmap(testNamespace, "configmap-4")
+	configmap.UID = "uid-4"
+	configmap.ResourceVersion = "42"
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), configmap, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake configmap: %v", err)
+	}
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{IncludeResourceIdentity: true, Canonical: true})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	var actualOutput map[string]map[string][]ResourceFinding
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+	findings := actualOutput[testNamespace]["ConfigMap"]
+	if len(findings) != 2 {
+		t.Fatalf("Expected 2 findings, got %v", findings)
+	}
+	expected := ResourceFinding{Name: "configmap-4", UID: "uid-4", ResourceVersion: "42", FindingID: FindingID(cluster, testNamespace, "ConfigMap", "configmap-4")}
+	if !reflect.DeepEqual(findings[1], expected) {
+		t.Errorf("Expected finding %v, got %v", expected, findings[1])
+	}
+}
+
+func TestGetUnusedConfigmapsIgnoreTerminatingPods(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	deletionTimestamp := metav1.Now()
+	terminatingPod := CreateTestPod(testNamespace, "pod-terminating", "", []corev1.Volume{
+		{Name: "vol-1", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "configmap-3"}}}},
+	})
+	terminatingPod.DeletionTimestamp = &deletionTimestamp
+	evictedPod := CreateTestPod(testNamespace, "pod-evicted", "", []corev1.Volume{
+		{Name: "vol-1", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "configmap-3"}}}},
+	})
+	evictedPod.Status = corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted"}
+
+	for _, pod := range []*corev1.Pod{terminatingPod, evictedPod} {
+		if _, err := clientset.CoreV1().Pods(testNamespace).Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake pod: %v", err)
+		}
+	}
+
+	unused := func(opts Opts) []string {
+		output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+		if err != nil {
+			t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+		}
+		var actualOutput map[string]map[string][]string
+		if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+			t.Fatalf("Error unmarshaling actual output: %v", err)
+		}
+		return actualOutput[testNamespace]["ConfigMap"]
+	}
+
+	if diff := unused(Opts{}); len(diff) != 0 {
+		t.Errorf("Expected terminating pods to keep configmap-3 in use by default, got %v", diff)
+	}
+	if diff := unused(Opts{IgnoreTerminatingPods: true}); !equalSlices(diff, []string{"configmap-3"}) {
+		t.Errorf("Expected configmap-3 to be reported unused, got %v", diff)
+	}
+}
+
+func TestGetUnusedConfigmapsIgnoreCompletedJobPods(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), CreateTestConfigmap(testNamespace, "configmap-4"), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake configmap: %v", err)
+	}
+
+	controller := true
+	for _, test := range []struct {
+		job       string
+		configMap string
+		condition batchv1.JobConditionType
+	}{
+		{job: "migration", configMap: "configmap-3", condition: batchv1.JobComplete},
+		{job: "backfill", configMap: "configmap-4"},
+	} {
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: test.job, Namespace: testNamespace, UID: types.UID(test.job + "-uid")}}
+		if test.condition != "" {
+			job.Status.Conditions = []batchv1.JobCondition{{Type: test.condition, Status: corev1.ConditionTrue}}
+		}
+		if _, err := clientset.BatchV1().Jobs(testNamespace).Create(context.TODO(), job, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake job: %v", err)
+		}
+
+		pod := CreateTestPod(testNamespace, test.job+"-pod", "", []corev1.Volume{
+			{Name: "vol-1", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: test.configMap}}}},
+		})
+		pod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "Job", Name: job.Name, UID: job.UID, Controller: &controller}}
+		if _, err := clientset.CoreV1().Pods(testNamespace).Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake pod: %v", err)
+		}
+	}
+
+	unused := func(opts Opts) []string {
+		output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+		if err != nil {
+			t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+		}
+		var actualOutput map[string]map[string][]string
+		if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+			t.Fatalf("Error unmarshaling actual output: %v", err)
+		}
+		return actualOutput[testNamespace]["ConfigMap"]
+	}
+
+	if diff := unused(Opts{}); len(diff) != 0 {
+		t.Errorf("Expected the pods of jobs to keep their configmaps in use by default, got %v", diff)
+	}
+	if diff := unused(Opts{IgnoreCompletedJobPods: true}); !equalSlices(diff, []string{"configmap-3"}) {
+		t.Errorf("Expected only configmap-3 of the completed job to be reported unused, got %v", diff)
+	}
+
+	migration, err := clientset.BatchV1().Jobs(testNamespace).Get(context.TODO(), "migration", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Error getting fake job: %v", err)
+	}
+	migration.Spec.Template.Spec.Volumes = []corev1.Volume{
+		{Name: "vol-1", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "configmap-3"}}}},
+	}
+	if _, err := clientset.BatchV1().Jobs(testNamespace).Update(context.TODO(), migration, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("Error updating fake job: %v", err)
+	}
+	jobLists := 0
+	clientset.PrependReactor("list", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		jobLists++
+		return false, nil, nil
+	})
+	if diff := unused(Opts{ScanJobTemplates: true, IgnoreCompletedJobPods: true}); !equalSlices(diff, []string{"configmap-3"}) {
+		t.Errorf("Expected the template of the completed job not to keep configmap-3 in use, got %v", diff)
+	}
+	if jobLists != 1 {
+		t.Errorf("Expected the jobs to be listed once per scan, got %d lists", jobLists)
+	}
+
+	jobLists = 0
+	if diff := unused(Opts{ScanJobTemplates: true, IgnoreCompletedJobPods: true, ClusterWideList: true}); !equalSlices(diff, []string{"configmap-3"}) {
+		t.Errorf("Expected the template of the completed job not to keep configmap-3 in use with cluster-wide lists, got %v", diff)
+	}
+	if jobLists != 1 {
+		t.Errorf("Expected the jobs of namespaces to be served from the cluster-wide list, got %d lists", jobLists)
+	}
+}
+
+func TestGetUnusedConfigmapsFlatJSON(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	cluster := createClusterIdentityNamespace(t, clientset)
+	if _, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "namespace-2"}}, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating namespace namespace-2: %v", err)
+	}
+	for _, name := range []string{"configmap-1", "configmap-2"} {
+		if _, err := clientset.CoreV1().ConfigMaps("namespace-2").Create(context.TODO(), CreateTestConfigmap("namespace-2", name), metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{FlatJSON: true, Canonical: true})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	var actualOutput []FlatFinding
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+	expectedOutput := []FlatFinding{
+		{Namespace: "namespace-2", Kind: "ConfigMap", Name: "configmap-1", FindingID: FindingID(cluster, "namespace-2", "ConfigMap", "configmap-1")},
+		{Namespace: "namespace-2", Kind: "ConfigMap", Name: "configmap-2", FindingID: FindingID(cluster, "namespace-2", "ConfigMap", "configmap-2")},
+		{Namespace: testNamespace, Kind: "ConfigMap", Name: "configmap-3", FindingID: FindingID(cluster, testNamespace, "ConfigMap", "configmap-3")},
+	}
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		t.Errorf("Expected output %v, got %v", expectedOutput, actualOutput)
+	}
+}
+
+func TestGetUnusedConfigmapsNoNamespacesMatched(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	includeExcludeLists := IncludeExcludeLists{ExcludeListStr: testNamespace}
+	_, warnings, err := GetUnusedConfigmapsWithWarnings(includeExcludeLists, &FilterOptions{}, clientset, "json", Opts{})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmapsWithWarnings: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "no namespaces matched") {
+		t.Errorf("Expected a warning that the namespace filters matched nothing, got %v", warnings)
+	}
+
+	_, warnings, err = GetUnusedConfigmapsWithWarnings(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmapsWithWarnings: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("Expected no warnings when namespaces are scanned, got %v", warnings)
+	}
+}
+
+func TestGetUnusedConfigmapsIncludeUsed(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{IncludeUsed: true})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	expectedOutput := map[string]map[string][]string{
+		testNamespace: {
+			"ConfigMap": {"configmap-3"},
+			"used":      {"configmap-1", "configmap-2"},
+		},
+	}
+
+	var actualOutput map[string]map[string][]string
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		t.Errorf("Expected output %v, got %v", expectedOutput, actualOutput)
+	}
+
+	tableOutput, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "table", Opts{IncludeUsed: true})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+	if !strings.Contains(tableOutput, "Used Configmaps in Namespace: "+testNamespace) {
+		t.Errorf("Expected used configmaps in table output, got %s", tableOutput)
+	}
+}
+
+func TestRetrieveUsedCMOptionalProjectedSource(t *testing.T) {
+	optional := true
+	pod := CreateTestPod(testNamespace, "pod-1", "", []corev1.Volume{
+		{Name: "vol-1", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+			{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "optional-config"}, Optional: &optional}},
+		}}}},
+	})
+	lister := &staticResourceLister{
+		pods:       []corev1.Pod{*pod},
+		configmaps: []corev1.ConfigMap{*CreateTestConfigmap(testNamespace, "optional-config")},
+	}
+
+	diff, err := ProcessNamespaceConfigmaps(lister, testNamespace, &FilterOptions{})
+	if err != nil {
+		t.Fatalf("Error processing namespace CM: %v", err)
+	}
+	if len(diff) != 0 {
+		t.Errorf("Expected the existing optional projected configmap to be used, got %v", diff)
+	}
+}
+
+func TestRetrieveUsedCMProjectedVolumeWithoutConfigMaps(t *testing.T) {
+	expirationSeconds := int64(3600)
+	pod := CreateTestPod(testNamespace, "pod-1", "", []corev1.Volume{
+		{Name: "vol-1", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+			{ServiceAccountToken: &corev1.ServiceAccountTokenProjection{Path: "token", ExpirationSeconds: &expirationSeconds}},
+			{DownwardAPI: &corev1.DownwardAPIProjection{Items: []corev1.DownwardAPIVolumeFile{
+				{Path: "labels", FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.labels"}},
+			}}},
+		}}}},
+	})
+	lister := &staticResourceLister{
+		pods:       []corev1.Pod{*pod},
+		configmaps: []corev1.ConfigMap{*CreateTestConfigmap(testNamespace, "unused-config")},
+	}
+
+	_, volumesProjectedCM, _, _, _, _, err := retrieveUsedCM(lister, testNamespace)
+	if err != nil {
+		t.Fatalf("Error retrieving used ConfigMaps: %v", err)
+	}
+	if len(volumesProjectedCM) != 0 {
+		t.Errorf("Expected no projected configmaps, got %v", volumesProjectedCM)
+	}
+
+	diff, err := ProcessNamespaceConfigmaps(lister, testNamespace, &FilterOptions{})
+	if err != nil {
+		t.Fatalf("Error processing namespace CM: %v", err)
+	}
+	if !reflect.DeepEqual(diff, []string{"unused-config"}) {
+		t.Errorf("Expected unused-config to be unused, got %v", diff)
+	}
+}
+
+func TestGetUnusedConfigmapsSameNameInSeveralNamespaces(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	for _, namespace := range []string{"ns-a", "ns-b"} {
+		if _, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating namespace %s: %v", namespace, err)
+		}
+		if _, err := clientset.CoreV1().ConfigMaps(namespace).Create(context.TODO(), CreateTestConfigmap(namespace, "shared-config"), metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+	pod := CreateTestPod("ns-a", "pod-1", "", []corev1.Volume{
+		{Name: "vol-1", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "shared-config"}}}},
+	})
+	if _, err := clientset.CoreV1().Pods("ns-a").Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake pod: %v", err)
+	}
+
+	expectedOutput := map[string]map[string][]string{
+		"ns-a": {"ConfigMap": nil},
+		"ns-b": {"ConfigMap": {"shared-config"}},
+	}
+	for _, opts := range []Opts{{}, {ClusterWideList: true}} {
+		output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+		if err != nil {
+			t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+		}
+		var actualOutput map[string]map[string][]string
+		if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+			t.Fatalf("Error unmarshaling actual output: %v", err)
+		}
+		if !reflect.DeepEqual(expectedOutput, actualOutput) {
+			t.Errorf("Expected only the orphan in ns-b to be reported with %+v, got %v", opts, actualOutput)
+		}
+	}
+}
+
+func TestGetUnusedConfigmapsSameConfigMapInSeveralVolumes(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	if _, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace}}, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating namespace %s: %v", testNamespace, err)
+	}
+	for _, name := range []string{"shared-config", "unused-config"} {
+		if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), CreateTestConfigmap(testNamespace, name), metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+
+	shared := corev1.LocalObjectReference{Name: "shared-config"}
+	pod := CreateTestPod(testNamespace, "pod-1", "", []corev1.Volume{
+		{Name: "vol-1", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: shared}}},
+		{Name: "vol-2", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: shared}}},
+		{Name: "vol-3", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+			{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: shared}},
+		}}}},
+	})
+	if _, err := clientset.CoreV1().Pods(testNamespace).Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake pod: %v", err)
+	}
+
+	volumesCM, volumesProjectedCM, _, _, _, _, err := retrieveUsedCM(NewResourceLister(clientset), testNamespace)
+	if err != nil {
+		t.Fatalf("Error retrieving used ConfigMaps: %v", err)
+	}
+	if count := countOccurrences(volumesCM, "shared-config"); count != 2 {
+		t.Errorf("Expected both volumes backed by shared-config to be collected, got %v", volumesCM)
+	}
+	if !reflect.DeepEqual(volumesProjectedCM, []string{"shared-config"}) {
+		t.Errorf("Expected the projected volume source to be collected, got %v", volumesProjectedCM)
+	}
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{IncludeUsed: true})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	expectedOutput := map[string]map[string][]string{
+		testNamespace: {
+			"ConfigMap": {"unused-config"},
+			"used":      {"shared-config"},
+		},
+	}
+	var actualOutput map[string]map[string][]string
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		t.Errorf("Expected output %v, got %v", expectedOutput, actualOutput)
+	}
+}
+
+func TestGetUnusedConfigmapsSubPathExprEnvVar(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), CreateTestConfigmap(testNamespace, "subpath-config"), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake configmap: %v", err)
+	}
+
+	// subpath-config only provides the environment the subPathExpr of the volume mount is expanded with
+	pod := CreateTestPod(testNamespace, "pod-subpath", "", []corev1.Volume{
+		{Name: "data", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+	})
+	pod.Spec.Containers = []corev1.Container{
+		{
+			Env: []corev1.EnvVar{
+				{Name: "TENANT", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "subpath-config"}, Key: "tenant"}}},
+			},
+			VolumeMounts: []corev1.VolumeMount{
+				{Name: "data", MountPath: "/data", SubPathExpr: "$(TENANT)"},
+			},
+		},
+	}
+	if _, err := clientset.CoreV1().Pods(testNamespace).Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake pod: %v", err)
+	}
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{NoInteractive: true})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	var actualOutput map[string]map[string][]string
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+	expected := []string{"configmap-3"}
+	if !reflect.DeepEqual(actualOutput[testNamespace]["ConfigMap"], expected) {
+		t.Errorf("Expected subpath-config to be used, got unused %v", actualOutput[testNamespace]["ConfigMap"])
+	}
+}
+
+func TestGetUnusedConfigmapsMirrorPod(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	if _, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}}, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating namespace kube-system: %v", err)
+	}
+	for _, name := range []string{"scheduler-config", "unused-config"} {
+		if _, err := clientset.CoreV1().ConfigMaps("kube-system").Create(context.TODO(), CreateTestConfigmap("kube-system", name), metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+
+	// the apiserver creates a mirror pod for each static pod, such as the scheduler of a self-managed cluster
+	pod := CreateTestPod("kube-system", "kube-scheduler-node-1", "", []corev1.Volume{
+		{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "scheduler-config"}}}},
+	})
+	pod.Annotations = map[string]string{corev1.MirrorPodAnnotationKey: "checksum"}
+	if _, err := clientset.CoreV1().Pods("kube-system").Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake pod: %v", err)
+	}
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{IncludeListStr: "kube-system"}, &FilterOptions{}, clientset, "json", Opts{IncludeUsed: true})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	expectedOutput := map[string]map[string][]string{
+		"kube-system": {
+			"ConfigMap": {"unused-config"},
+			"used":      {"scheduler-config"},
+		},
+	}
+	var actualOutput map[string]map[string][]string
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		t.Errorf("Expected output %v, got %v", expectedOutput, actualOutput)
+	}
+}
+
+func TestGetUnusedConfigmapsNativeSidecar(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	namespace := "sidecar-namespace"
+	if _, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating namespace %s: %v", namespace, err)
+	}
+	for _, name := range []string{"sidecar-env", "sidecar-key", "sidecar-volume", "unused-config"} {
+		if _, err := clientset.CoreV1().ConfigMaps(namespace).Create(context.TODO(), CreateTestConfigmap(namespace, name), metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+
+	pod := CreateTestPod(namespace, "pod-with-sidecar", "", []corev1.Volume{
+		{Name: "proxy-config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "sidecar-volume"}}}},
+	})
+	restartPolicy := corev1.ContainerRestartPolicyAlways
+	pod.Spec.Containers = []corev1.Container{{Name: "app", Image: "app"}}
+	pod.Spec.InitContainers = []corev1.Container{
+		{
+			Name:          "proxy",
+			Image:         "proxy",
+			RestartPolicy: &restartPolicy,
+			EnvFrom: []corev1.EnvFromSource{
+				{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "sidecar-env"}}},
+			},
+			Env: []corev1.EnvVar{
+				{Name: "PROXY_MODE", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "sidecar-key"},
+					Key:                  "mode",
+				}}},
+			},
+			VolumeMounts: []corev1.VolumeMount{{Name: "proxy-config", MountPath: "/etc/proxy"}},
+		},
+	}
+	if _, err := clientset.CoreV1().Pods(namespace).Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake pod: %v", err)
+	}
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{IncludeListStr: namespace}, &FilterOptions{}, clientset, "json", Opts{IncludeUsed: true})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	var actualOutput map[string]map[string][]string
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+	sort.Strings(actualOutput[namespace]["used"])
+	expectedOutput := map[string]map[string][]string{
+		namespace: {
+			"ConfigMap": {"unused-config"},
+			"used":      {"sidecar-env", "sidecar-key", "sidecar-volume"},
+		},
+	}
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		t.Errorf("Expected output %v, got %v", expectedOutput, actualOutput)
+	}
+}
+
+func TestRetrieveUsedCMEnvFromPrefix(t *testing.T) {
+	pod := CreateTestPod(testNamespace, "pod-1", "", nil)
+	pod.Spec.Containers = []corev1.Container{
+		{
+			EnvFrom: []corev1.EnvFromSource{
+				{Prefix: "APP_", ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "prefixed-config"}}},
+			},
+		},
+	}
+
+	_, _, _, envFromCM, _, _, err := retrieveUsedCM(&staticResourceLister{pods: []corev1.Pod{*pod}}, testNamespace)
+	if err != nil {
+		t.Fatalf("Error retrieving used ConfigMaps: %v", err)
+	}
+	if !reflect.DeepEqual(envFromCM, []string{"prefixed-config"}) {
+		t.Errorf("Expected the prefixed envFrom reference to be detected, got %v", envFromCM)
+	}
+}
+
+func TestRetrieveUsedCMEnvFromSecretRef(t *testing.T) {
+	pod := CreateTestPod(testNamespace, "pod-1", "", nil)
+	secretRef := corev1.EnvFromSource{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "secret-1"}}}
+	pod.Spec.Containers = []corev1.Container{{EnvFrom: []corev1.EnvFromSource{secretRef}}}
+	pod.Spec.InitContainers = []corev1.Container{{EnvFrom: []corev1.EnvFromSource{secretRef}}}
+	pod.Spec.EphemeralContainers = []corev1.EphemeralContainer{
+		{EphemeralContainerCommon: corev1.EphemeralContainerCommon{EnvFrom: []corev1.EnvFromSource{secretRef}}},
+	}
+
+	volumesCM, volumesProjectedCM, envCM, envFromCM, envFromContainerCM, envFromInitContainerCM, err := retrieveUsedCM(&staticResourceLister{pods: []corev1.Pod{*pod}}, testNamespace)
+	if err != nil {
+		t.Fatalf("Error retrieving used ConfigMaps: %v", err)
+	}
+	for _, used := range [][]string{volumesProjectedCM, envCM, envFromCM, envFromContainerCM, envFromInitContainerCM} {
+		if len(used) != 0 {
+			t.Errorf("Expected secret-only envFrom entries to be skipped, got %v", used)
+		}
+	}
+	if !reflect.DeepEqual(volumesCM, []string{"kube-root-ca.crt"}) {
+		t.Errorf("Expected only the configmap exceptions to be used, got %v", volumesCM)
+	}
+}
+
+func countOccurrences(names []string, name string) int {
+	count := 0
+	for _, n := range names {
+		if n == name {
+			count++
+		}
+	}
+	return count
+}
+
+func TestGetUnusedConfigmapsCrossNamespaceNameCollision(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+
+	for _, namespace := range []string{"namespace-a", "namespace-b"} {
+		_, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: namespace},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatalf("Error creating namespace %s: %v", namespace, err)
+		}
+		_, err = clientset.CoreV1().ConfigMaps(namespace).Create(context.TODO(), CreateTestConfigmap(namespace, "shared-config"), metav1.CreateOptions{})
+		if err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+
+	pod := CreateTestPod("namespace-a", "pod-1", "", []corev1.Volume{
+		{Name: "vol-1", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "shared-config"}}}},
+	})
+	_, err := clientset.CoreV1().Pods("namespace-a").Create(context.TODO(), pod, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Error creating fake pod: %v", err)
+	}
+
+	expectedOutput := map[string]map[string][]string{
+		"namespace-a": {"ConfigMap": nil},
+		"namespace-b": {"ConfigMap": {"shared-config"}},
+	}
+
+	for _, opts := range []Opts{{}, {ClusterWideList: true}} {
+		output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+		if err != nil {
+			t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+		}
+
+		var actualOutput map[string]map[string][]string
+		if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+			t.Fatalf("Error unmarshaling actual output: %v", err)
+		}
+
+		if !reflect.DeepEqual(expectedOutput, actualOutput) {
+			t.Errorf("Expected a reference in namespace-a not to protect namespace-b's configmap (cluster-wide list: %t), got %v", opts.ClusterWideList, actualOutput)
+		}
+	}
+}
+
+func TestGetUnusedConfigmapsCanonical(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+
+	for _, namespace := range []string{"namespace-c", "namespace-a", "namespace-b", "namespace-e", "namespace-d"} {
+		_, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: namespace},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatalf("Error creating namespace %s: %v", namespace, err)
+		}
+		for _, name := range []string{"configmap-b", "configmap-a"} {
+			_, err = clientset.CoreV1().ConfigMaps(namespace).Create(context.TODO(), CreateTestConfigmap(namespace, name), metav1.CreateOptions{})
+			if err != nil {
+				t.Fatalf("Error creating fake configmap: %v", err)
+			}
+		}
+	}
+
+	for _, outputFormat := range []string{"table", "json", "yaml"} {
+		first, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, outputFormat, Opts{Canonical: true})
+		if err != nil {
+			t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+		}
+		second, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, outputFormat, Opts{Canonical: true})
+		if err != nil {
+			t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+		}
+
+		if first != second {
+			t.Errorf("Expected identical %s output for identical cluster state, got:\n%s\nand:\n%s", outputFormat, first, second)
+		}
+		if strings.Index(first, "namespace-a") > strings.Index(first, "namespace-b") {
+			t.Errorf("Expected namespaces to be sorted in %s output, got:\n%s", outputFormat, first)
+		}
+	}
+}
+
+func TestGetUnusedConfigmapsReferenceAnnotationKeys(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	for _, name := range []string{"configmap-4", "configmap-5"} {
+		_, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), CreateTestConfigmap(testNamespace, name), metav1.CreateOptions{})
+		if err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+
+	pod := CreateTestPod(testNamespace, "pod-5", "", nil)
+	pod.Annotations = map[string]string{"example.com/configmaps": "configmap-3, configmap-missing"}
+	_, err := clientset.CoreV1().Pods(testNamespace).Create(context.TODO(), pod, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Error creating fake pod: %v", err)
+	}
+
+	configmap := CreateTestConfigmap(testNamespace, "configmap-6")
+	configmap.Annotations = map[string]string{"example.com/references": "configmap-4"}
+	_, err = clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), configmap, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Error creating fake configmap: %v", err)
+	}
+
+	opts := Opts{ReferenceAnnotationKeys: []string{"example.com/configmaps", "example.com/references"}}
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	var actualOutput map[string]map[string][]string
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+
+	expected := []string{"configmap-5", "configmap-6"}
+	if !equalSlices(actualOutput[testNamespace]["ConfigMap"], expected) {
+		t.Errorf("Expected unused configmaps %v, got %v", expected, actualOutput[testNamespace]["ConfigMap"])
+	}
+}
+
+func TestGetUnusedConfigmapsScanWorkloadAnnotations(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	deployment := CreateTestDeployment(testNamespace, "operator-managed", 1, nil)
+	deployment.Annotations = map[string]string{"example.com/configmaps": "configmap-3"}
+	if _, err := clientset.AppsV1().Deployments(testNamespace).Create(context.TODO(), deployment, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake deployment: %v", err)
+	}
+
+	opts := Opts{ReferenceAnnotationKeys: []string{"example.com/configmaps"}}
+	scan := func(opts Opts) []string {
+		output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+		if err != nil {
+			t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+		}
+		var actualOutput map[string]map[string][]string
+		if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+			t.Fatalf("Error unmarshaling actual output: %v", err)
+		}
+		return actualOutput[testNamespace]["ConfigMap"]
+	}
+
+	if unused := scan(opts); !reflect.DeepEqual(unused, []string{"configmap-3"}) {
+		t.Errorf("Expected workload annotations to be ignored by default, got %v", unused)
+	}
+	opts.ScanWorkloadAnnotations = true
+	if unused := scan(opts); len(unused) != 0 {
+		t.Errorf("Expected configmap-3 to be used by the deployment annotation, got %v", unused)
+	}
+
+	pods, err := newConfigMapScanLister(clientset, &FilterOptions{}, opts).ListPods(context.TODO(), testNamespace, metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Error listing pods: %v", err)
+	}
+	for _, pod := range pods.Items {
+		if pod.Name == "operator-managed" {
+			t.Errorf("Expected the workloads not to be listed as pods, got %v", pod.ObjectMeta)
+		}
+	}
+}
+
+func TestGetUnusedConfigmapsReportStaleExceptions(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	_, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-system"},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Error creating namespace kube-system: %v", err)
+	}
+	_, err = clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), CreateTestConfigmap(testNamespace, "kube-root-ca.crt"), metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Error creating fake configmap: %v", err)
+	}
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{ReportStaleExceptions: true})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	var actualOutput struct {
+		StaleExceptions []ExceptionResource `json:"staleExceptions"`
+	}
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+
+	expected := []ExceptionResource{{ResourceName: "aws-auth", Namespace: "kube-system"}}
+	if !reflect.DeepEqual(actualOutput.StaleExceptions, expected) {
+		t.Errorf("Expected stale exceptions %v, got %v", expected, actualOutput.StaleExceptions)
+	}
+}
+
+func TestGetUnusedConfigmapsReportProtected(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	rootCA := CreateTestConfigmap(testNamespace, "kube-root-ca.crt")
+	labeled := CreateTestConfigmap(testNamespace, "labeled-config")
+	labeled.Labels = map[string]string{"kor/used": "true"}
+	certs := CreateTestConfigmap(testNamespace, "certs-config")
+	certs.Data = map[string]string{"tls.crt": "certificate"}
+	inventoried := CreateTestConfigmap(testNamespace, "inventoried-config")
+	annotated := CreateTestConfigmap(testNamespace, "annotated-config")
+	annotated.Annotations = map[string]string{"lifecycle/keep": "true"}
+	for _, configmap := range []*corev1.ConfigMap{rootCA, labeled, certs, inventoried, annotated} {
+		if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), configmap, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+
+	opts := Opts{
+		ReportProtected: true,
+		UsedPredicate: func(meta metav1.ObjectMeta) (bool, string) {
+			return meta.Name == "inventoried-config", "listed in the inventory"
+		},
+	}
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{ProtectedDataKeys: []string{"*.crt"}, ExcludeAnnotations: "lifecycle/keep"}, clientset, "json", opts)
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	var actualOutput struct {
+		Protected []ProtectedResource `json:"protected"`
+	}
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+
+	sources := make(map[string]string)
+	for _, resource := range actualOutput.Protected {
+		sources[resource.ResourceName] = resource.Source
+	}
+	expected := map[string]string{
+		"kube-root-ca.crt":   "built-in exception",
+		"labeled-config":     "label",
+		"certs-config":       "glob",
+		"inventoried-config": "custom exception",
+		"annotated-config":   "annotation",
+	}
+	if !reflect.DeepEqual(sources, expected) {
+		t.Errorf("Expected protection sources %v, got %v", expected, sources)
+	}
+	for _, resource := range actualOutput.Protected {
+		if expectedReason := map[string]string{"inventoried-config": "listed in the inventory"}[resource.ResourceName]; resource.Reason != expectedReason {
+			t.Errorf("Expected the reason of %s to be %q, got %q", resource.ResourceName, expectedReason, resource.Reason)
+		}
+	}
+}
+
+func TestStaleExceptions(t *testing.T) {
+	exceptions := []ExceptionResource{
+		{ResourceName: "aws-auth", Namespace: "kube-system"},
+		{ResourceName: "kube-root-ca.crt", Namespace: "*"},
+		{ResourceName: "missing", Namespace: "*"},
+		{ResourceName: "unscanned", Namespace: "other-namespace"},
+	}
+	scannedConfigMaps := map[string][]string{
+		"kube-system": {"aws-auth"},
+		testNamespace: {"kube-root-ca.crt"},
+	}
+
+	expected := []ExceptionResource{{ResourceName: "missing", Namespace: "*"}}
+	if stale := staleExceptions(exceptions, scannedConfigMaps); !reflect.DeepEqual(stale, expected) {
+		t.Errorf("Expected stale exceptions %v, got %v", expected, stale)
+	}
+}
+
+func TestValidateExceptions(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	for _, configmap := range []*corev1.ConfigMap{
+		CreateTestConfigmap("kube-system", "aws-auth"),
+		CreateTestConfigmap(testNamespace, "kube-root-ca.crt"),
+		CreateTestConfigmap(testNamespace, "moved"),
+	} {
+		if _, err := clientset.CoreV1().ConfigMaps(configmap.Namespace).Create(context.TODO(), configmap, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+
+	exceptions := []ExceptionResource{
+		{ResourceName: "aws-auth", Namespace: "kube-system"},
+		{ResourceName: "kube-root-ca.crt", Namespace: "*"},
+		{ResourceName: "missing", Namespace: "*"},
+		{ResourceName: "moved", Namespace: "kube-system"},
+	}
+	expected := []ExceptionResource{
+		{ResourceName: "missing", Namespace: "*"},
+		{ResourceName: "moved", Namespace: "kube-system"},
+	}
+	stale, err := validateExceptions(clientset, exceptions)
+	if err != nil {
+		t.Fatalf("Error validating exceptions: %v", err)
+	}
+	if !reflect.DeepEqual(stale, expected) {
+		t.Errorf("Expected stale exceptions %v, got %v", expected, stale)
+	}
+
+	if stale, err := ValidateExceptions(clientset); err != nil || len(stale) != 0 {
+		t.Errorf("Expected the built-in exceptions to be valid, got %v, %v", stale, err)
+	}
+}
+
+func TestRetrieveConfigMapNamesMinDataBytes(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	large := CreateTestConfigmap(testNamespace, "configmap-large")
+	large.Data = map[string]string{"config.yaml": strings.Repeat("a", 2048)}
+	small := CreateTestConfigmap(testNamespace, "configmap-small")
+	small.Data = map[string]string{"key": "value"}
+	for _, configmap := range []*corev1.ConfigMap{large, small} {
+		if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), configmap, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+
+	diff, err := processNamespaceCM(clientset, testNamespace, &FilterOptions{MinDataBytes: 1024})
+	if err != nil {
+		t.Fatalf("Error processing namespace CM: %v", err)
+	}
+
+	expected := []string{"configmap-large"}
+	if !equalSlices(diff, expected) {
+		t.Errorf("Expected diff %v, got %v", expected, diff)
+	}
+}
+
+func TestGetUnusedConfigmapsProtectedDataKeys(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	withCA := CreateTestConfigmap(testNamespace, "configmap-ca")
+	withCA.Data = map[string]string{"ca.crt": "certificate"}
+	withPEM := CreateTestConfigmap(testNamespace, "configmap-pem")
+	withPEM.BinaryData = map[string][]byte{"server.pem": []byte("certificate")}
+	for _, configmap := range []*corev1.ConfigMap{withCA, withPEM} {
+		if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), configmap, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+
+	filterOpts := &FilterOptions{ProtectedDataKeys: []string{"ca.crt"}}
+	if err := filterOpts.Validate(); err != nil {
+		t.Fatalf("Error validating filter options: %v", err)
+	}
+	diff, err := processNamespaceCM(clientset, testNamespace, filterOpts)
+	if err != nil {
+		t.Fatalf("Error processing namespace CM: %v", err)
+	}
+
+	expected := []string{"configmap-3", "configmap-pem"}
+	if !equalSlices(diff, expected) {
+		t.Errorf("Expected diff %v, got %v", expected, diff)
+	}
+
+	diff, err = processNamespaceCM(clientset, testNamespace, &FilterOptions{ProtectedDataKeys: []string{"ca.crt", "*.pem"}})
+	if err != nil {
+		t.Fatalf("Error processing namespace CM: %v", err)
+	}
+	if !equalSlices(diff, []string{"configmap-3"}) {
+		t.Errorf("Expected configmaps with protected keys not to be unused, got %v", diff)
+	}
+
+	if err := (&FilterOptions{ProtectedDataKeys: []string{"[ca"}}).Validate(); err == nil {
+		t.Error("Expected an error for an invalid protected data key pattern")
+	}
+}
+
+func TestGetUnusedConfigmapsUsedPredicate(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), CreateTestConfigmap(testNamespace, "configmap-inventory"), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake configmap: %v", err)
+	}
+
+	var consulted []string
+	opts := Opts{
+		NoInteractive:       true,
+		IncludeScanMetadata: true,
+		UsedPredicate: func(meta metav1.ObjectMeta) (bool, string) {
+			consulted = append(consulted, meta.Name)
+			return meta.Name == "configmap-inventory", "listed in the inventory"
+		},
+	}
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	var actualOutput unusedResourceEnvelope
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+	expectedOutput := map[string]interface{}{
+		testNamespace: map[string]interface{}{"ConfigMap": []interface{}{"configmap-3"}},
+	}
+	if !reflect.DeepEqual(actualOutput.Namespaces, expectedOutput) {
+		t.Errorf("Expected the configmap kept by the predicate not to be reported, got %v", actualOutput.Namespaces)
+	}
+	if !equalSlices(consulted, []string{"configmap-1", "configmap-2", "configmap-3", "configmap-inventory"}) {
+		t.Errorf("Expected the predicate to be consulted for every candidate, got %v", consulted)
+	}
+}
+
+func TestRetrieveConfigMapNamesHasDataKey(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	withKey := CreateTestConfigmap(testNamespace, "configmap-tls")
+	withKey.Data = map[string]string{"tls.crt": "certificate"}
+	withBinaryKey := CreateTestConfigmap(testNamespace, "configmap-tls-binary")
+	withBinaryKey.BinaryData = map[string][]byte{"tls.crt": []byte("certificate")}
+	withoutKey := CreateTestConfigmap(testNamespace, "configmap-settings")
+	withoutKey.Data = map[string]string{"settings.yaml": "key: value"}
+	for _, configmap := range []*corev1.ConfigMap{withKey, withBinaryKey, withoutKey} {
+		if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), configmap, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+
+	diff, err := processNamespaceCM(clientset, testNamespace, &FilterOptions{HasDataKey: "tls.crt"})
+	if err != nil {
+		t.Fatalf("Error processing namespace CM: %v", err)
+	}
+
+	expected := []string{"configmap-tls", "configmap-tls-binary"}
+	if !equalSlices(diff, expected) {
+		t.Errorf("Expected diff %v, got %v", expected, diff)
+	}
+}
+
+func TestRetrieveConfigMapNamesDeduplicatesByUID(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+
+	duplicate := CreateTestConfigmap(testNamespace, "configmap-1")
+	duplicate.UID = "uid-1"
+	other := CreateTestConfigmap(testNamespace, "configmap-2")
+	other.UID = "uid-2"
+	clientset.PrependReactor("list", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &corev1.ConfigMapList{Items: []corev1.ConfigMap{*duplicate, *other, *duplicate}}, nil
+	})
+
+	names, err := retrieveConfigMapNames(NewResourceLister(clientset), testNamespace, &FilterOptions{}, nil)
+	if err != nil {
+		t.Fatalf("Error retrieving configmap names: %v", err)
+	}
+
+	expected := []string{"configmap-1", "configmap-2"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected a configmap listed twice to be counted once, got %v", names)
+	}
+}
+
+func TestGetUnusedConfigmapsExcludesResultConfigMap(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	result := CreateTestConfigmap(testNamespace, "kor-results")
+	result.Labels = map[string]string{ResultConfigMapLabel: "true"}
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), result, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake configmap: %v", err)
+	}
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{NoInteractive: true})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	var actualOutput map[string]map[string][]string
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+	expected := []string{"configmap-3"}
+	if !reflect.DeepEqual(actualOutput[testNamespace]["ConfigMap"], expected) {
+		t.Errorf("Expected the result configmap not to be reported, got %v", actualOutput[testNamespace]["ConfigMap"])
+	}
+}
+
+func TestGetUnusedConfigmapsLogOutput(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	var logOutput bytes.Buffer
+	opts := Opts{DeleteFlag: true, NoInteractive: true, LogOutput: &logOutput}
+
+	originalStdout, originalStderr := os.Stdout, os.Stderr
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Error creating pipe: %v", err)
+	}
+	os.Stdout, os.Stderr = writer, writer
+	_, err = GetUnusedConfigmaps(IncludeExcludeLists{IncludeListStr: testNamespace + ",missing-namespace"}, &FilterOptions{}, clientset, "json", opts)
+	os.Stdout, os.Stderr = originalStdout, originalStderr
+	writer.Close()
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+	written, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Error reading stdout and stderr: %v", err)
+	}
+	if len(written) != 0 {
+		t.Errorf("Expected no stdout or stderr output, got %q", written)
+	}
+
+	for _, expected := range []string{"namespace [missing-namespace] not found", "Deleting ConfigMap configmap-3 in namespace " + testNamespace} {
+		if !strings.Contains(logOutput.String(), expected) {
+			t.Errorf("Expected %q to be written to the log output, got %q", expected, logOutput.String())
+		}
+	}
+}
+
+func TestGetUnusedConfigmapsQuietErrors(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	clientset.PrependReactor("list", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "", errors.New("forbidden"))
+	})
+	opts := Opts{NoInteractive: true, QuietErrors: true}
+
+	originalStderr := os.Stderr
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Error creating pipe: %v", err)
+	}
+	os.Stderr = writer
+	_, err = GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+	os.Stderr = originalStderr
+	writer.Close()
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+	stderr, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Error reading stderr: %v", err)
+	}
+	if len(stderr) != 0 {
+		t.Errorf("Expected no stderr output, got %q", stderr)
+	}
+
+	_, warnings, err := GetUnusedConfigmapsWithWarnings(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmapsWithWarnings: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], testNamespace) {
+		t.Errorf("Expected the failed namespace to still be returned, got %v", warnings)
+	}
+}
+
+// slowResourceLister delays listing the pods of a single namespace until delay passes or ctx is done
+type slowResourceLister struct {
+	ResourceLister
+	namespace string
+	delay     time.Duration
+}
+
+func (l *slowResourceLister) ListPods(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.PodList, error) {
+	if namespace == l.namespace {
+		select {
+		case <-time.After(l.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return l.ResourceLister.ListPods(ctx, namespace, opts)
+}
+
+func TestScanNamespaceCMPerNamespaceTimeout(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	if _, err := clientset.CoreV1().ConfigMaps("slow").Create(context.TODO(), CreateTestConfigmap("slow", "configmap-1"), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake configmap: %v", err)
+	}
+	lister := &slowResourceLister{ResourceLister: NewResourceLister(clientset), namespace: "slow", delay: 200 * time.Millisecond}
+	opts := Opts{PerNamespaceTimeout: 20 * time.Millisecond}
+
+	scans := make(map[string]namespaceCMScan)
+	startedAt := time.Now()
+	for _, namespace := range []string{"slow", testNamespace} {
+		scans[namespace] = scanNamespaceCM(lister, nil, namespace, &FilterOptions{}, opts)
+	}
+	if elapsed := time.Since(startedAt); elapsed >= lister.delay {
+		t.Errorf("Expected the slow list to be cancelled at the deadline, the scans took %s", elapsed)
+	}
+
+	if !errors.Is(scans["slow"].err, context.DeadlineExceeded) {
+		t.Errorf("Expected the slow namespace to time out, got %v", scans["slow"].err)
+	}
+	if err := scans[testNamespace].err; err != nil {
+		t.Fatalf("Expected the other namespace to complete, got %v", err)
+	}
+	diff := CalculateResourceDifference(scans[testNamespace].used, scans[testNamespace].candidates.names)
+	if !reflect.DeepEqual(diff, []string{"configmap-3"}) {
+		t.Errorf("Expected configmap-3 to be unused in the other namespace, got %v", diff)
+	}
+}
+
+func TestGetUnusedConfigmapsScanJobTemplates(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	template := corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+		Volumes: []corev1.Volume{
+			{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "configmap-3"}}}},
+		},
+	}}
+	cronjob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "nightly-report", Namespace: testNamespace},
+		Spec:       batchv1.CronJobSpec{JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{Template: template}}},
+	}
+	if _, err := clientset.BatchV1().CronJobs(testNamespace).Create(context.TODO(), cronjob, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake cronjob: %v", err)
+	}
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+	if !strings.Contains(output, "configmap-3") {
+		t.Errorf("Expected configmap-3 to be unused without --scan-job-templates, got %s", output)
+	}
+
+	output, err = GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{ScanJobTemplates: true})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+	if strings.Contains(output, "configmap-3") {
+		t.Errorf("Expected configmap-3 referenced by the cronjob pod template to be used, got %s", output)
+	}
+}
+
+func TestRetrieveConfigMapNamesExcludeAnnotations(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	kept := CreateTestConfigmap(testNamespace, "configmap-kept")
+	kept.Annotations = map[string]string{"lifecycle/keep": "true"}
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), kept, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake configmap: %v", err)
+	}
+
+	diff, err := processNamespaceCM(clientset, testNamespace, &FilterOptions{ExcludeAnnotations: "lifecycle/keep"})
+	if err != nil {
+		t.Fatalf("Error processing namespace CM: %v", err)
+	}
+
+	expected := []string{"configmap-3"}
+	if !equalSlices(diff, expected) {
+		t.Errorf("Expected diff %v, got %v", expected, diff)
+	}
+}
+
+func TestGetUnusedConfigmapsTerminatingNamespace(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	deletionTimestamp := metav1.Now()
+	_, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "terminating", DeletionTimestamp: &deletionTimestamp},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Error creating namespace: %v", err)
+	}
+	if _, err := clientset.CoreV1().ConfigMaps("terminating").Create(context.TODO(), CreateTestConfigmap("terminating", "configmap-orphan"), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake configmap: %v", err)
+	}
+
+	var log bytes.Buffer
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{DeleteFlag: true, NoInteractive: true, LogOutput: &log})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	if strings.Contains(output, "terminating") {
+		t.Errorf("Expected the terminating namespace to be skipped, got %s", output)
+	}
+	if strings.Contains(log.String(), "terminating") {
+		t.Errorf("Expected the skipped namespace to only be printed with ExplainNamespaces, got %s", log.String())
+	}
+	if _, err := clientset.CoreV1().ConfigMaps("terminating").Get(context.TODO(), "configmap-orphan", metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected the configmap of the terminating namespace not to be deleted, got %v", err)
+	}
+
+	log.Reset()
+	if _, err := SetNamespaceList(IncludeExcludeLists{}, clientset, Opts{ExplainNamespaces: true, LogOutput: &log}); err != nil {
+		t.Fatalf("Error calling SetNamespaceList: %v", err)
+	}
+	if !strings.Contains(log.String(), "Namespace terminating excluded: terminating") {
+		t.Errorf("Expected the terminating namespace to be explained, got %s", log.String())
+	}
+}
+
+func TestGetUnusedConfigmapsOmitEmptyNamespaces(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	_, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "empty-namespace"},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Error creating namespace: %v", err)
+	}
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{OmitEmptyNamespaces: true})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	var envelope struct {
+		Totals     ScanTotals                     `json:"totals"`
+		Namespaces map[string]map[string][]string `json:"namespaces"`
+	}
+	if err := json.Unmarshal([]byte(output), &envelope); err != nil {
+		t.Fatalf("Error unmarshaling output: %v", err)
+	}
+	if _, ok := envelope.Namespaces["empty-namespace"]; ok {
+		t.Errorf("Expected empty-namespace to be omitted, got %s", output)
+	}
+	if _, ok := envelope.Namespaces[testNamespace]; !ok {
+		t.Errorf("Expected %s to be reported, got %s", testNamespace, output)
+	}
+	expectedTotals := ScanTotals{NamespacesScanned: 2, NamespacesWithFindings: 1, Unused: 1}
+	if envelope.Totals != expectedTotals {
+		t.Errorf("Expected totals %+v, got %+v", expectedTotals, envelope.Totals)
+	}
+
+	output, err = GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "table", Opts{OmitEmptyNamespaces: true})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+	if strings.Contains(output, "empty-namespace") {
+		t.Errorf("Expected empty-namespace to be omitted from table output, got %s", output)
+	}
+	if !strings.Contains(output, "Scanned 2 namespaces, 1 with unused ConfigMaps") {
+		t.Errorf("Expected totals in table output, got %s", output)
+	}
+}
+
+func TestGetUnusedConfigmapsNoTrailingBlankLine(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	_, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "second-namespace"},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Error creating namespace: %v", err)
+	}
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "table", Opts{})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+	if output != strings.TrimRight(output, " \t\n")+"\n" {
+		t.Errorf("Expected output to end with a single newline and no trailing blank line, got %q", output)
+	}
+}
+
+func TestWriteUnusedConfigmaps(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	for _, outputFormat := range []string{"table", "json", "yaml"} {
+		expected, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, outputFormat, Opts{Canonical: true})
+		if err != nil {
+			t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+		}
+
+		var buf bytes.Buffer
+		if err := WriteUnusedConfigmaps(&buf, IncludeExcludeLists{}, &FilterOptions{}, clientset, outputFormat, Opts{Canonical: true}); err != nil {
+			t.Fatalf("Error calling WriteUnusedConfigmaps: %v", err)
+		}
+		if buf.String() != expected {
+			t.Errorf("Expected %s output written to the writer to be %q, got %q", outputFormat, expected, buf.String())
+		}
+	}
+}
+
+func TestGetUnusedConfigmapsDeleteSelector(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	ephemeral := CreateTestConfigmap(testNamespace, "configmap-ephemeral")
+	ephemeral.Labels = map[string]string{"env": "ephemeral"}
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), ephemeral, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake configmap: %v", err)
+	}
+
+	opts := Opts{DeleteFlag: true, NoInteractive: true, DeleteSelector: "env=ephemeral"}
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Get(context.TODO(), "configmap-ephemeral", metav1.GetOptions{}); err == nil {
+		t.Error("Expected the selected configmap-ephemeral to be deleted")
+	}
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Get(context.TODO(), "configmap-3", metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected configmap-3 not matching the selector to be kept, got %v", err)
+	}
+
+	var response map[string]map[string][]string
+	if err := json.Unmarshal([]byte(output), &response); err != nil {
+		t.Fatalf("Error unmarshaling output: %v", err)
+	}
+	expected := []string{"configmap-ephemeral-DELETED", "configmap-3"}
+	if !equalSlices(response[testNamespace]["ConfigMap"], expected) {
+		t.Errorf("Expected %v, got %v", expected, response[testNamespace]["ConfigMap"])
+	}
+}
+
+func TestGetUnusedConfigmapsWithWarningsForbiddenNamespace(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	_, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "restricted"},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Error creating namespace: %v", err)
+	}
+	clientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetNamespace() != "restricted" {
+			return false, nil, nil
+		}
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", errors.New("access denied"))
+	})
+
+	output, warnings, err := GetUnusedConfigmapsWithWarnings(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{})
+	if err != nil {
+		t.Fatalf("Expected a forbidden namespace not to fail the scan, got %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "restricted") || !strings.Contains(warnings[0], "forbidden") {
+		t.Errorf("Expected a warning for the restricted namespace, got %v", warnings)
+	}
+	if !strings.Contains(output, "configmap-3") {
+		t.Errorf("Expected the other namespaces to be scanned, got %s", output)
+	}
+}
+
 func init() {
 	scheme.Scheme = runtime.NewScheme()
 	_ = appsv1.AddToScheme(scheme.Scheme)
 }
+
+type staticResourceLister struct {
+	pods       []corev1.Pod
+	configmaps []corev1.ConfigMap
+}
+
+func (l *staticResourceLister) ListPods(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.PodList, error) {
+	return &corev1.PodList{Items: l.pods}, nil
+}
+
+func (l *staticResourceLister) ListConfigMaps(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.ConfigMapList, error) {
+	return &corev1.ConfigMapList{Items: l.configmaps}, nil
+}
+
+func TestGetUnusedConfigmapsConcurrency(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+
+	for i := 0; i < 12; i++ {
+		namespace := fmt.Sprintf("namespace-%02d", i)
+		_, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: namespace},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatalf("Error creating namespace %s: %v", namespace, err)
+		}
+		for _, name := range []string{"configmap-b", "configmap-a"} {
+			_, err = clientset.CoreV1().ConfigMaps(namespace).Create(context.TODO(), CreateTestConfigmap(namespace, name), metav1.CreateOptions{})
+			if err != nil {
+				t.Fatalf("Error creating fake configmap: %v", err)
+			}
+		}
+	}
+
+	for _, clusterWideList := range []bool{false, true} {
+		for _, outputFormat := range []string{"table", "json"} {
+			expected, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, outputFormat, Opts{Canonical: true, ClusterWideList: clusterWideList})
+			if err != nil {
+				t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+			}
+			parallel, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, outputFormat, Opts{Canonical: true, ClusterWideList: clusterWideList, Concurrency: 4})
+			if err != nil {
+				t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+			}
+
+			if parallel != expected {
+				t.Errorf("Expected parallel %s output to match the sequential output, got:\n%s\nwant:\n%s", outputFormat, parallel, expected)
+			}
+
+			auto, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, outputFormat, Opts{Canonical: true, ClusterWideList: clusterWideList, AutoConcurrency: true})
+			if err != nil {
+				t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+			}
+			if auto != expected {
+				t.Errorf("Expected auto concurrency %s output to match the sequential output, got:\n%s\nwant:\n%s", outputFormat, auto, expected)
+			}
+		}
+	}
+}
+
+func TestGetUnusedConfigmapsCustomResource(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, CustomResourceOutputFormat, Opts{})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	var report struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+		Metadata   struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Spec struct {
+			Items []map[string]string `json:"items"`
+		} `json:"spec"`
+	}
+	if err := yaml.Unmarshal([]byte(output), &report); err != nil {
+		t.Fatalf("Error unmarshaling custom resource: %v", err)
+	}
+
+	if report.APIVersion != "kor.yonahd.io/v1alpha1" || report.Kind != "OrphanReport" || report.Metadata.Name != "kor-configmaps" {
+		t.Errorf("Unexpected custom resource header: %s/%s %s", report.APIVersion, report.Kind, report.Metadata.Name)
+	}
+	expectedItems := []map[string]string{
+		{"kind": "ConfigMap", "namespace": testNamespace, "name": "configmap-3"},
+	}
+	if !reflect.DeepEqual(report.Spec.Items, expectedItems) {
+		t.Errorf("Expected spec.items %v, got %v", expectedItems, report.Spec.Items)
+	}
+}
+
+type failingResourceLister struct {
+	podsErr       error
+	configmapsErr error
+}
+
+func (l *failingResourceLister) ListPods(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.PodList, error) {
+	return &corev1.PodList{}, l.podsErr
+}
+
+func (l *failingResourceLister) ListConfigMaps(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.ConfigMapList, error) {
+	return &corev1.ConfigMapList{}, l.configmapsErr
+}
+
+func TestProcessNamespaceConfigmapsListErrors(t *testing.T) {
+	cause := errors.New("connection refused")
+
+	_, err := ProcessNamespaceConfigmaps(&failingResourceLister{podsErr: cause}, testNamespace, &FilterOptions{})
+	if !errors.Is(err, ErrListPods) || !errors.Is(err, cause) {
+		t.Errorf("Expected ErrListPods wrapping the cause, got %v", err)
+	}
+
+	_, err = ProcessNamespaceConfigmaps(&failingResourceLister{configmapsErr: cause}, testNamespace, &FilterOptions{})
+	if !errors.Is(err, ErrListConfigMaps) || !errors.Is(err, cause) {
+		t.Errorf("Expected ErrListConfigMaps wrapping the cause, got %v", err)
+	}
+}
+
+func TestGetUnusedConfigmapsFormatError(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	tests := []struct {
+		name         string
+		outputFormat string
+		opts         Opts
+		expected     string
+	}{
+		{name: "invalid header template", outputFormat: "table", opts: Opts{HeaderTemplate: "{{.Missing}}"}},
+		{name: "unsupported output format", outputFormat: "xml", expected: `unsupported output format "xml" (supported: table, json, yaml, custom-resource, remote-write, tree)`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, test.outputFormat, test.opts)
+			if !errors.Is(err, ErrFormat) {
+				t.Fatalf("Expected ErrFormat, got %v", err)
+			}
+			if !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("Expected error to contain %q, got %q", test.expected, err.Error())
+			}
+			if output != "" {
+				t.Errorf("Expected no output alongside the error, got %q", output)
+			}
+		})
+	}
+}
+
+func TestProcessNamespaceConfigmapsCustomLister(t *testing.T) {
+	pod := CreateTestPod(testNamespace, "pod-1", "", []corev1.Volume{
+		{Name: "vol-1", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "configmap-1"}}}},
+	})
+	lister := &staticResourceLister{
+		pods: []corev1.Pod{*pod},
+		configmaps: []corev1.ConfigMap{
+			*CreateTestConfigmap(testNamespace, "configmap-1"),
+			*CreateTestConfigmap(testNamespace, "configmap-2"),
+		},
+	}
+
+	diff, err := ProcessNamespaceConfigmaps(lister, testNamespace, &FilterOptions{})
+	if err != nil {
+		t.Fatalf("Error processing namespace CM: %v", err)
+	}
+
+	unusedConfigmaps := []string{"configmap-2"}
+	if !equalSlices(diff, unusedConfigmaps) {
+		t.Errorf("Expected diff %v, got %v", unusedConfigmaps, diff)
+	}
+}
+
+func TestProcessNamespaceCMScanEnvValues(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	pod := CreateTestPod(testNamespace, "pod-5", "", nil)
+	pod.Spec.Containers = []corev1.Container{
+		{
+			Env: []corev1.EnvVar{
+				{Name: "CONFIG_NAME", Value: "configmap-3"},
+				{Name: "UNRELATED", Value: "configmap"},
+			},
+		},
+	}
+	_, err := clientset.CoreV1().Pods(testNamespace).Create(context.TODO(), pod, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Error creating fake pod: %v", err)
+	}
+
+	diff, err := processNamespaceCM(clientset, testNamespace, &FilterOptions{})
+	if err != nil {
+		t.Fatalf("Error processing namespace CM: %v", err)
+	}
+	if !equalSlices(diff, []string{"configmap-3"}) {
+		t.Errorf("Expected env values to be ignored by default, got %v", diff)
+	}
+
+	scan := scanNamespaceCM(NewResourceLister(clientset), nil, testNamespace, &FilterOptions{}, Opts{ScanEnvValues: true})
+	if scan.err != nil {
+		t.Fatalf("Error scanning namespace: %v", scan.err)
+	}
+	if diff = CalculateResourceDifference(scan.used, scan.candidates.names); len(diff) != 0 {
+		t.Errorf("Expected no unused configmaps, got %v", diff)
+	}
+}
+
+type recordingResourceLister struct {
+	staticResourceLister
+	listOptions []metav1.ListOptions
+}
+
+func (l *recordingResourceLister) ListPods(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.PodList, error) {
+	l.listOptions = append(l.listOptions, opts)
+	return l.staticResourceLister.ListPods(ctx, namespace, opts)
+}
+
+func (l *recordingResourceLister) ListConfigMaps(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.ConfigMapList, error) {
+	l.listOptions = append(l.listOptions, opts)
+	return l.staticResourceLister.ListConfigMaps(ctx, namespace, opts)
+}
+
+func TestStaleReadsLister(t *testing.T) {
+	recorder := &recordingResourceLister{}
+
+	if _, err := ProcessNamespaceConfigmaps(newStaleReadsLister(recorder), testNamespace, &FilterOptions{}); err != nil {
+		t.Fatalf("Error processing namespace CM: %v", err)
+	}
+
+	if len(recorder.listOptions) == 0 {
+		t.Fatal("Expected list calls to be made")
+	}
+	for _, opts := range recorder.listOptions {
+		if opts.ResourceVersion != "0" {
+			t.Errorf("Expected resourceVersion \"0\", got %q", opts.ResourceVersion)
+		}
+	}
+}
+
+func TestScanNamespaceCMListsOnce(t *testing.T) {
+	recorder := &recordingResourceLister{staticResourceLister: staticResourceLister{
+		pods:       []corev1.Pod{*CreateTestPod(testNamespace, "pod-1", "", nil)},
+		configmaps: []corev1.ConfigMap{*CreateTestConfigmap(testNamespace, "configmap-1")},
+	}}
+	filterOpts := &FilterOptions{}
+	opts := Opts{ScanEnvValues: true, ReportStaleExceptions: true, CheckDanglingKeys: true, ReferenceAnnotationKeys: []string{"example.com/configmaps"}}
+
+	if scan := scanNamespaceCM(recorder, nil, testNamespace, filterOpts, opts); scan.err != nil {
+		t.Fatalf("Error scanning namespace: %v", scan.err)
+	}
+	if len(recorder.listOptions) != 2 {
+		t.Errorf("Expected the pods and configmaps to be listed once for every step of the scan, got %d list calls", len(recorder.listOptions))
+	}
+}
+
+// pagedResourceLister serves the static resources in pages of opts.Limit items, the continue token being the
+// index of the next item
+type pagedResourceLister struct {
+	staticResourceLister
+	podListOptions       []metav1.ListOptions
+	configMapListOptions []metav1.ListOptions
+}
+
+// page returns the bounds of the page requested by opts out of total items and the continue token of the next page
+func (l *pagedResourceLister) page(opts metav1.ListOptions, total int) (int, int, string) {
+	start, _ := strconv.Atoi(opts.Continue)
+	end := total
+	if opts.Limit > 0 && start+int(opts.Limit) < total {
+		end = start + int(opts.Limit)
+	}
+	if end == total {
+		return start, end, ""
+	}
+	return start, end, strconv.Itoa(end)
+}
+
+func (l *pagedResourceLister) ListPods(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.PodList, error) {
+	l.podListOptions = append(l.podListOptions, opts)
+	start, end, continueToken := l.page(opts, len(l.pods))
+	return &corev1.PodList{ListMeta: metav1.ListMeta{Continue: continueToken}, Items: l.pods[start:end]}, nil
+}
+
+func (l *pagedResourceLister) ListConfigMaps(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.ConfigMapList, error) {
+	l.configMapListOptions = append(l.configMapListOptions, opts)
+	start, end, continueToken := l.page(opts, len(l.configmaps))
+	return &corev1.ConfigMapList{ListMeta: metav1.ListMeta{Continue: continueToken}, Items: l.configmaps[start:end]}, nil
+}
+
+func TestPagingLister(t *testing.T) {
+	lister := &pagedResourceLister{}
+	for i := 1; i <= 5; i++ {
+		lister.configmaps = append(lister.configmaps, *CreateTestConfigmap(testNamespace, fmt.Sprintf("configmap-%d", i)))
+	}
+	for i := 1; i <= 3; i++ {
+		pod := CreateTestPod(testNamespace, fmt.Sprintf("pod-%d", i), "", []corev1.Volume{
+			{Name: "vol-1", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: fmt.Sprintf("configmap-%d", i)}}}},
+		})
+		lister.pods = append(lister.pods, *pod)
+	}
+
+	diff, err := ProcessNamespaceConfigmaps(newPagingLister(lister, 2), testNamespace, &FilterOptions{})
+	if err != nil {
+		t.Fatalf("Error processing namespace CM: %v", err)
+	}
+	if !equalSlices(diff, []string{"configmap-4", "configmap-5"}) {
+		t.Errorf("Expected the configmaps of every page to be scanned, got %v", diff)
+	}
+
+	for _, listOptions := range append(append([]metav1.ListOptions{}, lister.podListOptions...), lister.configMapListOptions...) {
+		if listOptions.Limit != 2 {
+			t.Errorf("Expected a limit of 2, got %d", listOptions.Limit)
+		}
+	}
+	// 3 pods and 5 configmaps in pages of 2
+	var podLists int
+	for _, listOptions := range lister.podListOptions {
+		if listOptions.Continue == "" {
+			podLists++
+		}
+	}
+	if podLists == 0 || len(lister.podListOptions) != 2*podLists {
+		t.Errorf("Expected each of the %d pod lists to fetch 2 pages, got %d list calls", podLists, len(lister.podListOptions))
+	}
+	if calls := len(lister.configMapListOptions); calls != 3 {
+		t.Errorf("Expected the configmaps to be fetched in 3 pages, got %d list calls", calls)
+	}
+	if continueToken := lister.configMapListOptions[2].Continue; continueToken != "4" {
+		t.Errorf("Expected the last page to be requested with the continue token of the previous one, got %q", continueToken)
+	}
+
+	lister.configMapListOptions = nil
+	if _, err := newPagingLister(lister, 0).ListConfigMaps(context.TODO(), testNamespace, metav1.ListOptions{}); err != nil {
+		t.Fatalf("Error listing configmaps: %v", err)
+	}
+	if limit := lister.configMapListOptions[0].Limit; limit != defaultListPageSize {
+		t.Errorf("Expected the default limit of %d, got %d", defaultListPageSize, limit)
+	}
+}
+
+// manyContainersPod returns a pod whose containers all reference the same ConfigMaps
+func manyContainersPod(containers int) corev1.Pod {
+	pod := CreateTestPod(testNamespace, "pod-1", "", nil)
+	for i := 0; i < containers; i++ {
+		container := corev1.Container{
+			Name: fmt.Sprintf("container-%d", i),
+			Env: []corev1.EnvVar{{Name: "KEY", ValueFrom: &corev1.EnvVarSource{
+				ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "env-config"}, Key: "key"},
+			}}},
+			EnvFrom: []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "envfrom-config"}}}},
+		}
+		pod.Spec.Containers = append(pod.Spec.Containers, container)
+		initContainer := container
+		initContainer.Name = fmt.Sprintf("init-%d", i)
+		pod.Spec.InitContainers = append(pod.Spec.InitContainers, initContainer)
+	}
+	return *pod
+}
+
+func TestRetrieveUsedCMManyContainers(t *testing.T) {
+	lister := &staticResourceLister{
+		pods: []corev1.Pod{manyContainersPod(40), manyContainersPod(1)},
+		configmaps: []corev1.ConfigMap{
+			*CreateTestConfigmap(testNamespace, "env-config"),
+			*CreateTestConfigmap(testNamespace, "envfrom-config"),
+			*CreateTestConfigmap(testNamespace, "unused-config"),
+		},
+	}
+
+	_, _, envCM, envFromCM, envFromContainerCM, envFromInitContainerCM, err := retrieveUsedCM(lister, testNamespace)
+	if err != nil {
+		t.Fatalf("Error retrieving used ConfigMaps: %v", err)
+	}
+	// references are recorded once per pod
+	if !equalSlices(envCM, []string{"env-config", "env-config"}) {
+		t.Errorf("Expected env configmaps once per pod, got %v", envCM)
+	}
+	if !equalSlices(envFromCM, []string{"envfrom-config", "envfrom-config"}) || !equalSlices(envFromContainerCM, envFromCM) {
+		t.Errorf("Expected envFrom configmaps once per pod, got %v and %v", envFromCM, envFromContainerCM)
+	}
+	if !equalSlices(envFromInitContainerCM, []string{"env-config", "envfrom-config", "env-config", "envfrom-config"}) {
+		t.Errorf("Expected init container configmaps once per pod, got %v", envFromInitContainerCM)
+	}
+
+	diff, err := ProcessNamespaceConfigmaps(lister, testNamespace, &FilterOptions{})
+	if err != nil {
+		t.Fatalf("Error processing namespace CM: %v", err)
+	}
+	if !reflect.DeepEqual(diff, []string{"unused-config"}) {
+		t.Errorf("Expected only unused-config to be unused, got %v", diff)
+	}
+}
+
+func BenchmarkRetrieveUsedCMManyContainers(b *testing.B) {
+	lister := &staticResourceLister{pods: []corev1.Pod{manyContainersPod(50)}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, _, _, _, err := retrieveUsedCM(lister, testNamespace); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// newConfigMapMetadataClient returns a fake metadata client serving the metadata of the clientset's ConfigMaps
+func newConfigMapMetadataClient(t *testing.T, clientset *fake.Clientset) *metadatafake.FakeMetadataClient {
+	configmaps, err := clientset.CoreV1().ConfigMaps(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Error listing configmaps: %v", err)
+	}
+	scheme := metadatafake.NewTestScheme()
+	if err := metav1.AddMetaToScheme(scheme); err != nil {
+		t.Fatalf("Error building scheme: %v", err)
+	}
+	var objects []runtime.Object
+	for _, configmap := range configmaps.Items {
+		objects = append(objects, &metav1.PartialObjectMetadata{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: configmap.ObjectMeta,
+		})
+	}
+	return metadatafake.NewSimpleMetadataClient(scheme, objects...)
+}
+
+func TestGetUnusedConfigmapsMetadataOnly(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	metadataClient := newConfigMapMetadataClient(t, clientset)
+
+	expected, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	clientset.ClearActions()
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{MetadataClient: metadataClient})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+	if output != expected {
+		t.Errorf("Expected metadata-only listing to find %s, got %s", expected, output)
+	}
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "list" && action.GetResource().Resource == "configmaps" {
+			t.Errorf("Expected configmaps to be listed through the metadata client only")
+		}
+	}
+	if len(metadataClient.Actions()) == 0 {
+		t.Errorf("Expected configmaps to be listed through the metadata client")
+	}
+
+	// data-dependent filters need the full ConfigMaps
+	clientset.ClearActions()
+	metadataClient.ClearActions()
+	if _, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{HasDataKey: "key"}, clientset, "json", Opts{MetadataClient: metadataClient}); err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+	if len(metadataClient.Actions()) != 0 {
+		t.Errorf("Expected a data key filter to list full configmaps, got %v", metadataClient.Actions())
+	}
+}
+
+func TestGetUnusedConfigmapsOutputTargets(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	var table bytes.Buffer
+	path := filepath.Join(t.TempDir(), "report.json")
+	opts := Opts{OutputTargets: []OutputTarget{{Format: "table", Writer: &table}, {Format: "json", Path: path}}}
+	if err := opts.Validate(); err != nil {
+		t.Fatalf("Error validating options: %v", err)
+	}
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, TreeOutputFormat, opts)
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+	if expected := fmt.Sprintf("%s (1)\n└── ConfigMap (1)\n    └── configmap-3\n", testNamespace); output != expected {
+		t.Errorf("Expected the returned tree %q, got %q", expected, output)
+	}
+
+	if !strings.Contains(table.String(), "Unused Configmaps in Namespace: "+testNamespace) || !strings.Contains(table.String(), "configmap-3") {
+		t.Errorf("Expected the table target to list configmap-3, got %q", table.String())
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading json target: %v", err)
+	}
+	var actualOutput map[string]map[string][]string
+	if err := json.Unmarshal(content, &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling json target: %v", err)
+	}
+	expected := map[string]map[string][]string{testNamespace: {"ConfigMap": {"configmap-3"}}}
+	if !reflect.DeepEqual(actualOutput, expected) {
+		t.Errorf("Expected json target %v, got %v", expected, actualOutput)
+	}
+}
+
+func TestParseOutputTarget(t *testing.T) {
+	target, err := ParseOutputTarget("json=report.json")
+	if err != nil {
+		t.Fatalf("Error parsing output target: %v", err)
+	}
+	if target != (OutputTarget{Format: "json", Path: "report.json"}) {
+		t.Errorf("Expected a json target written to report.json, got %+v", target)
+	}
+
+	for _, value := range []string{"json", "=report.json", "xml=report.xml"} {
+		if _, err := ParseOutputTarget(value); err == nil {
+			t.Errorf("Expected output target %q to be invalid", value)
+		}
+	}
+}
+
+func TestGetUnusedConfigmapsCategorizeEmpty(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	configmap1 := CreateTestConfigmap(testNamespace, "configmap-1")
+	configmap1.Data = map[string]string{"key": "value"}
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Update(context.TODO(), configmap1, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("Error updating fake configmap: %v", err)
+	}
+	configmap4 := CreateTestConfigmap(testNamespace, "configmap-4")
+	configmap4.BinaryData = map[string][]byte{"key": []byte("value")}
+	for _, configmap := range []*corev1.ConfigMap{configmap4, CreateTestConfigmap(testNamespace, "configmap-5")} {
+		if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), configmap, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{CategorizeEmpty: true, Canonical: true})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	var actualOutput map[string]struct {
+		ConfigMap  []string            `json:"ConfigMap"`
+		Categories ConfigMapCategories `json:"categories"`
+	}
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+
+	expected := ConfigMapCategories{
+		UnusedNonEmpty: []string{"configmap-4"},
+		UnusedEmpty:    []string{"configmap-3", "configmap-5"},
+		EmptyButUsed:   []string{"configmap-2"},
+	}
+	if actual := actualOutput[testNamespace].Categories; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected categories %+v, got %+v", expected, actual)
+	}
+	if unused := actualOutput[testNamespace].ConfigMap; !reflect.DeepEqual(unused, []string{"configmap-3", "configmap-4", "configmap-5"}) {
+		t.Errorf("Expected the unused configmaps to still be listed, got %v", unused)
+	}
+}
+
+func TestExceptionResourceAppliesTo(t *testing.T) {
+	tests := []struct {
+		exception ExceptionResource
+		namespace string
+		expected  bool
+	}{
+		{ExceptionResource{ResourceName: "shared-config", Namespace: AllNamespacesException}, testNamespace, true},
+		{ExceptionResource{ResourceName: "shared-config", Namespace: AllNamespacesException}, "other-namespace", true},
+		{ExceptionResource{ResourceName: "shared-config", Namespace: testNamespace}, testNamespace, true},
+		{ExceptionResource{ResourceName: "shared-config", Namespace: testNamespace}, "other-namespace", false},
+	}
+	for _, test := range tests {
+		if applies := test.exception.AppliesTo(test.namespace); applies != test.expected {
+			t.Errorf("Expected exception %v to apply in %s to be %v, got %v", test.exception, test.namespace, test.expected, applies)
+		}
+	}
+}
+
+func TestGetUnusedConfigmapsOverlappingExceptions(t *testing.T) {
+	defaultExceptions := exceptionconfigmaps
+	t.Cleanup(func() { exceptionconfigmaps = defaultExceptions })
+	// the wildcard entry protects shared-config everywhere, the specific one overlaps it in testNamespace
+	exceptionconfigmaps = append(append([]ExceptionResource{}, defaultExceptions...),
+		ExceptionResource{ResourceName: "shared-config", Namespace: AllNamespacesException},
+		ExceptionResource{ResourceName: "shared-config", Namespace: testNamespace},
+	)
+
+	clientset := createTestConfigmaps(t)
+	if _, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other-namespace"}}, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating namespace: %v", err)
+	}
+	for _, namespace := range []string{testNamespace, "other-namespace"} {
+		if _, err := clientset.CoreV1().ConfigMaps(namespace).Create(context.TODO(), CreateTestConfigmap(namespace, "shared-config"), metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{ReportProtected: true, IncludeUsed: true})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	var actualOutput struct {
+		Protected  []ProtectedResource            `json:"protected"`
+		Namespaces map[string]map[string][]string `json:"namespaces"`
+	}
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+
+	expectedUnused := map[string][]string{testNamespace: {"configmap-3"}, "other-namespace": nil}
+	expectedUsed := map[string][]string{testNamespace: {"configmap-1", "configmap-2", "shared-config"}, "other-namespace": {"shared-config"}}
+	for namespace, resources := range actualOutput.Namespaces {
+		if !reflect.DeepEqual(resources["ConfigMap"], expectedUnused[namespace]) {
+			t.Errorf("Expected unused configmaps %v in %s, got %v", expectedUnused[namespace], namespace, resources["ConfigMap"])
+		}
+		if !reflect.DeepEqual(resources["used"], expectedUsed[namespace]) {
+			t.Errorf("Expected used configmaps %v in %s, got %v", expectedUsed[namespace], namespace, resources["used"])
+		}
+	}
+	if len(actualOutput.Namespaces) != 2 {
+		t.Errorf("Expected both namespaces to be scanned, got %v", actualOutput.Namespaces)
+	}
+
+	protections := make(map[string]int)
+	for _, resource := range actualOutput.Protected {
+		if resource.ResourceName == "shared-config" {
+			protections[resource.Namespace]++
+		}
+	}
+	if expected := map[string]int{testNamespace: 1, "other-namespace": 1}; !reflect.DeepEqual(protections, expected) {
+		t.Errorf("Expected shared-config to be protected once per namespace, got %v", protections)
+	}
+}
+
+func TestGetUnusedConfigmapsShowAge(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	if _, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace}}, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating namespace %s: %v", testNamespace, err)
+	}
+	configmap := CreateTestConfigmap(testNamespace, "configmap-1")
+	configmap.CreationTimestamp = metav1.NewTime(time.Now().Add(-72 * time.Hour))
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), configmap, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake configmap: %v", err)
+	}
+
+	for _, showAge := range []bool{false, true} {
+		output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "table", Opts{ShowAge: showAge})
+		if err != nil {
+			t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+		}
+		if strings.Contains(output, "3d ago") != showAge {
+			t.Errorf("Expected the age column with ShowAge %t, got %s", showAge, output)
+		}
+	}
+}
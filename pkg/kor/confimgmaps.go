@@ -3,96 +3,384 @@ package kor
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"io"
+	"sort"
+	"strings"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
 )
 
+// ResultConfigMapLabel is set to "true" on the ConfigMaps kor writes its results to, so they are never
+// reported as unused by a later scan
+const ResultConfigMapLabel = "kor/result"
+
 var exceptionconfigmaps = []ExceptionResource{
 	{ResourceName: "aws-auth", Namespace: "kube-system"},
-	{ResourceName: "kube-root-ca.crt", Namespace: "*"},
+	{ResourceName: "kube-root-ca.crt", Namespace: AllNamespacesException},
+	{ResourceName: "extension-apiserver-authentication", Namespace: "kube-system", System: true},
+	{ResourceName: "kube-apiserver-legacy-service-account-token-tracking", Namespace: "kube-system", System: true},
+	{ResourceName: "kubeadm-config", Namespace: "kube-system", System: true},
+	{ResourceName: "kubelet-config", Namespace: "kube-system", System: true},
+	{ResourceName: "cluster-info", Namespace: "kube-public", System: true},
+}
+
+// containerCMRef is a container reference to a ConfigMap, recorded once per pod
+type containerCMRef struct {
+	kind configMapRefKind
+	name string
+}
+
+// usedCMCollector collects the ConfigMaps referenced by pods. The container references of a pod are recorded
+// once per kind of reference, so a pod with dozens of containers sharing ConfigMaps doesn't grow the results.
+type usedCMCollector struct {
+	volumesCM              []string
+	volumesProjectedCM     []string
+	envCM                  []string
+	envFromCM              []string
+	envFromContainerCM     []string
+	envFromInitContainerCM []string
+	// podRefs are the container references of the pod being collected, reused across pods
+	podRefs map[containerCMRef]bool
+	// specRefs is the buffer the references of each pod spec are extracted to
+	specRefs []configMapRef
+}
+
+func (c *usedCMCollector) addContainerRef(kind configMapRefKind, name string) {
+	ref := containerCMRef{kind: kind, name: name}
+	if c.podRefs[ref] {
+		return
+	}
+	c.podRefs[ref] = true
+	switch kind {
+	case envRef:
+		c.envCM = append(c.envCM, name)
+	case envFromRef:
+		c.envFromCM = append(c.envFromCM, name)
+	case envFromContainerRef:
+		c.envFromContainerCM = append(c.envFromContainerCM, name)
+	case envFromInitContainerRef:
+		c.envFromInitContainerCM = append(c.envFromInitContainerCM, name)
+	}
 }
 
-func retrieveUsedCM(clientset kubernetes.Interface, namespace string) ([]string, []string, []string, []string, []string, []string, error) {
-	var volumesCM []string
-	var volumesProjectedCM []string
-	var envCM []string
-	var envFromCM []string
-	var envFromContainerCM []string
-	var envFromInitContainerCM []string
+// addPod collects the references extractConfigMapRefs finds in the pod spec
+func (c *usedCMCollector) addPod(pod *corev1.Pod) {
+	for ref := range c.podRefs {
+		delete(c.podRefs, ref)
+	}
+
+	c.specRefs = appendConfigMapRefs(c.specRefs[:0], &pod.Spec)
+	for _, ref := range c.specRefs {
+		switch ref.kind {
+		case volumeRef, initVolumeMountRef:
+			c.volumesCM = append(c.volumesCM, ref.name)
+		case projectedVolumeRef:
+			c.volumesProjectedCM = append(c.volumesProjectedCM, ref.name)
+		default:
+			c.addContainerRef(ref.kind, ref.name)
+		}
+	}
+}
 
-	pods, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
+func retrieveUsedCM(lister ResourceLister, namespace string) ([]string, []string, []string, []string, []string, []string, error) {
+	pods, err := lister.ListPods(context.TODO(), namespace, metav1.ListOptions{})
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, err
+		return nil, nil, nil, nil, nil, nil, fmt.Errorf("%w: %w", ErrListPods, err)
 	}
 
-	for _, pod := range pods.Items {
-		for _, volume := range pod.Spec.Volumes {
-			if volume.ConfigMap != nil {
-				volumesCM = append(volumesCM, volume.ConfigMap.Name)
-			}
-			if volume.Projected != nil {
-				for _, source := range volume.Projected.Sources {
-					if source.ConfigMap != nil {
-						volumesProjectedCM = append(volumesProjectedCM, source.ConfigMap.Name)
-					}
-				}
+	c := usedCMCollector{podRefs: make(map[containerCMRef]bool)}
+	for i := range pods.Items {
+		c.addPod(&pods.Items[i])
+	}
+
+	for _, resource := range exceptionconfigmaps {
+		if resource.AppliesTo(namespace) {
+			c.volumesCM = append(c.volumesCM, resource.ResourceName)
+		}
+	}
+
+	return c.volumesCM, c.volumesProjectedCM, c.envCM, c.envFromCM, c.envFromContainerCM, c.envFromInitContainerCM, nil
+}
+
+// staleExceptions returns the exceptions that match no ConfigMap in the scanned namespaces.
+// Exceptions for a namespace that wasn't scanned can't be evaluated and are never reported, nor are system ones.
+func staleExceptions(exceptions []ExceptionResource, scannedConfigMaps map[string][]string) []ExceptionResource {
+	var stale []ExceptionResource
+	for _, exception := range exceptions {
+		if exception.System {
+			continue
+		}
+		if exception.Namespace != AllNamespacesException {
+			if configMapNames, scanned := scannedConfigMaps[exception.Namespace]; scanned && !slicesContain(configMapNames, exception.ResourceName) {
+				stale = append(stale, exception)
 			}
+			continue
 		}
-		for _, container := range pod.Spec.Containers {
-			for _, env := range container.Env {
-				if env.ValueFrom != nil && env.ValueFrom.ConfigMapKeyRef != nil {
-					envCM = append(envCM, env.ValueFrom.ConfigMapKeyRef.Name)
-				}
+
+		matched := false
+		for _, configMapNames := range scannedConfigMaps {
+			if slicesContain(configMapNames, exception.ResourceName) {
+				matched = true
+				break
 			}
-			for _, envFrom := range container.EnvFrom {
-				if envFrom.ConfigMapRef != nil {
-					envFromCM = append(envFromCM, envFrom.ConfigMapRef.Name)
-				}
+		}
+		if !matched && len(scannedConfigMaps) > 0 {
+			stale = append(stale, exception)
+		}
+	}
+	return stale
+}
+
+// ValidateExceptions returns the configured ConfigMap exceptions that no longer correspond to an existing
+// ConfigMap. Unlike the stale exceptions of a scan, every namespace is checked: an exception for a namespace
+// is stale when the ConfigMap doesn't exist in it, and a "*" exception when it exists in no namespace. System
+// exceptions are never stale.
+func ValidateExceptions(clientset kubernetes.Interface) ([]ExceptionResource, error) {
+	return validateExceptions(clientset, exceptionconfigmaps)
+}
+
+func validateExceptions(clientset kubernetes.Interface, exceptions []ExceptionResource) ([]ExceptionResource, error) {
+	configmaps, err := clientset.CoreV1().ConfigMaps(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrListConfigMaps, err)
+	}
+	existing := make(map[string]bool, len(configmaps.Items))
+	existingNames := make(map[string]bool, len(configmaps.Items))
+	for _, configmap := range configmaps.Items {
+		existing[configmap.Namespace+"/"+configmap.Name] = true
+		existingNames[configmap.Name] = true
+	}
+
+	var stale []ExceptionResource
+	for _, exception := range exceptions {
+		if exception.System {
+			continue
+		}
+		if exception.Namespace == AllNamespacesException {
+			if !existingNames[exception.ResourceName] {
+				stale = append(stale, exception)
 			}
-			for _, envFrom := range container.EnvFrom {
-				if envFrom.ConfigMapRef != nil {
-					envFromContainerCM = append(envFromContainerCM, envFrom.ConfigMapRef.Name)
+			continue
+		}
+		if !existing[exception.Namespace+"/"+exception.ResourceName] {
+			stale = append(stale, exception)
+		}
+	}
+	return stale, nil
+}
+
+func retrieveEnvValueCM(lister ResourceLister, namespace string, configMapNames []string) ([]string, error) {
+	var envValueCM []string
+
+	pods, err := lister.ListPods(context.TODO(), namespace, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrListPods, err)
+	}
+
+	names := make(map[string]bool, len(configMapNames))
+	for _, name := range configMapNames {
+		names[name] = true
+	}
+
+	for _, pod := range pods.Items {
+		for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+			for _, container := range containers {
+				for _, env := range container.Env {
+					if env.ValueFrom == nil && names[env.Value] {
+						envValueCM = append(envValueCM, env.Value)
+					}
 				}
 			}
 		}
-		for _, initContainer := range pod.Spec.InitContainers {
-			for _, volume := range initContainer.VolumeMounts {
-				if volume.Name != "" && volume.MountPath != "" {
-					volumesCM = append(volumesCM, volume.Name)
-				}
+	}
+
+	return envValueCM, nil
+}
+
+// retrieveAnnotationCM returns the ConfigMaps named by the values of the given annotation keys on pods and
+// ConfigMaps. Values may list several ConfigMap names separated by commas.
+func retrieveAnnotationCM(lister ResourceLister, namespace string, annotationKeys []string, configMapNames []string) ([]string, error) {
+	pods, err := lister.ListPods(context.TODO(), namespace, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrListPods, err)
+	}
+	configmaps, err := lister.ListConfigMaps(context.TODO(), namespace, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrListConfigMaps, err)
+	}
+
+	var annotations []map[string]string
+	for _, pod := range pods.Items {
+		annotations = append(annotations, pod.Annotations)
+	}
+	for _, configmap := range configmaps.Items {
+		annotations = append(annotations, configmap.Annotations)
+	}
+
+	return annotationReferences(annotations, annotationKeys, configMapNames), nil
+}
+
+// annotationReferences returns the ConfigMaps of configMapNames named by the values of the given annotation keys
+// in annotations
+func annotationReferences(annotations []map[string]string, annotationKeys []string, configMapNames []string) []string {
+	names := make(map[string]bool, len(configMapNames))
+	for _, name := range configMapNames {
+		names[name] = true
+	}
+
+	var annotationCM []string
+	for _, resourceAnnotations := range annotations {
+		for _, key := range annotationKeys {
+			value, ok := resourceAnnotations[key]
+			if !ok {
+				continue
 			}
-			for _, env := range initContainer.Env {
-				if env.ValueFrom != nil && env.ValueFrom.ConfigMapKeyRef != nil {
-					envFromInitContainerCM = append(envFromInitContainerCM, env.ValueFrom.ConfigMapKeyRef.Name)
+			for _, name := range strings.Split(value, ",") {
+				if name = strings.TrimSpace(name); names[name] {
+					annotationCM = append(annotationCM, name)
 				}
 			}
 		}
 	}
+	return annotationCM
+}
 
-	for _, resource := range exceptionconfigmaps {
-		if resource.Namespace == namespace || resource.Namespace == "*" {
-			volumesCM = append(volumesCM, resource.ResourceName)
+// configMapDataBytes returns the size of the keys and values stored in the ConfigMap
+func configMapDataBytes(configmap corev1.ConfigMap) int {
+	size := 0
+	for key, value := range configmap.Data {
+		size += len(key) + len(value)
+	}
+	for key, value := range configmap.BinaryData {
+		size += len(key) + len(value)
+	}
+	return size
+}
+
+// needsConfigMapData reports whether a filter or option inspects the data of ConfigMaps, which metadata-only
+// lists leave out
+func needsConfigMapData(filterOpts *FilterOptions, opts Opts) bool {
+	return filterOpts.MinDataBytes > 0 || filterOpts.HasDataKey != "" || len(filterOpts.ProtectedDataKeys) > 0 || opts.CheckDanglingKeys || opts.CategorizeEmpty
+}
+
+func retrieveConfigMapNames(lister ResourceLister, namespace string, filterOpts *FilterOptions, usedPredicate UsedPredicate) ([]string, error) {
+	candidates, err := retrieveConfigMapCandidates(lister, namespace, filterOpts, Opts{UsedPredicate: usedPredicate})
+	return candidates.names, err
+}
+
+// configMapCandidates are the ConfigMaps of a namespace that are candidates for being reported as unused
+type configMapCandidates struct {
+	names []string
+	// identities are the UID and resourceVersion each candidate was listed with
+	identities map[string]ResourceIdentity
+	// protected are the ConfigMaps kept from being reported as unused and the source of their protection
+	protected []ProtectedResource
+	// empty are the candidates without data or binary data
+	empty map[string]bool
+	// owners are the values of the owner label of the candidates that have it
+	owners map[string]string
+	// heuristics are the low confidence references to the candidates
+	heuristics []heuristicReference
+	// sourceFiles are the manifest files the candidates were rendered from, when recorded in their annotations
+	sourceFiles map[string]string
+	// deleteSelected are the candidates matching Opts.DeleteSelector, nil without a selector
+	deleteSelected map[string]bool
+}
+
+// ConfigMapCategories splits the ConfigMaps of a namespace by whether they are used and hold data, so the unused
+// ConfigMaps holding data, which are the likeliest to matter, can be reviewed first
+type ConfigMapCategories struct {
+	UnusedNonEmpty []string `json:"unused-nonempty"`
+	UnusedEmpty    []string `json:"unused-empty"`
+	EmptyButUsed   []string `json:"empty-but-used"`
+}
+
+// categorizeConfigMaps sorts the unused ConfigMaps in diff, which may carry deletion suffixes, and the used ones
+// into their categories. The used ConfigMaps holding data aren't part of any category.
+func categorizeConfigMaps(diff, used []string, empty map[string]bool) ConfigMapCategories {
+	categories := ConfigMapCategories{UnusedNonEmpty: []string{}, UnusedEmpty: []string{}, EmptyButUsed: []string{}}
+	for _, entry := range diff {
+		if empty[resourceNameFromDiff(entry)] {
+			categories.UnusedEmpty = append(categories.UnusedEmpty, entry)
+		} else {
+			categories.UnusedNonEmpty = append(categories.UnusedNonEmpty, entry)
 		}
 	}
+	for _, name := range used {
+		if empty[name] {
+			categories.EmptyButUsed = append(categories.EmptyButUsed, name)
+		}
+	}
+	return categories
+}
 
-	return volumesCM, volumesProjectedCM, envCM, envFromCM, envFromContainerCM, envFromInitContainerCM, nil
+// builtInException returns the built-in exception of the ConfigMap, if it is one
+func builtInException(namespace, name string) (ExceptionResource, bool) {
+	for _, exception := range exceptionconfigmaps {
+		if exception.ResourceName == name && exception.AppliesTo(namespace) {
+			return exception, true
+		}
+	}
+	return ExceptionResource{}, false
 }
 
-func retrieveConfigMapNames(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions) ([]string, error) {
-	configmaps, err := clientset.CoreV1().ConfigMaps(namespace).List(context.TODO(), metav1.ListOptions{})
+// retrieveConfigMapCandidates returns the ConfigMaps that are candidates for being reported as unused
+func retrieveConfigMapCandidates(lister ResourceLister, namespace string, filterOpts *FilterOptions, opts Opts) (configMapCandidates, error) {
+	configmaps, err := lister.ListConfigMaps(context.TODO(), namespace, metav1.ListOptions{})
 	if err != nil {
-		return nil, err
+		return configMapCandidates{}, fmt.Errorf("%w: %w", ErrListConfigMaps, err)
 	}
 	names := make([]string, 0, len(configmaps.Items))
+	identities := make(map[string]ResourceIdentity, len(configmaps.Items))
+	empty := make(map[string]bool)
+	owners := make(map[string]string)
+	sourceFiles := make(map[string]string)
+	var deleteSelector labels.Selector
+	var deleteSelected map[string]bool
+	if opts.DeleteSelector != "" {
+		if deleteSelector, err = labels.Parse(opts.DeleteSelector); err != nil {
+			return configMapCandidates{}, err
+		}
+		deleteSelected = make(map[string]bool)
+	}
+	var protected []ProtectedResource
+	protect := func(name, source string) {
+		protected = append(protected, ProtectedResource{ResourceName: name, Namespace: namespace, Source: source})
+	}
+	// the same ConfigMap can be listed more than once, e.g. when served from the watch cache, so candidates are
+	// keyed by UID rather than by name
+	seen := make(map[types.UID]struct{}, len(configmaps.Items))
 	for _, configmap := range configmaps.Items {
+		uid := configmap.UID
+		if uid == "" {
+			uid = types.UID(configmap.Name)
+		}
+		if _, ok := seen[uid]; ok {
+			continue
+		}
+		seen[uid] = struct{}{}
+
 		// checks if the resource has any labels that match the excluded selector specified in opts.ExcludeLabels.
 		// If it does, the resource is skipped.
 		if excluded, _ := HasExcludedLabel(configmap.Labels, filterOpts.ExcludeLabels); excluded {
+			protect(configmap.Name, ProtectionSourceLabel)
+			continue
+		}
+		// checks if the resource has any annotations that match the excluded selector specified in opts.ExcludeAnnotations.
+		excluded, err := HasExcludedAnnotation(configmap.Annotations, filterOpts.ExcludeAnnotations)
+		if err != nil {
+			return configMapCandidates{}, err
+		}
+		if excluded {
+			protect(configmap.Name, ProtectionSourceAnnotation)
 			continue
 		}
 		// checks if the resource's age (measured from its last modified time) matches the included criteria
@@ -101,21 +389,89 @@ func retrieveConfigMapNames(clientset kubernetes.Interface, namespace string, fi
 			continue
 		}
 
+		// checks if the size of the resource's data matches the included criteria specified by the filter options.
+		if !HasIncludedSize(configMapDataBytes(configmap), filterOpts) {
+			continue
+		}
+
+		// checks if the resource contains the data key required by the filter options.
+		if !HasIncludedDataKey(configmap.Data, configmap.BinaryData, filterOpts) {
+			continue
+		}
+
+		// checks if the resource holds a protected data key specified by the filter options, which marks it as used.
+		if HasProtectedDataKey(configmap.Data, configmap.BinaryData, filterOpts) {
+			protect(configmap.Name, ProtectionSourceGlob)
+			continue
+		}
+
 		if configmap.Labels["kor/used"] == "true" {
+			protect(configmap.Name, ProtectionSourceLabel)
 			continue
 		}
 
+		if configmap.Labels[ResultConfigMapLabel] == "true" {
+			protect(configmap.Name, ProtectionSourceLabel)
+			continue
+		}
+
+		if opts.UsedPredicate != nil {
+			if used, reason := opts.UsedPredicate(configmap.ObjectMeta); used {
+				protected = append(protected, ProtectedResource{ResourceName: configmap.Name, Namespace: namespace, Source: ProtectionSourceCustomException, Reason: reason})
+				continue
+			}
+		}
+
+		// built-in exceptions stay candidates, they are part of the used ConfigMaps
+		if exception, ok := builtInException(namespace, configmap.Name); ok {
+			resource := ProtectedResource{ResourceName: configmap.Name, Namespace: namespace, Source: ProtectionSourceBuiltInException}
+			if exception.System {
+				resource.Reason = systemExceptionReason
+			}
+			protected = append(protected, resource)
+		}
+
 		names = append(names, configmap.Name)
+		identities[configmap.Name] = ResourceIdentity{UID: configmap.UID, ResourceVersion: configmap.ResourceVersion, CreationTimestamp: configmap.CreationTimestamp, Finalizers: configmap.Finalizers}
+		if len(configmap.Data) == 0 && len(configmap.BinaryData) == 0 {
+			empty[configmap.Name] = true
+		}
+		if owner := configmap.Labels[opts.OwnerLabelKey]; opts.OwnerLabelKey != "" && owner != "" {
+			owners[configmap.Name] = owner
+		}
+		if file := configmap.Annotations[sourcePathAnnotation]; file != "" {
+			sourceFiles[configmap.Name] = file
+		}
+		if deleteSelector != nil {
+			deleteSelected[configmap.Name] = deleteSelector.Matches(labels.Set(configmap.Labels))
+		}
 	}
-	return names, nil
+	return configMapCandidates{names: names, identities: identities, protected: protected, empty: empty, owners: owners, sourceFiles: sourceFiles, deleteSelected: deleteSelected}, nil
 }
 
 func processNamespaceCM(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions) ([]string, error) {
-	volumesCM, volumesProjectedCM, envCM, envFromCM, envFromContainerCM, envFromInitContainerCM, err := retrieveUsedCM(clientset, namespace)
+	return ProcessNamespaceConfigmaps(NewResourceLister(clientset), namespace, filterOpts)
+}
+
+// ProcessNamespaceConfigmaps returns the unused ConfigMaps in the namespace using the resources supplied by lister
+func ProcessNamespaceConfigmaps(lister ResourceLister, namespace string, filterOpts *FilterOptions) ([]string, error) {
+	usedConfigMaps, candidates, err := retrieveNamespaceCMUsage(lister, namespace, filterOpts, Opts{})
 	if err != nil {
 		return nil, err
 	}
 
+	diff := CalculateResourceDifference(usedConfigMaps, candidates.names)
+	return diff, nil
+}
+
+// retrieveNamespaceCMUsage returns the names of the ConfigMaps referenced in the namespace along with the
+// ConfigMaps that are candidates for being reported as unused
+func retrieveNamespaceCMUsage(lister ResourceLister, namespace string, filterOpts *FilterOptions, opts Opts) ([]string, configMapCandidates, error) {
+	volumesCM, volumesProjectedCM, envCM, envFromCM, envFromContainerCM, envFromInitContainerCM, err := retrieveUsedCM(lister, namespace)
+	if err != nil {
+		return nil, configMapCandidates{}, err
+	}
+
 	volumesCM = RemoveDuplicatesAndSort(volumesCM)
 	volumesProjectedCM = RemoveDuplicatesAndSort(volumesProjectedCM)
 	envCM = RemoveDuplicatesAndSort(envCM)
@@ -123,10 +479,11 @@ func processNamespaceCM(clientset kubernetes.Interface, namespace string, filter
 	envFromContainerCM = RemoveDuplicatesAndSort(envFromContainerCM)
 	envFromInitContainerCM = RemoveDuplicatesAndSort(envFromInitContainerCM)
 
-	configMapNames, err := retrieveConfigMapNames(clientset, namespace, filterOpts)
+	candidates, err := retrieveConfigMapCandidates(lister, namespace, filterOpts, opts)
 	if err != nil {
-		return nil, err
+		return nil, configMapCandidates{}, err
 	}
+	configMapNames := candidates.names
 
 	var usedConfigMaps []string
 	slicesToAppend := [][]string{volumesCM, volumesProjectedCM, envCM, envFromCM, envFromContainerCM, envFromInitContainerCM}
@@ -134,46 +491,506 @@ func processNamespaceCM(clientset kubernetes.Interface, namespace string, filter
 	for _, slice := range slicesToAppend {
 		usedConfigMaps = append(usedConfigMaps, slice...)
 	}
-	diff := CalculateResourceDifference(usedConfigMaps, configMapNames)
-	return diff, nil
 
+	if opts.ScanEnvValues || len(opts.ReferenceAnnotationKeys) > 0 || minDeleteConfidenceLow(opts) {
+		if candidates.heuristics, err = retrieveHeuristicCM(lister, namespace, configMapNames, opts); err != nil {
+			return nil, configMapCandidates{}, err
+		}
+		// env var values only count as references when scanned for, the other way they can only keep
+		// ConfigMaps from being deleted
+		for _, reference := range candidates.heuristics {
+			if reference.source != envValueReferenceSource || opts.ScanEnvValues {
+				usedConfigMaps = append(usedConfigMaps, reference.name)
+			}
+		}
+	}
+
+	return usedConfigMaps, candidates, nil
+}
+
+// selectDeletionCandidatesCM splits the unused ConfigMaps into the ones whose labels match the deletion selector,
+// according to the selected candidates, and the others, which are reported but not deleted. Without a deletion
+// selector every candidate is selected.
+func selectDeletionCandidatesCM(candidates []string, selected map[string]bool) ([]string, []string) {
+	if selected == nil {
+		return candidates, nil
+	}
+	var matching, unselected []string
+	for _, name := range candidates {
+		if selected[name] {
+			matching = append(matching, name)
+		} else {
+			unselected = append(unselected, name)
+		}
+	}
+	return matching, unselected
+}
+
+// configMapAges renders the age of each unused ConfigMap, it returns nil when some creation time is unknown
+func configMapAges(diff []string, identities map[string]ResourceIdentity, now time.Time, timeFormat string) []string {
+	ages := make([]string, 0, len(diff))
+	for _, entry := range diff {
+		identity, found := identities[resourceNameFromDiff(entry)]
+		if !found || identity.CreationTimestamp.IsZero() {
+			return nil
+		}
+		ages = append(ages, FormatAge(identity.CreationTimestamp.Time, now, timeFormat))
+	}
+	return ages
+}
+
+func configMapPath(namespace, name string) string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/configmaps/%s", namespace, name)
+}
+
+func configMapFindings(cluster, namespace string, diff []string, identities map[string]ResourceIdentity, opts Opts) []ResourceFinding {
+	findings := make([]ResourceFinding, 0, len(diff))
+	for _, entry := range diff {
+		finding := ResourceFinding{Name: entry, FindingID: FindingID(cluster, namespace, "ConfigMap", entry)}
+		if opts.IncludeResourcePaths {
+			finding.Path = configMapPath(namespace, resourceNameFromDiff(entry))
+		}
+		if opts.IncludeResourceIdentity {
+			identity := identities[resourceNameFromDiff(entry)]
+			finding.UID, finding.ResourceVersion = identity.UID, identity.ResourceVersion
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// namespaceCMScan holds the ConfigMap usage of a single namespace
+type namespaceCMScan struct {
+	scanned    []string
+	used       []string
+	candidates configMapCandidates
+	// warnings are the dangling key warnings of the namespace, with Opts.CheckDanglingKeys
+	warnings []string
+	err      error
+}
+
+// newConfigMapScanLister returns the lister ConfigMap scans list pods and ConfigMaps with, decorated according to
+// the scan options. Every path deciding which ConfigMaps are used, reporting or deleting them, shares it.
+func newConfigMapScanLister(clientset kubernetes.Interface, filterOpts *FilterOptions, opts Opts) ResourceLister {
+	var lister ResourceLister = NewResourceLister(clientset)
+	if opts.MetadataClient != nil && !needsConfigMapData(filterOpts, opts) {
+		lister = newConfigMapMetadataLister(lister, opts.MetadataClient)
+	}
+	lister = newPagingLister(lister, opts.ListPageSize)
+	if opts.AllowStaleReads {
+		lister = newStaleReadsLister(lister)
+	}
+	jobs := newJobCache(clientset)
+	if opts.ScanJobTemplates {
+		lister = newJobTemplatesLister(lister, clientset, jobs)
+	}
+	if opts.ClusterWideList {
+		lister = newClusterWideLister(lister)
+	}
+	if opts.IgnoreTerminatingPods {
+		lister = newActivePodsLister(lister)
+	}
+	if opts.IgnoreCompletedJobPods {
+		lister = newCompletedJobPodsLister(lister, jobs)
+	}
+	return lister
+}
+
+// scanNamespaceCM only lists and compares resources, so it is safe to call for several namespaces in parallel.
+// The pods and ConfigMaps of the namespace are listed once for every step of the scan. The annotations listed by
+// workloads, when not nil, are also looked up for references.
+func scanNamespaceCM(lister ResourceLister, workloads *workloadAnnotationsLister, namespace string, filterOpts *FilterOptions, opts Opts) namespaceCMScan {
+	ctx := context.Background()
+	if opts.PerNamespaceTimeout > 0 {
+		deadline := time.Now().Add(opts.PerNamespaceTimeout)
+		lister = newDeadlineLister(lister, deadline)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	lister = newSnapshotLister(lister)
+
+	var scan namespaceCMScan
+	if opts.ReportStaleExceptions {
+		configmaps, err := lister.ListConfigMaps(context.TODO(), namespace, metav1.ListOptions{})
+		if err != nil {
+			return namespaceCMScan{err: fmt.Errorf("%w: %w", ErrListConfigMaps, err)}
+		}
+		scan.scanned = make([]string, 0, len(configmaps.Items))
+		for _, configmap := range configmaps.Items {
+			scan.scanned = append(scan.scanned, configmap.Name)
+		}
+	}
+
+	scan.used, scan.candidates, scan.err = retrieveNamespaceCMUsage(lister, namespace, filterOpts, opts)
+	if scan.err != nil {
+		return scan
+	}
+	if opts.CheckDanglingKeys {
+		danglingKeyWarnings, err := retrieveDanglingKeyWarnings(lister, namespace)
+		if err != nil {
+			scan.warnings = append(scan.warnings, fmt.Sprintf("failed to check ConfigMap keys in namespace %s: %v", namespace, err))
+		}
+		scan.warnings = append(scan.warnings, danglingKeyWarnings...)
+	}
+	if workloads == nil {
+		return scan
+	}
+	annotations, err := workloads.ListWorkloadAnnotations(ctx, namespace)
+	if err != nil {
+		return namespaceCMScan{err: fmt.Errorf("failed to list workload annotations: %w", err)}
+	}
+	scan.used = append(scan.used, annotationReferences(annotations, opts.ReferenceAnnotationKeys, scan.candidates.names)...)
+	return scan
 }
 
 func GetUnusedConfigmaps(includeExcludeLists IncludeExcludeLists, filterOpts *FilterOptions, clientset kubernetes.Interface, outputFormat string, opts Opts) (string, error) {
+	var output bytes.Buffer
+	err := WriteUnusedConfigmaps(&output, includeExcludeLists, filterOpts, clientset, outputFormat, opts)
+	return output.String(), err
+}
+
+// WriteUnusedConfigmaps writes the unused ConfigMaps to w in outputFormat, such as a file, a network connection or
+// stdout. Nothing is written when the scan fails, the output is only rendered into w once every namespace is scanned.
+func WriteUnusedConfigmaps(w io.Writer, includeExcludeLists IncludeExcludeLists, filterOpts *FilterOptions, clientset kubernetes.Interface, outputFormat string, opts Opts) error {
+	warnings, err := writeUnusedConfigmaps(w, includeExcludeLists, filterOpts, clientset, outputFormat, opts)
+	printWarnings(warnings, opts)
+	return err
+}
+
+// printWarnings prints the warnings of a scan to stderr unless opts.QuietErrors is set
+func printWarnings(warnings []string, opts Opts) {
+	for _, warning := range warnings {
+		opts.printError("Warning: %s\n", warning)
+	}
+}
+
+// GetUnusedConfigmapsWithWarnings returns the unused ConfigMaps like GetUnusedConfigmaps along with the warnings of
+// the scan, such as namespaces that couldn't be scanned, instead of printing them. Warnings don't fail the scan.
+func GetUnusedConfigmapsWithWarnings(includeExcludeLists IncludeExcludeLists, filterOpts *FilterOptions, clientset kubernetes.Interface, outputFormat string, opts Opts) (string, []string, error) {
+	var output bytes.Buffer
+	warnings, err := writeUnusedConfigmaps(&output, includeExcludeLists, filterOpts, clientset, outputFormat, opts)
+	return output.String(), warnings, err
+}
+
+// writeUnusedConfigmaps scans the namespaces and renders the unused ConfigMaps into w, returning the warnings of the
+// scan
+func writeUnusedConfigmaps(w io.Writer, includeExcludeLists IncludeExcludeLists, filterOpts *FilterOptions, clientset kubernetes.Interface, outputFormat string, opts Opts) ([]string, error) {
+	startedAt := time.Now()
+	if opts.EmitDeleteCommands {
+		// the delete commands are printed instead of run
+		opts.DeleteFlag = false
+	}
 	var outputBuffer bytes.Buffer
-	namespaces := SetNamespaceList(includeExcludeLists, clientset)
-	response := make(map[string]map[string][]string)
+	var warnings []string
+	namespaces, err := SetNamespaceList(includeExcludeLists, clientset, opts)
+	if err != nil {
+		return warnings, err
+	}
+	if len(namespaces) == 0 {
+		// an empty report would otherwise read as no unused ConfigMaps
+		warnings = append(warnings, "no namespaces matched the include and exclude namespace filters, nothing was scanned")
+	}
+	if opts.Canonical {
+		sort.Strings(namespaces)
+	}
+	response := make(map[string]map[string]interface{})
+	deletionLimit := newDeletionLimit(opts)
 
-	for _, namespace := range namespaces {
-		diff, err := processNamespaceCM(clientset, namespace, filterOpts)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to process namespace %s: %v\n", namespace, err)
+	lister := newConfigMapScanLister(clientset, filterOpts, opts)
+	workloads := newWorkloadAnnotationsLister(clientset, opts)
+
+	if opts.DeletedWorkloadsWindow > 0 && opts.StateFile == "" {
+		return warnings, errors.New("the deleted workloads window requires a state file to record the configmaps referenced by workloads")
+	}
+	var state *OrphanState
+	if opts.StateFile != "" {
+		var err error
+		if state, err = LoadOrphanState(opts.StateFile); err != nil {
+			return warnings, err
+		}
+	}
+
+	var findingCluster string
+	if opts.FlatJSON || opts.IncludeResourcePaths || opts.IncludeResourceIdentity {
+		var err error
+		if findingCluster, err = resolveFindingCluster(clientset, opts); err != nil {
+			return warnings, err
+		}
+	}
+
+	var changedNamespaces map[string]bool
+	var resourceVersion string
+	if opts.SinceResourceVersion != "" {
+		var err error
+		if changedNamespaces, resourceVersion, err = ChangedNamespacesSince(clientset, opts.SinceResourceVersion); err != nil {
+			return warnings, err
+		}
+	}
+
+	if changedNamespaces != nil {
+		changed := make([]string, 0, len(namespaces))
+		for _, namespace := range namespaces {
+			if changedNamespaces[namespace] {
+				changed = append(changed, namespace)
+			}
+		}
+		namespaces = changed
+	}
+
+	clusterReferences, collectorWarnings := collectClusterReferences(clientset, opts)
+	warnings = append(warnings, collectorWarnings...)
+
+	scans := make([]namespaceCMScan, len(namespaces))
+	workers, offset := opts.Concurrency, 0
+	if opts.AutoConcurrency && len(namespaces) > 0 {
+		timed := newTimingLister(lister)
+		scans[0] = scanNamespaceCM(timed, workloads, namespaces[0], filterOpts, opts)
+		workers, offset = autoConcurrency(opts.QPS, timed.averageLatency(), opts.MaxConcurrency), 1
+	}
+	forEachNamespace(namespaces[offset:], workers, func(i int, namespace string) {
+		scans[offset+i] = scanNamespaceCM(lister, workloads, namespace, filterOpts, opts)
+	})
+
+	scannedConfigMaps := make(map[string][]string)
+	unusedConfigMaps := make(map[string][]string)
+	var protected []ProtectedResource
+	var kept []KeptReference
+	var totals ScanTotals
+	var emptiedNamespaces []string
+	var deletedConfigMaps []string
+	ownerCounts := make(map[string]int)
+	sourceFiles := make(map[string]map[string]string)
+
+	for i, namespace := range namespaces {
+		scan := scans[i]
+		if scan.err != nil {
+			warnings = append(warnings, fmt.Sprintf("failed to process namespace %s: %v", namespace, scan.err))
 			continue
 		}
+		if opts.ReportStaleExceptions {
+			scannedConfigMaps[namespace] = scan.scanned
+		}
+
+		usedConfigMaps := append(append([]string{}, scan.used...), clusterReferences[namespace]...)
+		warnings = append(warnings, scan.warnings...)
+
+		if opts.ReportProtected {
+			protected = append(protected, scan.candidates.protected...)
+		}
+		diff := CalculateResourceDifference(usedConfigMaps, scan.candidates.names)
+		used := CalculateResourceDifference(diff, scan.candidates.names)
+		if opts.DeletedWorkloadsWindow > 0 {
+			deleted, err := retrieveDeletedWorkloads(clientset, namespace, opts.DeletedWorkloadsWindow)
+			if err != nil {
+				return warnings, fmt.Errorf("failed to find the deleted workloads in namespace %s: %w", namespace, err)
+			}
+			references, err := workloadConfigMapReferences(clientset, namespace)
+			if err != nil {
+				return warnings, fmt.Errorf("failed to find the configmaps referenced by workloads in namespace %s: %w", namespace, err)
+			}
+			diff = filterDeletedWorkloadOrphans(diff, deleted, state.Workloads[namespace], references)
+			state.RecordWorkloads(namespace, references, scan.candidates.names)
+		} else if state != nil {
+			diff = state.FilterRecentlyOrphaned(namespace, diff)
+		}
+		if state != nil {
+			state.Record(namespace, used, scan.candidates.names)
+		}
+		if opts.Canonical {
+			sort.Strings(diff)
+			sort.Strings(used)
+		}
 
 		if opts.DeleteFlag {
-			if diff, err = DeleteResource(diff, clientset, namespace, "ConfigMap", opts.NoInteractive); err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to delete ConfigMap %s in namespace %s: %v\n", diff, namespace, err)
+			deletable, keptReferences := protectReferencedCM(namespace, diff, scan.candidates.heuristics, opts)
+			kept = append(kept, keptReferences...)
+			deletable, unselected := selectDeletionCandidatesCM(deletable, scan.candidates.deleteSelected)
+			var err error
+			if diff, err = deleteNamespaceResourcesWithIdentities(deletable, clientset, namespace, "ConfigMap", opts, deletionLimit, scan.candidates.identities); err != nil {
+				warnings = append(warnings, fmt.Sprintf("failed to delete ConfigMap %s in namespace %s: %v", diff, namespace, err))
+			}
+			diff = append(diff, unselected...)
+			for _, reference := range keptReferences {
+				diff = append(diff, reference.ResourceName+"-SKIPPED")
+			}
+			for _, entry := range diff {
+				if strings.HasSuffix(entry, "-DELETED") {
+					deletedConfigMaps = append(deletedConfigMaps, namespace+"/"+resourceNameFromDiff(entry))
+				}
 			}
 		}
-		output := FormatOutput(namespace, diff, "Configmaps")
+		if opts.DeleteFlag && (opts.ReportEmptiedNamespaces || opts.DeleteEmptiedNamespaces) {
+			emptied, err := cleanupEmptiedNamespace(clientset, namespace, diff, opts)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("failed to clean up namespace %s: %v", namespace, err))
+			}
+			if emptied {
+				emptiedNamespaces = append(emptiedNamespaces, namespace)
+			}
+		}
+		totals.NamespacesScanned++
+		totals.Unused += len(diff)
+		if len(diff) > 0 {
+			totals.NamespacesWithFindings++
+		} else if opts.OmitEmptyNamespaces {
+			continue
+		}
+
+		var ages []string
+		if opts.ShowAge {
+			ages = configMapAges(diff, scan.candidates.identities, startedAt, opts.TimeFormat)
+		}
+		output, err := formatOutputWithAges(namespace, diff, "Configmaps", ages, opts)
+		if err != nil {
+			return warnings, err
+		}
 		outputBuffer.WriteString(output)
 		outputBuffer.WriteString("\n")
+		if opts.IncludeUsed && len(used) > 0 {
+			outputBuffer.WriteString(FormatUsedOutput(namespace, used, "Configmaps"))
+			outputBuffer.WriteString("\n")
+		}
 
-		resourceMap := make(map[string][]string)
+		resourceMap := make(map[string]interface{})
 		resourceMap["ConfigMap"] = diff
+		if opts.IncludeResourcePaths || opts.IncludeResourceIdentity {
+			resourceMap["ConfigMap"] = configMapFindings(findingCluster, namespace, diff, scan.candidates.identities, opts)
+		}
+		if opts.IncludeUsed {
+			resourceMap["used"] = used
+		}
+		if opts.CategorizeEmpty {
+			resourceMap["categories"] = categorizeConfigMaps(diff, used, scan.candidates.empty)
+		}
+		if opts.OwnerLabelKey != "" {
+			owners := resourceOwners(diff, scan.candidates.owners)
+			for _, owner := range owners {
+				ownerCounts[owner]++
+			}
+			resourceMap["owners"] = owners
+		}
 		response[namespace] = resourceMap
+		unusedConfigMaps[namespace] = diff
+		sourceFiles[namespace] = scan.candidates.sourceFiles
 	}
 
-	jsonResponse, err := json.MarshalIndent(response, "", "  ")
-	if err != nil {
-		return "", err
+	if state != nil {
+		if err := state.Save(opts.StateFile); err != nil {
+			return warnings, err
+		}
 	}
 
-	unusedCMs, err := unusedResourceFormatter(outputFormat, outputBuffer, opts, jsonResponse)
-	if err != nil {
-		fmt.Printf("err: %v\n", err)
+	if opts.DeletedListFile != "" {
+		if err := writeDeletedListFile(opts.DeletedListFile, deletedConfigMaps); err != nil {
+			return warnings, err
+		}
+	}
+
+	if opts.PrometheusTextfile != "" {
+		if err := writePrometheusTextfile(opts.PrometheusTextfile, "ConfigMap", unusedConfigMaps); err != nil {
+			return warnings, err
+		}
+	}
+
+	if opts.SinceResourceVersion != "" {
+		outputBuffer.WriteString(fmt.Sprintf("Resource version for the next scan: %s\n", resourceVersion))
+	}
+
+	envelope := unusedResourceEnvelope{Cluster: opts.ClusterInfo, ResourceVersion: resourceVersion, Namespaces: response}
+	if opts.FlatJSON {
+		envelope.Namespaces = flattenFindings(findingCluster, "ConfigMap", unusedConfigMaps)
+	}
+	if opts.ReportStaleExceptions {
+		envelope.StaleExceptions = staleExceptions(exceptionconfigmaps, scannedConfigMaps)
+		outputBuffer.WriteString(FormatStaleExceptions(envelope.StaleExceptions))
 	}
 
-	return unusedCMs, nil
+	if opts.ReportProtected {
+		envelope.Protected = protected
+		outputBuffer.WriteString(FormatProtectedResources(protected))
+	}
+
+	if len(kept) > 0 {
+		envelope.Kept = kept
+		outputBuffer.WriteString(FormatKeptReferences(kept))
+	}
+
+	if opts.OwnerLabelKey != "" {
+		envelope.Owners = summarizeOwners(ownerCounts)
+		outputBuffer.WriteString(FormatOwnerSummary(envelope.Owners))
+	}
+
+	if opts.IncludeScanMetadata {
+		envelope.Metadata = newScanMetadata(startedAt, opts, filterOpts)
+	}
+	envelope.Warnings = warnings
+	if len(emptiedNamespaces) > 0 {
+		envelope.EmptiedNamespaces = emptiedNamespaces
+		outputBuffer.WriteString(FormatEmptiedNamespaces(emptiedNamespaces))
+	}
+	if opts.OmitEmptyNamespaces {
+		envelope.Totals = &totals
+		outputBuffer.WriteString(fmt.Sprintf("Scanned %d namespaces, %d with unused ConfigMaps (%d in total)\n", totals.NamespacesScanned, totals.NamespacesWithFindings, totals.Unused))
+	}
+
+	wrap := opts.ClusterInfo != nil || opts.SinceResourceVersion != "" || opts.ReportStaleExceptions || opts.ReportProtected || opts.OwnerLabelKey != "" || opts.IncludeScanMetadata || opts.OmitEmptyNamespaces || len(emptiedNamespaces) > 0 || len(kept) > 0
+	// a json report only returned is encoded straight into w, otherwise it is held in memory for the other uses
+	var jsonResponse []byte
+	streamJSON := outputFormat == "json" && !opts.EmitDeleteCommands && !opts.GitHubAnnotations && opts.ReportWebhookURL == "" && len(opts.OutputTargets) == 0
+	if !streamJSON {
+		var err error
+		if jsonResponse, err = marshalEnvelope(envelope, wrap); err != nil {
+			return warnings, err
+		}
+	}
+	if err := postReportIfConfigured(opts, jsonResponse); err != nil {
+		return warnings, err
+	}
+
+	render := func(format string, opts Opts) (string, error) {
+		if renderFindings, ok := findingRenderers[format]; ok {
+			output, err := renderFindings("ConfigMap", unusedConfigMaps, startedAt)
+			if err != nil {
+				return "", err
+			}
+			return sendTextOutput(opts, output)
+		}
+		return unusedResourceFormatter(format, outputBuffer, opts, jsonResponse)
+	}
+	// only the returned output is sent to Slack
+	targetOpts := opts
+	targetOpts.WebhookURL, targetOpts.Channel, targetOpts.Token = "", "", ""
+	for _, target := range opts.OutputTargets {
+		output, err := render(target.Format, targetOpts)
+		if err != nil {
+			return warnings, err
+		}
+		if err := target.write(output); err != nil {
+			return warnings, err
+		}
+	}
+
+	// the report webhook and the output targets get the full report whichever form the output takes
+	var output string
+	switch {
+	case streamJSON:
+		return warnings, encodeEnvelope(w, envelope, wrap)
+	case opts.EmitDeleteCommands:
+		output, err = sendTextOutput(opts, formatDeleteCommands("configmap", unusedConfigMaps, opts))
+	case opts.GitHubAnnotations:
+		output, err = sendTextOutput(opts, formatGitHubAnnotations("ConfigMap", unusedConfigMaps, func(namespace, name string) string {
+			if file := sourceFiles[namespace][name]; file != "" {
+				return file
+			}
+			return configMapPath(namespace, name)
+		}))
+	default:
+		output, err = render(outputFormat, opts)
+	}
+	if err != nil {
+		return warnings, err
+	}
+	_, err = io.WriteString(w, output)
+	return warnings, err
 }
@@ -0,0 +1,69 @@
+package kor
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// configMapKeyReference is a reference from a pod to a single key of a ConfigMap
+type configMapKeyReference struct {
+	pod       string
+	configMap string
+	key       string
+}
+
+// podConfigMapKeyReferences returns the ConfigMap keys the pod requires through volume items and env vars.
+// Optional references are left out since a missing key is expected for them.
+func podConfigMapKeyReferences(pod corev1.Pod) []configMapKeyReference {
+	var references []configMapKeyReference
+	for _, ref := range extractConfigMapRefs(&pod.Spec) {
+		if ref.optional {
+			continue
+		}
+		if ref.key != "" {
+			references = append(references, configMapKeyReference{pod: pod.Name, configMap: ref.name, key: ref.key})
+		}
+		for _, item := range ref.items {
+			references = append(references, configMapKeyReference{pod: pod.Name, configMap: ref.name, key: item.Key})
+		}
+	}
+	return references
+}
+
+// retrieveDanglingKeyWarnings returns a warning for each key referenced by a pod that is missing from an existing
+// ConfigMap of the namespace. References to missing ConfigMaps are left to Kubernetes, which fails the pod.
+func retrieveDanglingKeyWarnings(lister ResourceLister, namespace string) ([]string, error) {
+	pods, err := lister.ListPods(context.TODO(), namespace, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrListPods, err)
+	}
+	configmaps, err := lister.ListConfigMaps(context.TODO(), namespace, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrListConfigMaps, err)
+	}
+
+	keys := make(map[string]map[string]bool, len(configmaps.Items))
+	for _, configmap := range configmaps.Items {
+		keys[configmap.Name] = make(map[string]bool, len(configmap.Data)+len(configmap.BinaryData))
+		for key := range configmap.Data {
+			keys[configmap.Name][key] = true
+		}
+		for key := range configmap.BinaryData {
+			keys[configmap.Name][key] = true
+		}
+	}
+
+	var warnings []string
+	for _, pod := range pods.Items {
+		for _, reference := range podConfigMapKeyReferences(pod) {
+			configMapKeys, exists := keys[reference.configMap]
+			if exists && !configMapKeys[reference.key] {
+				warnings = append(warnings, fmt.Sprintf("pod %s in namespace %s references missing key %q of ConfigMap %s", reference.pod, namespace, reference.key, reference.configMap))
+			}
+		}
+	}
+	return warnings, nil
+}
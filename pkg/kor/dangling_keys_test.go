@@ -0,0 +1,51 @@
+package kor
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRetrieveDanglingKeyWarnings(t *testing.T) {
+	optional := true
+	pod := CreateTestPod(testNamespace, "pod-1", "", []corev1.Volume{
+		{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "configmap-1"},
+			Items:                []corev1.KeyToPath{{Key: "app.yaml", Path: "app.yaml"}, {Key: "missing.yaml", Path: "missing.yaml"}},
+		}}},
+		{Name: "optional", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "configmap-1"},
+			Items:                []corev1.KeyToPath{{Key: "optional.yaml", Path: "optional.yaml"}},
+			Optional:             &optional,
+		}}},
+	})
+	pod.Spec.Containers = []corev1.Container{{
+		Name: "app",
+		Env: []corev1.EnvVar{{Name: "LOG_LEVEL", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "configmap-1"},
+			Key:                  "log-level",
+		}}}},
+	}}
+	lister := &staticResourceLister{
+		pods: []corev1.Pod{*pod},
+		configmaps: []corev1.ConfigMap{{
+			ObjectMeta: metav1.ObjectMeta{Name: "configmap-1", Namespace: testNamespace},
+			Data:       map[string]string{"app.yaml": "key: value"},
+		}},
+	}
+
+	warnings, err := retrieveDanglingKeyWarnings(lister, testNamespace)
+	if err != nil {
+		t.Fatalf("Error checking ConfigMap keys: %v", err)
+	}
+
+	expected := []string{
+		`pod pod-1 in namespace test-namespace references missing key "missing.yaml" of ConfigMap configmap-1`,
+		`pod pod-1 in namespace test-namespace references missing key "log-level" of ConfigMap configmap-1`,
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("Expected warnings %v, got %v", expected, warnings)
+	}
+}
@@ -2,85 +2,463 @@ package kor
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"sort"
 	"strings"
 
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
 )
 
 func DeleteResourceCmd() map[string]func(clientset kubernetes.Interface, namespace, name string) error {
-	var deleteResourceApiMap = map[string]func(clientset kubernetes.Interface, namespace, name string) error{
-		"ConfigMap": func(clientset kubernetes.Interface, namespace, name string) error {
-			return clientset.CoreV1().ConfigMaps(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+	return deleteResourceCmdWithOptions(metav1.DeleteOptions{})
+}
+
+// namespacedResourceClient gets, deletes and patches the resources of one type in a namespace
+type namespacedResourceClient interface {
+	get(name string) error
+	delete(name string, deleteOptions metav1.DeleteOptions) error
+	patch(name string, patch []byte) error
+}
+
+// typedClient is the part of the typed clients of client-go namespacedResourceClient is built on, T is the
+// resource type they return
+type typedClient[T any] interface {
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (T, error)
+	Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (T, error)
+}
+
+// typedResourceClient adapts a typed client to namespacedResourceClient, patching with merge patches
+type typedResourceClient[T any] struct {
+	client typedClient[T]
+}
+
+func (c typedResourceClient[T]) get(name string) error {
+	_, err := c.client.Get(context.TODO(), name, metav1.GetOptions{})
+	return err
+}
+
+func (c typedResourceClient[T]) delete(name string, deleteOptions metav1.DeleteOptions) error {
+	return c.client.Delete(context.TODO(), name, deleteOptions)
+}
+
+func (c typedResourceClient[T]) patch(name string, patch []byte) error {
+	_, err := c.client.Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// resourceClientCmd returns the client of each resource type, the delete, get and patch calls are derived from it
+func resourceClientCmd() map[string]func(clientset kubernetes.Interface, namespace string) namespacedResourceClient {
+	return map[string]func(clientset kubernetes.Interface, namespace string) namespacedResourceClient{
+		"ConfigMap": func(clientset kubernetes.Interface, namespace string) namespacedResourceClient {
+			return typedResourceClient[*corev1.ConfigMap]{clientset.CoreV1().ConfigMaps(namespace)}
 		},
-		"Secret": func(clientset kubernetes.Interface, namespace, name string) error {
-			return clientset.CoreV1().Secrets(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+		"Secret": func(clientset kubernetes.Interface, namespace string) namespacedResourceClient {
+			return typedResourceClient[*corev1.Secret]{clientset.CoreV1().Secrets(namespace)}
 		},
-		"Service": func(clientset kubernetes.Interface, namespace, name string) error {
-			return clientset.CoreV1().Services(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+		"Service": func(clientset kubernetes.Interface, namespace string) namespacedResourceClient {
+			return typedResourceClient[*corev1.Service]{clientset.CoreV1().Services(namespace)}
 		},
-		"Deployment": func(clientset kubernetes.Interface, namespace, name string) error {
-			return clientset.AppsV1().Deployments(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+		"Deployment": func(clientset kubernetes.Interface, namespace string) namespacedResourceClient {
+			return typedResourceClient[*appsv1.Deployment]{clientset.AppsV1().Deployments(namespace)}
 		},
-		"HPA": func(clientset kubernetes.Interface, namespace, name string) error {
-			return clientset.AutoscalingV1().HorizontalPodAutoscalers(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+		"HPA": func(clientset kubernetes.Interface, namespace string) namespacedResourceClient {
+			return typedResourceClient[*autoscalingv1.HorizontalPodAutoscaler]{clientset.AutoscalingV1().HorizontalPodAutoscalers(namespace)}
 		},
-		"Ingress": func(clientset kubernetes.Interface, namespace, name string) error {
-			return clientset.NetworkingV1beta1().Ingresses(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+		"Ingress": func(clientset kubernetes.Interface, namespace string) namespacedResourceClient {
+			return typedResourceClient[*networkingv1beta1.Ingress]{clientset.NetworkingV1beta1().Ingresses(namespace)}
 		},
-		"PDB": func(clientset kubernetes.Interface, namespace, name string) error {
-			return clientset.PolicyV1beta1().PodDisruptionBudgets(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+		"PDB": func(clientset kubernetes.Interface, namespace string) namespacedResourceClient {
+			return typedResourceClient[*policyv1beta1.PodDisruptionBudget]{clientset.PolicyV1beta1().PodDisruptionBudgets(namespace)}
 		},
-		"Roles": func(clientset kubernetes.Interface, namespace, name string) error {
-			return clientset.RbacV1().Roles(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+		"Roles": func(clientset kubernetes.Interface, namespace string) namespacedResourceClient {
+			return typedResourceClient[*rbacv1.Role]{clientset.RbacV1().Roles(namespace)}
 		},
-		"PVC": func(clientset kubernetes.Interface, namespace, name string) error {
-			return clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+		"PVC": func(clientset kubernetes.Interface, namespace string) namespacedResourceClient {
+			return typedResourceClient[*corev1.PersistentVolumeClaim]{clientset.CoreV1().PersistentVolumeClaims(namespace)}
 		},
-		"StatefulSet": func(clientset kubernetes.Interface, namespace, name string) error {
-			return clientset.AppsV1().StatefulSets(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+		"StatefulSet": func(clientset kubernetes.Interface, namespace string) namespacedResourceClient {
+			return typedResourceClient[*appsv1.StatefulSet]{clientset.AppsV1().StatefulSets(namespace)}
 		},
-		"ServiceAccount": func(clientset kubernetes.Interface, namespace, name string) error {
-			return clientset.CoreV1().ServiceAccounts(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+		"ServiceAccount": func(clientset kubernetes.Interface, namespace string) namespacedResourceClient {
+			return typedResourceClient[*corev1.ServiceAccount]{clientset.CoreV1().ServiceAccounts(namespace)}
 		},
 	}
+}
 
+// deleteResourceCmdWithOptions returns the delete calls of each resource type, sending deleteOptions with every call
+func deleteResourceCmdWithOptions(deleteOptions metav1.DeleteOptions) map[string]func(clientset kubernetes.Interface, namespace, name string) error {
+	deleteResourceApiMap := make(map[string]func(clientset kubernetes.Interface, namespace, name string) error)
+	for resourceType, resourceClient := range resourceClientCmd() {
+		resourceClient := resourceClient
+		deleteResourceApiMap[resourceType] = func(clientset kubernetes.Interface, namespace, name string) error {
+			return resourceClient(clientset, namespace).delete(name, deleteOptions)
+		}
+	}
 	return deleteResourceApiMap
 }
 
+// removeFinalizers clears the finalizers of the resource with a merge patch. A known uid is part of the patch,
+// so the apiserver rejects it if the resource was recreated since it was listed.
+func removeFinalizers(clientset kubernetes.Interface, namespace, resourceType, name string, uid types.UID) error {
+	resourceClient, exists := resourceClientCmd()[resourceType]
+	if !exists {
+		return fmt.Errorf("removing the finalizers of %s resources is not supported", resourceType)
+	}
+
+	metadata := map[string]interface{}{"finalizers": nil}
+	if uid != "" {
+		metadata["uid"] = uid
+	}
+	patch, err := json.Marshal(map[string]interface{}{"metadata": metadata})
+	if err != nil {
+		return err
+	}
+	return resourceClient(clientset, namespace).patch(name, patch)
+}
+
+// deleteResourceWithRetry retries the deletion on conflict, re-fetching the resource before each retry.
+// A resource that no longer exists is considered deleted. With preconditions a conflict means they failed,
+// so the deletion isn't retried.
+func deleteResourceWithRetry(clientset kubernetes.Interface, namespace, resourceType, name string, deleteOptions metav1.DeleteOptions) error {
+	resourceClient := resourceClientCmd()[resourceType](clientset, namespace)
+
+	if deleteOptions.Preconditions != nil {
+		err := resourceClient.delete(name, deleteOptions)
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	attempt := 0
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if attempt > 0 {
+			if err := resourceClient.get(name); err != nil {
+				return err
+			}
+		}
+		attempt++
+		return resourceClient.delete(name, deleteOptions)
+	})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// newDeleteOptions returns the delete options for the propagation policy chosen in opts
+func newDeleteOptions(opts Opts) metav1.DeleteOptions {
+	if opts.PropagationPolicy == "" {
+		return metav1.DeleteOptions{}
+	}
+	propagationPolicy := metav1.DeletionPropagation(opts.PropagationPolicy)
+	return metav1.DeleteOptions{PropagationPolicy: &propagationPolicy}
+}
+
+// formatDeleteCommands returns a kubectl delete command for each unused resource, sorted by namespace and name,
+// so the deletions can be reviewed and run outside of kor
+func formatDeleteCommands(resource string, unused map[string][]string, opts Opts) string {
+	namespaces := make([]string, 0, len(unused))
+	for namespace := range unused {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	cascade := ""
+	if opts.PropagationPolicy != "" {
+		cascade = " --cascade=" + strings.ToLower(opts.PropagationPolicy)
+	}
+
+	var buf strings.Builder
+	for _, namespace := range namespaces {
+		names := append([]string{}, unused[namespace]...)
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&buf, "kubectl delete %s %s -n %s%s\n", resource, name, namespace, cascade)
+		}
+	}
+	return buf.String()
+}
+
+// writeDeletedListFile replaces the file at path with the deleted resources, one namespace/name per line
+func writeDeletedListFile(path string, deleted []string) error {
+	var buf strings.Builder
+	for _, resource := range deleted {
+		buf.WriteString(resource)
+		buf.WriteString("\n")
+	}
+	if err := os.WriteFile(path, []byte(buf.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write deleted list file %s: %w", path, err)
+	}
+	return nil
+}
+
+// newDeletionLimit returns the deletion budget shared by every namespace of a run, or nil when deletions are unlimited
+func newDeletionLimit(opts Opts) *int {
+	if opts.MaxDeletions <= 0 {
+		return nil
+	}
+	remaining := opts.MaxDeletions
+	return &remaining
+}
+
+// confirmationInput is where interactive confirmations are read from
+var confirmationInput io.Reader = os.Stdin
+
+// readConfirmation reads an answer from confirmationInput, reporting whether it is y or yes. An answer that can't
+// be read is printed with printError and is a no.
+func readConfirmation(printError func(format string, args ...interface{})) bool {
+	var confirmation string
+	if _, err := fmt.Fscanln(confirmationInput, &confirmation); err != nil {
+		printError("Failed to read input: %v\n", err)
+		return false
+	}
+	confirmation = strings.ToLower(confirmation)
+	return confirmation == "y" || confirmation == "yes"
+}
+
+// confirmNamespaceDeletion lists the resources to delete in the namespace and asks for a single confirmation
+func confirmNamespaceDeletion(diff []string, namespace, resourceType string, opts Opts) bool {
+	fmt.Fprintf(opts.stdout(), "The following %s resources in namespace %s will be deleted:\n", resourceType, namespace)
+	for _, resourceName := range diff {
+		fmt.Fprintf(opts.stdout(), "  - %s\n", resourceName)
+	}
+	fmt.Fprintf(opts.stdout(), "Do you want to delete all of them? (Y/N): ")
+	return readConfirmation(opts.printError)
+}
+
+// deleteNamespaceResources deletes the unused resources of a namespace according to opts
+func deleteNamespaceResources(diff []string, clientset kubernetes.Interface, namespace, resourceType string, opts Opts, deletionLimit *int) ([]string, error) {
+	return deleteNamespaceResourcesWithIdentities(diff, clientset, namespace, resourceType, opts, deletionLimit, nil)
+}
+
+// deleteNamespaceResourcesWithIdentities deletes the unused resources like deleteNamespaceResources, only deleting
+// the resources with an identity if they still have the UID they were listed with
+func deleteNamespaceResourcesWithIdentities(diff []string, clientset kubernetes.Interface, namespace, resourceType string, opts Opts, deletionLimit *int, identities map[string]ResourceIdentity) ([]string, error) {
+	r := resourceDeleter{clientset: clientset, namespace: namespace, resourceType: resourceType, deleteOptions: newDeleteOptions(opts), identities: identities, forceRemoveFinalizers: opts.ForceRemoveFinalizers, backupDir: opts.BackupDir, requireBackup: opts.RequireBackup, stdout: opts.stdout(), printError: opts.printError}
+	switch {
+	case opts.NoInteractive:
+		return r.deleteConcurrently(diff, deletionLimit, opts.DeleteConcurrency)
+	case opts.ConfirmEachNamespace:
+		if len(diff) == 0 || !confirmNamespaceDeletion(diff, namespace, resourceType, opts) {
+			return diff, nil
+		}
+		return r.deleteConcurrently(diff, deletionLimit, opts.DeleteConcurrency)
+	default:
+		return r.delete(diff, false, deletionLimit)
+	}
+}
+
+// resourceDeleter deletes resources of a single type in a namespace
+type resourceDeleter struct {
+	clientset     kubernetes.Interface
+	namespace     string
+	resourceType  string
+	deleteOptions metav1.DeleteOptions
+	// identities are the UIDs resources were listed with, a resource without one is deleted unconditionally
+	identities map[string]ResourceIdentity
+	// forceRemoveFinalizers removes the finalizers of resources listed with some before deleting them
+	forceRemoveFinalizers bool
+	// backupDir is where ConfigMaps are backed up before deleting them, empty writes no backups. requireBackup
+	// leaves the ConfigMaps whose backup failed in place.
+	backupDir     string
+	requireBackup bool
+	// stdout is where progress messages and prompts are printed
+	stdout io.Writer
+	// printError prints the errors that don't fail the deletion
+	printError func(format string, args ...interface{})
+}
+
+// deleteOne deletes the resource and returns its diff entry: suffixed with -DELETED when deleted, with -SKIPPED
+// when it was recreated since it was listed, with -UNDELETABLE when it has finalizers that may not be removed,
+// or empty when the deletion or a required backup failed
+func (r resourceDeleter) deleteOne(resourceName string) string {
+	identity := r.identities[resourceName]
+	deleteOptions := r.deleteOptions
+	if uid := identity.UID; uid != "" {
+		deleteOptions.Preconditions = &metav1.Preconditions{UID: &uid}
+	}
+
+	if len(identity.Finalizers) > 0 && !r.forceRemoveFinalizers {
+		r.printError("Not deleting %s %s in namespace %s: it has finalizers %s, use --force-remove-finalizers to remove them\n", r.resourceType, resourceName, r.namespace, strings.Join(identity.Finalizers, ", "))
+		return resourceName + "-UNDELETABLE"
+	}
+
+	// only resources about to be deleted are backed up
+	if r.backupDir != "" && r.resourceType == "ConfigMap" {
+		if err := backupConfigMap(r.clientset, r.backupDir, r.namespace, resourceName); err != nil {
+			if r.requireBackup {
+				r.printError("Not deleting %s %s in namespace %s: %v\n", r.resourceType, resourceName, r.namespace, err)
+				return ""
+			}
+			r.printError("Deleting %s %s in namespace %s without a backup: %v\n", r.resourceType, resourceName, r.namespace, err)
+		}
+	}
+
+	fmt.Fprintf(r.stdout, "Deleting %s %s in namespace %s\n", r.resourceType, resourceName, r.namespace)
+	err := deleteResourceWithRetry(r.clientset, r.namespace, r.resourceType, resourceName, deleteOptions)
+	if err != nil && deleteOptions.Preconditions != nil && errors.IsConflict(err) {
+		r.printError("Skipping %s %s in namespace %s: it was recreated since it was found unused\n", r.resourceType, resourceName, r.namespace)
+		return resourceName + "-SKIPPED"
+	}
+	if err != nil {
+		r.printError("Failed to delete %s %s in namespace %s: %v\n", r.resourceType, resourceName, r.namespace, err)
+		return ""
+	}
+
+	// the finalizers are only removed once the deletion was accepted, so a failed deletion leaves them in place
+	if len(identity.Finalizers) > 0 {
+		fmt.Fprintf(r.stdout, "Removing finalizers of %s %s in namespace %s\n", r.resourceType, resourceName, r.namespace)
+		if err := removeFinalizers(r.clientset, r.namespace, r.resourceType, resourceName, identity.UID); err != nil && !errors.IsNotFound(err) {
+			r.printError("Failed to remove finalizers of %s %s in namespace %s, it waits on them to be deleted: %v\n", r.resourceType, resourceName, r.namespace, err)
+			return ""
+		}
+	}
+	return resourceName + "-DELETED"
+}
+
+// deferredMessage is a progress message or, with isError, an error message of a deletion
+type deferredMessage struct {
+	text    string
+	isError bool
+}
+
+// deferredOutput records the messages of a deletion, as its stdout and printError, to print them later
+type deferredOutput struct {
+	messages []deferredMessage
+}
+
+func (o *deferredOutput) Write(p []byte) (int, error) {
+	o.messages = append(o.messages, deferredMessage{text: string(p)})
+	return len(p), nil
+}
+
+func (o *deferredOutput) printError(format string, args ...interface{}) {
+	o.messages = append(o.messages, deferredMessage{text: fmt.Sprintf(format, args...), isError: true})
+}
+
+// replay prints the recorded messages in the order they were recorded
+func (o *deferredOutput) replay(stdout io.Writer, printError func(format string, args ...interface{})) {
+	for _, message := range o.messages {
+		if message.isError {
+			printError("%s", message.text)
+		} else {
+			fmt.Fprint(stdout, message.text)
+		}
+	}
+}
+
+// deleteConcurrently deletes the resources without prompting using up to workers goroutines, the client
+// rate limit still applies. The deletion budget is split up front: the resources past it are reported with a
+// -SKIPPED suffix and failed deletions don't free up budget for them. Results are in the order of diff.
+func (r resourceDeleter) deleteConcurrently(diff []string, remaining *int, workers int) ([]string, error) {
+	if workers < 2 {
+		return r.delete(diff, true, remaining)
+	}
+	if _, exists := DeleteResourceCmd()[r.resourceType]; !exists {
+		r.printError("Resource type '%s' is not supported\n", r.resourceType)
+		return []string{}, nil
+	}
+
+	candidates := diff
+	if remaining != nil && *remaining < len(diff) {
+		candidates = diff[:0]
+		if *remaining > 0 {
+			candidates = diff[:*remaining]
+		}
+	}
+
+	// the workers share r.stdout, which may not be safe for concurrent use, so their messages are printed in
+	// the order of diff once they are done
+	results := make([]string, len(candidates))
+	outputs := make([]deferredOutput, len(candidates))
+	forEachNamespace(candidates, workers, func(i int, resourceName string) {
+		worker := r
+		worker.stdout, worker.printError = &outputs[i], outputs[i].printError
+		results[i] = worker.deleteOne(resourceName)
+	})
+	for i := range outputs {
+		outputs[i].replay(r.stdout, r.printError)
+	}
+
+	deletedDiff := []string{}
+	for _, result := range results {
+		if result == "" {
+			continue
+		}
+		deletedDiff = append(deletedDiff, result)
+		if remaining != nil && strings.HasSuffix(result, "-DELETED") {
+			*remaining--
+		}
+	}
+	for _, resourceName := range diff[len(candidates):] {
+		deletedDiff = append(deletedDiff, resourceName+"-SKIPPED")
+	}
+	return deletedDiff, nil
+}
+
 func DeleteResource(diff []string, clientset kubernetes.Interface, namespace, resourceType string, noInteractive bool) ([]string, error) {
+	return DeleteResourceWithLimit(diff, clientset, namespace, resourceType, noInteractive, nil)
+}
+
+// DeleteResourceWithLimit deletes resources like DeleteResource while decrementing remaining for each deletion.
+// Once remaining reaches zero the other resources are reported with a -SKIPPED suffix and left in place.
+// A nil remaining applies no limit.
+func DeleteResourceWithLimit(diff []string, clientset kubernetes.Interface, namespace, resourceType string, noInteractive bool, remaining *int) ([]string, error) {
+	return DeleteResourceWithOpts(diff, clientset, namespace, resourceType, Opts{NoInteractive: noInteractive}, remaining)
+}
+
+// DeleteResourceWithOpts deletes resources like DeleteResourceWithLimit with the delete and confirmation options of
+// opts, printing messages and prompts to its outputs
+func DeleteResourceWithOpts(diff []string, clientset kubernetes.Interface, namespace, resourceType string, opts Opts, remaining *int) ([]string, error) {
+	return deleteNamespaceResources(diff, clientset, namespace, resourceType, opts, remaining)
+}
+
+func (r resourceDeleter) delete(diff []string, noInteractive bool, remaining *int) ([]string, error) {
+	resourceType, namespace := r.resourceType, r.namespace
 	deletedDiff := []string{}
 
 	for _, resourceName := range diff {
-		deleteFunc, exists := DeleteResourceCmd()[resourceType]
-		if !exists {
-			fmt.Printf("Resource type '%s' is not supported\n", resourceName)
+		if remaining != nil && *remaining <= 0 {
+			deletedDiff = append(deletedDiff, resourceName+"-SKIPPED")
 			continue
 		}
 
-		if !noInteractive {
-			fmt.Printf("Do you want to delete %s %s in namespace %s? (Y/N): ", resourceType, resourceName, namespace)
-			var confirmation string
-			_, err := fmt.Scanf("%s", &confirmation)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to read input: %v\n", err)
-				continue
-			}
+		if _, exists := DeleteResourceCmd()[resourceType]; !exists {
+			r.printError("Resource type '%s' is not supported\n", resourceType)
+			continue
+		}
 
-			if strings.ToLower(confirmation) != "y" && strings.ToLower(confirmation) != "yes" {
+		if !noInteractive {
+			fmt.Fprintf(r.stdout, "Do you want to delete %s %s in namespace %s? (Y/N): ", resourceType, resourceName, namespace)
+			if !readConfirmation(r.printError) {
 				deletedDiff = append(deletedDiff, resourceName)
 				continue
 			}
 		}
 
-		fmt.Printf("Deleting %s %s in namespace %s\n", resourceType, resourceName, namespace)
-		if err := deleteFunc(clientset, namespace, resourceName); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to delete %s %s in namespace %s: %v\n", resourceType, resourceName, namespace, err)
+		result := r.deleteOne(resourceName)
+		if result == "" {
 			continue
 		}
-		deletedDiff = append(deletedDiff, resourceName+"-DELETED")
+		deletedDiff = append(deletedDiff, result)
+		if remaining != nil && strings.HasSuffix(result, "-DELETED") {
+			*remaining--
+		}
 	}
 
 	return deletedDiff, nil
@@ -1,9 +1,25 @@
 package kor
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
 )
 
 func TestDeleteResource(t *testing.T) {
@@ -20,7 +36,7 @@ func TestDeleteResource(t *testing.T) {
 			name:          "Test deletion confirmation",
 			diff:          []string{"resource1", "resource2"},
 			resourceType:  "ConfigMap",
-			expectedDiff:  []string{"resource1-DELETED", "resource2"},
+			expectedDiff:  []string{"resource1-DELETED", "resource2-DELETED"},
 			expectedError: false,
 		},
 	}
@@ -37,3 +53,535 @@ func TestDeleteResource(t *testing.T) {
 		})
 	}
 }
+
+func TestDeleteResourceWithLimit(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	candidates := []string{"configmap-1", "configmap-2", "configmap-3"}
+	for _, name := range candidates {
+		_, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), CreateTestConfigmap(testNamespace, name), metav1.CreateOptions{})
+		if err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+
+	remaining := 2
+	deletedDiff, err := DeleteResourceWithLimit(candidates, clientset, testNamespace, "ConfigMap", true, &remaining)
+	if err != nil {
+		t.Fatalf("Error deleting resources: %v", err)
+	}
+
+	expectedDiff := []string{"configmap-1-DELETED", "configmap-2-DELETED", "configmap-3-SKIPPED"}
+	if !reflect.DeepEqual(deletedDiff, expectedDiff) {
+		t.Errorf("Expected: %v, Got: %v", expectedDiff, deletedDiff)
+	}
+	if remaining != 0 {
+		t.Errorf("Expected deletion budget to be exhausted, %d left", remaining)
+	}
+
+	configmaps, err := clientset.CoreV1().ConfigMaps(testNamespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Error listing configmaps: %v", err)
+	}
+	if len(configmaps.Items) != 1 || configmaps.Items[0].Name != "configmap-3" {
+		t.Errorf("Expected only configmap-3 to remain, got %v", configmaps.Items)
+	}
+}
+
+func TestDeleteResourceRetryOnConflict(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	_, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), CreateTestConfigmap(testNamespace, "configmap-1"), metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Error creating fake configmap: %v", err)
+	}
+
+	conflicts := 0
+	clientset.PrependReactor("delete", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts == 0 {
+			conflicts++
+			return true, nil, errors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "configmap-1", nil)
+		}
+		return false, nil, nil
+	})
+
+	deletedDiff, err := DeleteResource([]string{"configmap-1"}, clientset, testNamespace, "ConfigMap", true)
+	if err != nil {
+		t.Fatalf("Error deleting resources: %v", err)
+	}
+	if !reflect.DeepEqual(deletedDiff, []string{"configmap-1-DELETED"}) {
+		t.Errorf("Expected configmap-1 to be deleted after a conflict, got %v", deletedDiff)
+	}
+
+	gets := 0
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "get" {
+			gets++
+		}
+	}
+	if gets != 1 {
+		t.Errorf("Expected the configmap to be re-fetched once before retrying, got %d gets", gets)
+	}
+
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Get(context.TODO(), "configmap-1", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("Expected configmap-1 to be deleted, got %v", err)
+	}
+}
+
+func TestDeleteNamespaceResourcesPropagationPolicy(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	_, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), CreateTestConfigmap(testNamespace, "configmap-1"), metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Error creating fake configmap: %v", err)
+	}
+
+	opts := Opts{NoInteractive: true, PropagationPolicy: "Foreground"}
+	if _, err := deleteNamespaceResources([]string{"configmap-1"}, clientset, testNamespace, "ConfigMap", opts, nil); err != nil {
+		t.Fatalf("Error deleting resources: %v", err)
+	}
+
+	var deletes int
+	for _, action := range clientset.Actions() {
+		deleteAction, ok := action.(k8stesting.DeleteAction)
+		if !ok {
+			continue
+		}
+		deletes++
+		propagationPolicy := deleteAction.GetDeleteOptions().PropagationPolicy
+		if propagationPolicy == nil || *propagationPolicy != metav1.DeletePropagationForeground {
+			t.Errorf("Expected the Foreground propagation policy, got %v", propagationPolicy)
+		}
+	}
+	if deletes != 1 {
+		t.Errorf("Expected one delete call, got %d", deletes)
+	}
+}
+
+func TestDeleteNamespaceResourcesUIDPrecondition(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	for _, name := range []string{"configmap-1", "configmap-2"} {
+		configmap := CreateTestConfigmap(testNamespace, name)
+		configmap.UID = "uid-new"
+		if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), configmap, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+
+	// the fake clientset ignores preconditions, reject the deletion like the API server would
+	clientset.PrependReactor("delete", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		deleteAction := action.(k8stesting.DeleteAction)
+		preconditions := deleteAction.GetDeleteOptions().Preconditions
+		if preconditions != nil && preconditions.UID != nil && *preconditions.UID != "uid-new" {
+			return true, nil, errors.NewConflict(schema.GroupResource{Resource: "configmaps"}, deleteAction.GetName(), fmt.Errorf("precondition failed: UID in precondition: %s, UID in object meta: uid-new", *preconditions.UID))
+		}
+		return false, nil, nil
+	})
+
+	identities := map[string]ResourceIdentity{"configmap-1": {UID: "uid-old"}}
+	opts := Opts{NoInteractive: true}
+	deletedDiff, err := deleteNamespaceResourcesWithIdentities([]string{"configmap-1", "configmap-2"}, clientset, testNamespace, "ConfigMap", opts, nil, identities)
+	if err != nil {
+		t.Fatalf("Error deleting resources: %v", err)
+	}
+	if !reflect.DeepEqual(deletedDiff, []string{"configmap-1-SKIPPED", "configmap-2-DELETED"}) {
+		t.Errorf("Expected the recreated configmap to be skipped, got %v", deletedDiff)
+	}
+
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Get(context.TODO(), "configmap-1", metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected the recreated configmap-1 to be kept, got %v", err)
+	}
+
+	for _, action := range clientset.Actions() {
+		deleteAction, ok := action.(k8stesting.DeleteAction)
+		if !ok || deleteAction.GetName() != "configmap-2" {
+			continue
+		}
+		if deleteAction.GetDeleteOptions().Preconditions != nil {
+			t.Errorf("Expected configmap-2 without a known UID to be deleted without preconditions")
+		}
+	}
+}
+
+func TestOptsValidatePropagationPolicy(t *testing.T) {
+	if err := (Opts{PropagationPolicy: "Background"}).Validate(); err != nil {
+		t.Errorf("Expected Background to be valid, got %v", err)
+	}
+	if err := (Opts{PropagationPolicy: "Cascade"}).Validate(); err == nil {
+		t.Error("Expected an error for an unknown propagation policy")
+	}
+}
+
+func TestDeleteResourceNotFound(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+
+	deletedDiff, err := DeleteResource([]string{"configmap-1"}, clientset, testNamespace, "ConfigMap", true)
+	if err != nil {
+		t.Fatalf("Error deleting resources: %v", err)
+	}
+	if !reflect.DeepEqual(deletedDiff, []string{"configmap-1-DELETED"}) {
+		t.Errorf("Expected missing configmap-1 to be reported as deleted, got %v", deletedDiff)
+	}
+}
+
+func TestDeleteNamespaceResourcesConfirmEachNamespace(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	for _, namespace := range []string{"namespace-1", "namespace-2"} {
+		for _, name := range []string{"configmap-1", "configmap-2"} {
+			_, err := clientset.CoreV1().ConfigMaps(namespace).Create(context.TODO(), CreateTestConfigmap(namespace, name), metav1.CreateOptions{})
+			if err != nil {
+				t.Fatalf("Error creating fake configmap: %v", err)
+			}
+		}
+	}
+
+	originalInput := confirmationInput
+	defer func() { confirmationInput = originalInput }()
+	confirmationInput = strings.NewReader("n\ny\n")
+
+	opts := Opts{ConfirmEachNamespace: true}
+	candidates := []string{"configmap-1", "configmap-2"}
+
+	declinedDiff, err := deleteNamespaceResources(candidates, clientset, "namespace-1", "ConfigMap", opts, nil)
+	if err != nil {
+		t.Fatalf("Error deleting resources: %v", err)
+	}
+	if !reflect.DeepEqual(declinedDiff, candidates) {
+		t.Errorf("Expected declined namespace to keep its resources, got %v", declinedDiff)
+	}
+
+	confirmedDiff, err := deleteNamespaceResources(candidates, clientset, "namespace-2", "ConfigMap", opts, nil)
+	if err != nil {
+		t.Fatalf("Error deleting resources: %v", err)
+	}
+	if !reflect.DeepEqual(confirmedDiff, []string{"configmap-1-DELETED", "configmap-2-DELETED"}) {
+		t.Errorf("Expected confirmed namespace resources to be deleted, got %v", confirmedDiff)
+	}
+
+	confirmationInput = strings.NewReader("")
+	opts.NoInteractive = true
+	forcedDiff, err := deleteNamespaceResources([]string{"configmap-1"}, clientset, "namespace-1", "ConfigMap", opts, nil)
+	if err != nil {
+		t.Fatalf("Error deleting resources: %v", err)
+	}
+	if !reflect.DeepEqual(forcedDiff, []string{"configmap-1-DELETED"}) {
+		t.Errorf("Expected --no-interactive to delete without asking, got %v", forcedDiff)
+	}
+
+	for namespace, expected := range map[string]int{"namespace-1": 1, "namespace-2": 0} {
+		configmaps, err := clientset.CoreV1().ConfigMaps(namespace).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			t.Fatalf("Error listing configmaps: %v", err)
+		}
+		if len(configmaps.Items) != expected {
+			t.Errorf("Expected %d configmaps left in %s, got %d", expected, namespace, len(configmaps.Items))
+		}
+	}
+}
+
+func TestGetUnusedConfigmapsEmitDeleteCommands(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), CreateTestConfigmap(testNamespace, "configmap-0"), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake configmap: %v", err)
+	}
+
+	opts := Opts{DeleteFlag: true, NoInteractive: true, EmitDeleteCommands: true, PropagationPolicy: "Foreground"}
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "table", opts)
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	expected := "kubectl delete configmap configmap-0 -n " + testNamespace + " --cascade=foreground\n" +
+		"kubectl delete configmap configmap-3 -n " + testNamespace + " --cascade=foreground\n"
+	if output != expected {
+		t.Errorf("Expected delete commands:\n%s\ngot:\n%s", expected, output)
+	}
+
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "delete" {
+			t.Errorf("Expected nothing to be deleted, got a delete of %s", action.GetResource().Resource)
+		}
+	}
+}
+
+func TestDeleteNamespaceResourcesConcurrency(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	var candidates []string
+	for i := 0; i < 200; i++ {
+		name := fmt.Sprintf("configmap-%d", i)
+		if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), CreateTestConfigmap(testNamespace, name), metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+		candidates = append(candidates, name)
+	}
+
+	remaining := 150
+	var output bytes.Buffer
+	opts := Opts{NoInteractive: true, DeleteConcurrency: 8, LogOutput: &output}
+	deletedDiff, err := deleteNamespaceResources(candidates, clientset, testNamespace, "ConfigMap", opts, &remaining)
+	if err != nil {
+		t.Fatalf("Error deleting resources: %v", err)
+	}
+
+	var expectedDiff []string
+	for i, name := range candidates {
+		if i < 150 {
+			expectedDiff = append(expectedDiff, name+"-DELETED")
+		} else {
+			expectedDiff = append(expectedDiff, name+"-SKIPPED")
+		}
+	}
+	if !reflect.DeepEqual(deletedDiff, expectedDiff) {
+		t.Errorf("Expected the first 150 configmaps to be deleted and the others skipped, got %v", deletedDiff)
+	}
+	if remaining != 0 {
+		t.Errorf("Expected deletion budget to be exhausted, %d left", remaining)
+	}
+
+	var expectedOutput strings.Builder
+	for _, name := range candidates[:150] {
+		fmt.Fprintf(&expectedOutput, "Deleting ConfigMap %s in namespace %s\n", name, testNamespace)
+	}
+	if output.String() != expectedOutput.String() {
+		t.Errorf("Expected one progress message per deletion in the order of the candidates, got %q", output.String())
+	}
+
+	configmaps, err := clientset.CoreV1().ConfigMaps(testNamespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Error listing configmaps: %v", err)
+	}
+	if len(configmaps.Items) != 50 {
+		t.Errorf("Expected 50 configmaps to remain, got %d", len(configmaps.Items))
+	}
+}
+
+func TestGetUnusedConfigmapsDeletedListFile(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), CreateTestConfigmap(testNamespace, "configmap-4"), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake configmap: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "deleted.txt")
+
+	opts := Opts{DeleteFlag: true, NoInteractive: true, MaxDeletions: 1, Canonical: true, DeletedListFile: path}
+	if _, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts); err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading deleted list file: %v", err)
+	}
+	if expected := testNamespace + "/configmap-3\n"; string(content) != expected {
+		t.Errorf("Expected deleted list file %q, got %q", expected, content)
+	}
+}
+
+func TestGetUnusedConfigmapsFinalizers(t *testing.T) {
+	for _, test := range []struct {
+		name                  string
+		forceRemoveFinalizers bool
+		failDelete            bool
+		expected              []string
+		expectKept            bool
+		expectPatched         bool
+	}{
+		{name: "reported as undeletable", expected: []string{"configmap-3-DELETED", "finalized-config-UNDELETABLE"}, expectKept: true},
+		{name: "forced", forceRemoveFinalizers: true, expected: []string{"configmap-3-DELETED", "finalized-config-DELETED"}, expectPatched: true},
+		{name: "forced, deletion rejected", forceRemoveFinalizers: true, failDelete: true, expected: []string{"configmap-3-DELETED"}, expectKept: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			clientset := createTestConfigmaps(t)
+			configmap := CreateTestConfigmap(testNamespace, "finalized-config")
+			configmap.Finalizers = []string{"example.com/cleanup"}
+			if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), configmap, metav1.CreateOptions{}); err != nil {
+				t.Fatalf("Error creating fake configmap: %v", err)
+			}
+
+			// the fake clientset ignores finalizers, keep the configmap around while it has some and remove it once
+			// they are patched away after its deletion, like the API server would
+			gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+			clientset.PrependReactor("delete", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				deleteAction := action.(k8stesting.DeleteAction)
+				current, err := clientset.Tracker().Get(gvr, deleteAction.GetNamespace(), deleteAction.GetName())
+				if err != nil || len(current.(*corev1.ConfigMap).Finalizers) == 0 {
+					return false, nil, nil
+				}
+				if test.failDelete {
+					return true, nil, errors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, deleteAction.GetName(), nil)
+				}
+				deleting := current.(*corev1.ConfigMap).DeepCopy()
+				now := metav1.Now()
+				deleting.DeletionTimestamp = &now
+				return true, nil, clientset.Tracker().Update(gvr, deleting, deleteAction.GetNamespace())
+			})
+			clientset.PrependReactor("patch", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				patchAction := action.(k8stesting.PatchAction)
+				current, err := clientset.Tracker().Get(gvr, patchAction.GetNamespace(), patchAction.GetName())
+				if err != nil || current.(*corev1.ConfigMap).DeletionTimestamp == nil {
+					return false, nil, nil
+				}
+				return true, current, clientset.Tracker().Delete(gvr, patchAction.GetNamespace(), patchAction.GetName())
+			})
+
+			opts := Opts{DeleteFlag: true, NoInteractive: true, ForceRemoveFinalizers: test.forceRemoveFinalizers, LogOutput: io.Discard}
+			output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+			if err != nil {
+				t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+			}
+
+			var actualOutput map[string]map[string][]string
+			if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+				t.Fatalf("Error unmarshaling actual output: %v", err)
+			}
+			if !reflect.DeepEqual(actualOutput[testNamespace]["ConfigMap"], test.expected) {
+				t.Errorf("Expected %v, got %v", test.expected, actualOutput[testNamespace]["ConfigMap"])
+			}
+
+			current, err := clientset.CoreV1().ConfigMaps(testNamespace).Get(context.TODO(), "finalized-config", metav1.GetOptions{})
+			if test.expectKept && (err != nil || !reflect.DeepEqual(current.Finalizers, configmap.Finalizers)) {
+				t.Errorf("Expected the configmap to be kept with its finalizers, got %v, %v", current, err)
+			}
+			if !test.expectKept && !errors.IsNotFound(err) {
+				t.Errorf("Expected the configmap to be deleted once its finalizers were removed, got %v", err)
+			}
+
+			deleted, patched := false, false
+			for _, action := range clientset.Actions() {
+				if deleteAction, ok := action.(k8stesting.DeleteAction); ok && deleteAction.GetName() == "finalized-config" {
+					deleted = true
+				}
+				if patchAction, ok := action.(k8stesting.PatchAction); ok && patchAction.GetName() == "finalized-config" {
+					if !deleted {
+						t.Errorf("Expected the finalizers to be removed only after the deletion was accepted")
+					}
+					patched = true
+				}
+			}
+			if patched != test.expectPatched {
+				t.Errorf("Expected finalizers to be patched away only when forced and deleting, patched: %v", patched)
+			}
+		})
+	}
+}
+
+func TestGetUnusedConfigmapsBackupDir(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	configmap := CreateTestConfigmap(testNamespace, "configmap-4")
+	configmap.Data = map[string]string{"key": "value"}
+	configmap.UID = "configmap-4-uid"
+	configmap.ResourceVersion = "42"
+	configmap.CreationTimestamp = metav1.Now()
+	configmap.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "kubectl", Operation: metav1.ManagedFieldsOperationApply}}
+	// a configmap that can't be deleted isn't backed up
+	finalized := CreateTestConfigmap(testNamespace, "configmap-5")
+	finalized.Finalizers = []string{"example.com/protect"}
+	for _, configmap := range []*corev1.ConfigMap{configmap, finalized} {
+		if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), configmap, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+	backupDir := t.TempDir()
+
+	opts := Opts{DeleteFlag: true, NoInteractive: true, BackupDir: backupDir, RequireBackup: true, LogOutput: io.Discard}
+	if _, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts); err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	for _, name := range []string{"configmap-3", "configmap-4"} {
+		content, err := os.ReadFile(filepath.Join(backupDir, testNamespace, name+".yaml"))
+		if err != nil {
+			t.Fatalf("Expected a backup of %s: %v", name, err)
+		}
+		var backup corev1.ConfigMap
+		if err := yaml.Unmarshal(content, &backup); err != nil {
+			t.Fatalf("Error parsing backup of %s: %v", name, err)
+		}
+		if backup.Kind != "ConfigMap" || backup.APIVersion != "v1" || backup.Name != name || backup.Namespace != testNamespace {
+			t.Errorf("Expected the backup of %s to be its full manifest, got %s", name, content)
+		}
+		if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Get(context.TODO(), name, metav1.GetOptions{}); !errors.IsNotFound(err) {
+			t.Errorf("Expected %s to be deleted after its backup, got %v", name, err)
+		}
+	}
+	path := filepath.Join(backupDir, testNamespace, "configmap-4.yaml")
+	content, _ := os.ReadFile(path)
+	if !strings.Contains(string(content), "key: value") {
+		t.Errorf("Expected the backup of configmap-4 to include its data, got %s", content)
+	}
+	var backup corev1.ConfigMap
+	if err := yaml.Unmarshal(content, &backup); err != nil {
+		t.Fatalf("Error parsing backup of configmap-4: %v", err)
+	}
+	if backup.UID != "" || backup.ResourceVersion != "" || backup.ManagedFields != nil || !backup.CreationTimestamp.IsZero() {
+		t.Errorf("Expected the backup of configmap-4 to leave out the server-set metadata, got %s", content)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the backup file to be private, got %v, %v", info.Mode().Perm(), err)
+	}
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("Expected the backup directory to be private, got %v, %v", info.Mode().Perm(), err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(backupDir, testNamespace))
+	if err != nil {
+		t.Fatalf("Error reading backup directory: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Expected backups of the 2 deleted configmaps only, got %d files", len(entries))
+	}
+}
+
+func TestDeleteNamespaceResourcesRequireBackup(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), CreateTestConfigmap(testNamespace, "configmap-1"), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake configmap: %v", err)
+	}
+	// a backup directory that is a file can't hold the namespace directory
+	backupDir := filepath.Join(t.TempDir(), "backup")
+	if err := os.WriteFile(backupDir, nil, 0644); err != nil {
+		t.Fatalf("Error creating file: %v", err)
+	}
+
+	opts := Opts{NoInteractive: true, BackupDir: backupDir, RequireBackup: true, LogOutput: io.Discard}
+	deletedDiff, err := deleteNamespaceResources([]string{"configmap-1"}, clientset, testNamespace, "ConfigMap", opts, nil)
+	if err != nil {
+		t.Fatalf("Error deleting resources: %v", err)
+	}
+	if len(deletedDiff) != 0 {
+		t.Errorf("Expected configmap-1 not to be deleted when its backup failed, got %v", deletedDiff)
+	}
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Get(context.TODO(), "configmap-1", metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected configmap-1 to be left in place, got %v", err)
+	}
+
+	opts.RequireBackup = false
+	deletedDiff, err = deleteNamespaceResources([]string{"configmap-1"}, clientset, testNamespace, "ConfigMap", opts, nil)
+	if err != nil {
+		t.Fatalf("Error deleting resources: %v", err)
+	}
+	if !reflect.DeepEqual(deletedDiff, []string{"configmap-1-DELETED"}) {
+		t.Errorf("Expected configmap-1 to be deleted without a required backup, got %v", deletedDiff)
+	}
+}
+
+func TestDeleteResourceWithOptsPrompt(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	for _, name := range []string{"configmap-1", "configmap-2"} {
+		if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), CreateTestConfigmap(testNamespace, name), metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+
+	originalInput := confirmationInput
+	defer func() { confirmationInput = originalInput }()
+	confirmationInput = strings.NewReader("y\nn\n")
+
+	var output bytes.Buffer
+	deletedDiff, err := DeleteResourceWithOpts([]string{"configmap-1", "configmap-2"}, clientset, testNamespace, "ConfigMap", Opts{LogOutput: &output}, nil)
+	if err != nil {
+		t.Fatalf("Error deleting resources: %v", err)
+	}
+	if !reflect.DeepEqual(deletedDiff, []string{"configmap-1-DELETED", "configmap-2"}) {
+		t.Errorf("Expected only the confirmed configmap to be deleted, got %v", deletedDiff)
+	}
+	if !strings.Contains(output.String(), "Do you want to delete ConfigMap configmap-2") {
+		t.Errorf("Expected the prompts to be printed to the log output, got %q", output.String())
+	}
+}
@@ -0,0 +1,156 @@
+package kor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// deletedWorkloadReason is the reason of the events reporting the deletion of their involved workload
+const deletedWorkloadReason = "Deleted"
+
+// workloadTemplateListers list the pod templates of the workloads of a kind in a namespace, by workload name
+var workloadTemplateListers = map[string]func(ctx context.Context, clientset kubernetes.Interface, namespace string) (map[string]*corev1.PodSpec, error){
+	"Deployment": func(ctx context.Context, clientset kubernetes.Interface, namespace string) (map[string]*corev1.PodSpec, error) {
+		list, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		specs := make(map[string]*corev1.PodSpec, len(list.Items))
+		for i := range list.Items {
+			specs[list.Items[i].Name] = &list.Items[i].Spec.Template.Spec
+		}
+		return specs, nil
+	},
+	"StatefulSet": func(ctx context.Context, clientset kubernetes.Interface, namespace string) (map[string]*corev1.PodSpec, error) {
+		list, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		specs := make(map[string]*corev1.PodSpec, len(list.Items))
+		for i := range list.Items {
+			specs[list.Items[i].Name] = &list.Items[i].Spec.Template.Spec
+		}
+		return specs, nil
+	},
+	"DaemonSet": func(ctx context.Context, clientset kubernetes.Interface, namespace string) (map[string]*corev1.PodSpec, error) {
+		list, err := clientset.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		specs := make(map[string]*corev1.PodSpec, len(list.Items))
+		for i := range list.Items {
+			specs[list.Items[i].Name] = &list.Items[i].Spec.Template.Spec
+		}
+		return specs, nil
+	},
+	"Job": func(ctx context.Context, clientset kubernetes.Interface, namespace string) (map[string]*corev1.PodSpec, error) {
+		list, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		specs := make(map[string]*corev1.PodSpec, len(list.Items))
+		for i := range list.Items {
+			specs[list.Items[i].Name] = &list.Items[i].Spec.Template.Spec
+		}
+		return specs, nil
+	},
+	"CronJob": func(ctx context.Context, clientset kubernetes.Interface, namespace string) (map[string]*corev1.PodSpec, error) {
+		list, err := clientset.BatchV1().CronJobs(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		specs := make(map[string]*corev1.PodSpec, len(list.Items))
+		for i := range list.Items {
+			specs[list.Items[i].Name] = &list.Items[i].Spec.JobTemplate.Spec.Template.Spec
+		}
+		return specs, nil
+	},
+}
+
+// workloadKey identifies a workload of a namespace in the events and the orphan state
+func workloadKey(kind, name string) string {
+	return kind + "/" + name
+}
+
+// workloadConfigMapReferences returns the ConfigMaps referenced by the pod template of each workload of the
+// namespace, keyed by workloadKey. Workloads referencing no ConfigMap are returned with no references.
+func workloadConfigMapReferences(clientset kubernetes.Interface, namespace string) (map[string][]string, error) {
+	references := make(map[string][]string)
+	for kind, listTemplates := range workloadTemplateListers {
+		specs, err := listTemplates(context.TODO(), clientset, namespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s pod templates: %w", kind, err)
+		}
+		for name, spec := range specs {
+			var configmaps []string
+			for _, ref := range extractConfigMapRefs(spec) {
+				configmaps = append(configmaps, ref.name)
+			}
+			references[workloadKey(kind, name)] = RemoveDuplicatesAndSort(configmaps)
+		}
+	}
+	return references, nil
+}
+
+// eventTime returns the time an event last occurred
+func eventTime(event corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.FirstTimestamp.Time
+	}
+}
+
+// retrieveDeletedWorkloads returns the workloads deleted in the namespace within window, keyed by workloadKey,
+// according to the Deleted events that involve them
+func retrieveDeletedWorkloads(clientset kubernetes.Interface, namespace string, window time.Duration) ([]string, error) {
+	events, err := clientset.CoreV1().Events(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+
+	since := time.Now().Add(-window)
+	var workloads []string
+	for _, event := range events.Items {
+		if workloadTemplateListers[event.InvolvedObject.Kind] == nil || !strings.EqualFold(event.Reason, deletedWorkloadReason) {
+			continue
+		}
+		if eventTime(event).Before(since) {
+			continue
+		}
+		workloads = append(workloads, workloadKey(event.InvolvedObject.Kind, event.InvolvedObject.Name))
+	}
+	return workloads, nil
+}
+
+// filterDeletedWorkloadOrphans returns the unused ConfigMaps of diff that the pod templates of the deleted
+// workloads referenced, according to the recorded workload references. Workloads that exist again in current,
+// the references of the workloads listed by this scan, were recreated since their deletion and are skipped.
+func filterDeletedWorkloadOrphans(diff, deleted []string, recorded, current map[string][]string) []string {
+	referenced := make(map[string]bool)
+	for _, workload := range deleted {
+		if _, exists := current[workload]; exists {
+			continue
+		}
+		for _, name := range recorded[workload] {
+			referenced[name] = true
+		}
+	}
+
+	orphans := []string{}
+	for _, name := range diff {
+		if referenced[name] {
+			orphans = append(orphans, name)
+		}
+	}
+	return orphans
+}
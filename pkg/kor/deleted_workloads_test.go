@@ -0,0 +1,139 @@
+package kor
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// createConfigmapDeployment creates a Deployment whose pod template references the ConfigMaps through volumes
+func createConfigmapDeployment(t *testing.T, clientset *fake.Clientset, name string, configmaps ...string) {
+	t.Helper()
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: name}}
+	for _, configmap := range configmaps {
+		deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, corev1.Volume{
+			Name:         configmap,
+			VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: configmap}}},
+		})
+	}
+	if _, err := clientset.AppsV1().Deployments(testNamespace).Create(context.TODO(), deployment, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake deployment: %v", err)
+	}
+}
+
+// createDeletedEvent creates a synthetic Deleted event for the Deployment, age ago
+func createDeletedEvent(t *testing.T, clientset *fake.Clientset, name string, age time.Duration) {
+	t.Helper()
+	event := &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Namespace: testNamespace, Name: name + ".deleted"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Deployment", Namespace: testNamespace, Name: name},
+		Reason:         deletedWorkloadReason,
+		LastTimestamp:  metav1.NewTime(time.Now().Add(-age)),
+	}
+	if _, err := clientset.CoreV1().Events(testNamespace).Create(context.TODO(), event, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake event: %v", err)
+	}
+}
+
+func TestGetUnusedConfigmapsDeletedWorkloadsWindow(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	for _, name := range []string{"billing-config", "settings", "reports-config", "billing-v2-config"} {
+		if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), CreateTestConfigmap(testNamespace, name), metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+	createConfigmapDeployment(t, clientset, "billing", "billing-config", "settings")
+	createConfigmapDeployment(t, clientset, "reports", "reports-config")
+
+	opts := Opts{DeletedWorkloadsWindow: 24 * time.Hour, StateFile: filepath.Join(t.TempDir(), "state.json")}
+	scan := func() []string {
+		output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+		if err != nil {
+			t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+		}
+		var actualOutput map[string]map[string][]string
+		if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+			t.Fatalf("Error unmarshaling actual output: %v", err)
+		}
+		return actualOutput[testNamespace]["ConfigMap"]
+	}
+
+	// the first scan records the configmaps of the workloads
+	if unused := scan(); len(unused) != 0 {
+		t.Errorf("Expected no configmaps of deleted workloads on the first scan, got %v", unused)
+	}
+
+	for _, name := range []string{"billing", "reports"} {
+		if err := clientset.AppsV1().Deployments(testNamespace).Delete(context.TODO(), name, metav1.DeleteOptions{}); err != nil {
+			t.Fatalf("Error deleting fake deployment: %v", err)
+		}
+	}
+	createDeletedEvent(t, clientset, "billing", time.Hour)
+	createDeletedEvent(t, clientset, "reports", 48*time.Hour)
+
+	expected := []string{"billing-config", "settings"}
+	if unused := scan(); !reflect.DeepEqual(unused, expected) {
+		t.Errorf("Expected only the configmaps of the recently deleted workload, got %v", unused)
+	}
+}
+
+func TestGetUnusedConfigmapsDeletedWorkloadsRequiresStateFile(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	opts := Opts{DeletedWorkloadsWindow: 24 * time.Hour}
+	if _, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts); err == nil {
+		t.Error("Expected an error when the deleted workloads window is set without a state file")
+	}
+}
+
+func TestGetUnusedConfigmapsDeletedWorkloadsListError(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	clientset.PrependReactor("list", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "events"}, "", nil)
+	})
+
+	opts := Opts{DeletedWorkloadsWindow: 24 * time.Hour, StateFile: filepath.Join(t.TempDir(), "state.json")}
+	if _, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts); !apierrors.IsForbidden(err) {
+		t.Errorf("Expected the scan to fail when the events can't be listed, got %v", err)
+	}
+}
+
+func TestFilterDeletedWorkloadOrphans(t *testing.T) {
+	recorded := map[string][]string{
+		"Deployment/billing": {"billing-config", "settings"},
+		"Deployment/reports": {"reports-config"},
+	}
+	diff := []string{"billing-config", "reports-config", "unrelated"}
+
+	tests := []struct {
+		name    string
+		deleted []string
+		current map[string][]string
+		want    []string
+	}{
+		{name: "deleted workload", deleted: []string{"Deployment/billing"}, want: []string{"billing-config"}},
+		{name: "recreated workload", deleted: []string{"Deployment/billing"}, current: map[string][]string{"Deployment/billing": nil}, want: []string{}},
+		{name: "unrecorded workload", deleted: []string{"Deployment/legacy"}, want: []string{}},
+		{name: "no deletion", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filterDeletedWorkloadOrphans(diff, tt.deleted, recorded, tt.current); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -3,9 +3,6 @@ package kor
 import (
 	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
-	"os"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -45,22 +42,29 @@ func ProcessNamespaceDeployments(clientset kubernetes.Interface, namespace strin
 
 func GetUnusedDeployments(includeExcludeLists IncludeExcludeLists, filterOpts *FilterOptions, clientset kubernetes.Interface, outputFormat string, opts Opts) (string, error) {
 	var outputBuffer bytes.Buffer
-	namespaces := SetNamespaceList(includeExcludeLists, clientset)
+	namespaces, err := SetNamespaceList(includeExcludeLists, clientset, opts)
+	if err != nil {
+		return "", err
+	}
 	response := make(map[string]map[string][]string)
+	deletionLimit := newDeletionLimit(opts)
 
 	for _, namespace := range namespaces {
 		diff, err := ProcessNamespaceDeployments(clientset, namespace, filterOpts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to process namespace %s: %v\n", namespace, err)
+			opts.printError("Failed to process namespace %s: %v\n", namespace, err)
 			continue
 		}
 
 		if opts.DeleteFlag {
-			if diff, err = DeleteResource(diff, clientset, namespace, "Deployment", opts.NoInteractive); err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to delete Deployment %s in namespace %s: %v\n", diff, namespace, err)
+			if diff, err = deleteNamespaceResources(diff, clientset, namespace, "Deployment", opts, deletionLimit); err != nil {
+				opts.printError("Failed to delete Deployment %s in namespace %s: %v\n", diff, namespace, err)
 			}
 		}
-		output := FormatOutput(namespace, diff, "Deployments")
+		output, err := FormatOutputWithOpts(namespace, diff, "Deployments", opts)
+		if err != nil {
+			return "", err
+		}
 		outputBuffer.WriteString(output)
 		outputBuffer.WriteString("\n")
 
@@ -69,15 +73,10 @@ func GetUnusedDeployments(includeExcludeLists IncludeExcludeLists, filterOpts *F
 		response[namespace] = resourceMap
 	}
 
-	jsonResponse, err := json.MarshalIndent(response, "", "  ")
+	jsonResponse, err := marshalResponse(response, opts)
 	if err != nil {
 		return "", err
 	}
 
-	unusedDeployments, err := unusedResourceFormatter(outputFormat, outputBuffer, opts, jsonResponse)
-	if err != nil {
-		fmt.Printf("err: %v\n", err)
-	}
-
-	return unusedDeployments, nil
+	return unusedResourceFormatter(outputFormat, outputBuffer, opts, jsonResponse)
 }
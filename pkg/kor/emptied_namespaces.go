@@ -0,0 +1,150 @@
+package kor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+)
+
+// ignoredNamespaceResources are the resources that don't keep a namespace from being emptied: events expire on
+// their own and endpoints are managed along with the services, which are checked
+var ignoredNamespaceResources = map[schema.GroupResource]bool{
+	{Group: "", Resource: "events"}:                         true,
+	{Group: "events.k8s.io", Resource: "events"}:            true,
+	{Group: "", Resource: "endpoints"}:                      true,
+	{Group: "discovery.k8s.io", Resource: "endpointslices"}: true,
+}
+
+// isDefaultNamespaceResource reports whether the object is one Kubernetes creates in every namespace: the
+// kube-root-ca.crt ConfigMap, the default ServiceAccount or a service account token Secret
+func isDefaultNamespaceResource(resource schema.GroupResource, object metav1.ObjectMeta) bool {
+	if resource.Group != "" {
+		return false
+	}
+	switch resource.Resource {
+	case "configmaps":
+		return object.Name == "kube-root-ca.crt"
+	case "serviceaccounts":
+		return object.Name == "default"
+	case "secrets":
+		// the type of a Secret isn't part of its metadata, token Secrets are recognized by their annotation
+		_, ok := object.Annotations[corev1.ServiceAccountNameKey]
+		return ok
+	}
+	return false
+}
+
+// hasUserResources checks if the namespace still contains resources other than the ones Kubernetes creates in
+// every namespace and the ConfigMaps in deleted. Every namespaced resource the API server serves is checked,
+// custom resources included, and an error is returned if any of them can't be discovered or listed, as the
+// namespace can't be known to be empty.
+func hasUserResources(clientset kubernetes.Interface, metadataClient metadata.Interface, namespace string, deleted map[string]bool) (bool, error) {
+	if metadataClient == nil {
+		return false, fmt.Errorf("checking the resources left in namespace %s needs a metadata client", namespace)
+	}
+	resourceLists, err := discovery.ServerPreferredNamespacedResources(clientset.Discovery())
+	if err != nil {
+		return false, fmt.Errorf("failed to discover the resources of namespace %s: %w", namespace, err)
+	}
+	resources := discovery.FilteredBy(discovery.SupportsAllVerbs{Verbs: []string{"list"}}, resourceLists)
+	if len(resources) == 0 {
+		return false, fmt.Errorf("failed to discover the resources of namespace %s: no resources found", namespace)
+	}
+
+	ctx := context.TODO()
+	for _, resourceList := range resources {
+		groupVersion, err := schema.ParseGroupVersion(resourceList.GroupVersion)
+		if err != nil {
+			return false, err
+		}
+		for _, apiResource := range resourceList.APIResources {
+			resource := groupVersion.WithResource(apiResource.Name)
+			if ignoredNamespaceResources[resource.GroupResource()] {
+				continue
+			}
+			list, err := metadataClient.Resource(resource).Namespace(namespace).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return false, fmt.Errorf("failed to list %s in namespace %s: %w", resource.GroupResource(), namespace, err)
+			}
+			for _, item := range list.Items {
+				if isDefaultNamespaceResource(resource.GroupResource(), item.ObjectMeta) {
+					continue
+				}
+				if resource.GroupResource() == corev1.Resource("configmaps") && deleted[item.Name] {
+					continue
+				}
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// hasDeletedResources checks if resources of the diff were deleted during this run
+func hasDeletedResources(diff []string) bool {
+	for _, entry := range diff {
+		if strings.HasSuffix(entry, "-DELETED") {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanupEmptiedNamespace reports whether the namespace was left without user resources by the deletions in diff
+// and deletes it when opts.DeleteEmptiedNamespaces is set, asking for confirmation unless opts.NoInteractive is set
+func cleanupEmptiedNamespace(clientset kubernetes.Interface, namespace string, diff []string, opts Opts) (bool, error) {
+	if !hasDeletedResources(diff) {
+		return false, nil
+	}
+	deleted := make(map[string]bool, len(diff))
+	for _, entry := range diff {
+		if strings.HasSuffix(entry, "-DELETED") {
+			deleted[resourceNameFromDiff(entry)] = true
+		}
+	}
+	if hasResources, err := hasUserResources(clientset, opts.MetadataClient, namespace, deleted); err != nil || hasResources {
+		return false, err
+	}
+	if !opts.DeleteEmptiedNamespaces {
+		return true, nil
+	}
+
+	if !opts.NoInteractive {
+		fmt.Fprintf(opts.stdout(), "Namespace %s has no user resources left. Do you want to delete it? (Y/N): ", namespace)
+		if !readConfirmation(opts.printError) {
+			return true, nil
+		}
+	}
+
+	fmt.Fprintf(opts.stdout(), "Deleting namespace %s\n", namespace)
+	if err := clientset.CoreV1().Namespaces().Delete(context.TODO(), namespace, newDeleteOptions(opts)); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// FormatEmptiedNamespaces formats the namespaces left without user resources by the deletions of the run
+func FormatEmptiedNamespaces(namespaces []string) string {
+	if len(namespaces) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	table := tablewriter.NewWriter(&buf)
+	table.SetHeader([]string{"#", "Namespace"})
+
+	for i, namespace := range namespaces {
+		table.Append([]string{fmt.Sprintf("%d", i+1), namespace})
+	}
+
+	table.Render()
+	return fmt.Sprintf("Namespaces without user resources after deletion:\n%s", buf.String())
+}
@@ -0,0 +1,185 @@
+package kor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func createEphemeralNamespace(t *testing.T, clientset *fake.Clientset) {
+	_, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "ephemeral"},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Error creating namespace: %v", err)
+	}
+	for _, name := range []string{"kube-root-ca.crt", "preview-config"} {
+		if _, err := clientset.CoreV1().ConfigMaps("ephemeral").Create(context.TODO(), CreateTestConfigmap("ephemeral", name), metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+	serviceaccount := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "ephemeral"}}
+	if _, err := clientset.CoreV1().ServiceAccounts("ephemeral").Create(context.TODO(), serviceaccount, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake serviceaccount: %v", err)
+	}
+}
+
+// namespaceAPIResources are the namespaced resources served by the fake discovery of the emptied namespace tests
+var namespaceAPIResources = []*metav1.APIResourceList{
+	{GroupVersion: "v1", APIResources: []metav1.APIResource{
+		{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: metav1.Verbs{"list", "delete"}},
+		{Name: "secrets", Kind: "Secret", Namespaced: true, Verbs: metav1.Verbs{"list", "delete"}},
+		{Name: "serviceaccounts", Kind: "ServiceAccount", Namespaced: true, Verbs: metav1.Verbs{"list", "delete"}},
+		{Name: "pods", Kind: "Pod", Namespaced: true, Verbs: metav1.Verbs{"list", "delete"}},
+		{Name: "events", Kind: "Event", Namespaced: true, Verbs: metav1.Verbs{"list", "delete"}},
+		{Name: "bindings", Kind: "Binding", Namespaced: true, Verbs: metav1.Verbs{"create"}},
+		{Name: "namespaces", Kind: "Namespace", Namespaced: false, Verbs: metav1.Verbs{"list", "delete"}},
+	}},
+	{GroupVersion: "rbac.authorization.k8s.io/v1", APIResources: []metav1.APIResource{
+		{Name: "roles", Kind: "Role", Namespaced: true, Verbs: metav1.Verbs{"list", "delete"}},
+	}},
+	{GroupVersion: "networking.k8s.io/v1", APIResources: []metav1.APIResource{
+		{Name: "ingresses", Kind: "Ingress", Namespaced: true, Verbs: metav1.Verbs{"list", "delete"}},
+	}},
+}
+
+// newNamespaceMetadataClient serves the discovery of namespaceAPIResources from the clientset and returns a fake
+// metadata client holding the metadata of its ConfigMaps, Secrets, ServiceAccounts and pods along with objects
+func newNamespaceMetadataClient(t *testing.T, clientset *fake.Clientset, objects ...runtime.Object) *metadatafake.FakeMetadataClient {
+	clientset.Resources = namespaceAPIResources
+	scheme := metadatafake.NewTestScheme()
+	if err := metav1.AddMetaToScheme(scheme); err != nil {
+		t.Fatalf("Error building scheme: %v", err)
+	}
+	add := func(kind string, object metav1.ObjectMeta) {
+		objects = append(objects, &metav1.PartialObjectMetadata{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: kind}, ObjectMeta: object})
+	}
+	configmaps, err := clientset.CoreV1().ConfigMaps(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Error listing configmaps: %v", err)
+	}
+	for _, configmap := range configmaps.Items {
+		add("ConfigMap", configmap.ObjectMeta)
+	}
+	secrets, err := clientset.CoreV1().Secrets(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Error listing secrets: %v", err)
+	}
+	for _, secret := range secrets.Items {
+		add("Secret", secret.ObjectMeta)
+	}
+	serviceaccounts, err := clientset.CoreV1().ServiceAccounts(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Error listing serviceaccounts: %v", err)
+	}
+	for _, serviceaccount := range serviceaccounts.Items {
+		add("ServiceAccount", serviceaccount.ObjectMeta)
+	}
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Error listing pods: %v", err)
+	}
+	for _, pod := range pods.Items {
+		add("Pod", pod.ObjectMeta)
+	}
+	return metadatafake.NewSimpleMetadataClient(scheme, objects...)
+}
+
+func TestGetUnusedConfigmapsReportEmptiedNamespaces(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	createEphemeralNamespace(t, clientset)
+
+	opts := Opts{DeleteFlag: true, NoInteractive: true, ReportEmptiedNamespaces: true, MetadataClient: newNamespaceMetadataClient(t, clientset)}
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	var envelope struct {
+		EmptiedNamespaces []string `json:"emptiedNamespaces"`
+	}
+	if err := json.Unmarshal([]byte(output), &envelope); err != nil {
+		t.Fatalf("Error unmarshaling output: %v", err)
+	}
+	if !reflect.DeepEqual(envelope.EmptiedNamespaces, []string{"ephemeral"}) {
+		t.Errorf("Expected only the ephemeral namespace to be reported, got %v", envelope.EmptiedNamespaces)
+	}
+	if _, err := clientset.CoreV1().Namespaces().Get(context.TODO(), "ephemeral", metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected the reported namespace not to be deleted, got %v", err)
+	}
+}
+
+func TestGetUnusedConfigmapsDeleteEmptiedNamespaces(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	createEphemeralNamespace(t, clientset)
+
+	opts := Opts{DeleteFlag: true, NoInteractive: true, DeleteEmptiedNamespaces: true, MetadataClient: newNamespaceMetadataClient(t, clientset)}
+	if _, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts); err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	if _, err := clientset.CoreV1().Namespaces().Get(context.TODO(), "ephemeral", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("Expected the emptied namespace to be deleted, got %v", err)
+	}
+	if _, err := clientset.CoreV1().Namespaces().Get(context.TODO(), testNamespace, metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected the namespace with pods to be kept, got %v", err)
+	}
+}
+
+func TestGetUnusedConfigmapsEmptiedNamespacesWithOtherResources(t *testing.T) {
+	for _, object := range []metav1.PartialObjectMetadata{
+		{TypeMeta: metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "Role"}, ObjectMeta: metav1.ObjectMeta{Name: "preview", Namespace: "ephemeral"}},
+		{TypeMeta: metav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "Ingress"}, ObjectMeta: metav1.ObjectMeta{Name: "preview", Namespace: "ephemeral"}},
+	} {
+		object := object
+		t.Run(object.Kind, func(t *testing.T) {
+			clientset := createTestConfigmaps(t)
+			createEphemeralNamespace(t, clientset)
+
+			opts := Opts{DeleteFlag: true, NoInteractive: true, DeleteEmptiedNamespaces: true, MetadataClient: newNamespaceMetadataClient(t, clientset, &object)}
+			output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+			if err != nil {
+				t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+			}
+			if strings.Contains(output, "emptiedNamespaces") {
+				t.Errorf("Expected the namespace holding a %s not to be reported, got %s", object.Kind, output)
+			}
+			if _, err := clientset.CoreV1().Namespaces().Get(context.TODO(), "ephemeral", metav1.GetOptions{}); err != nil {
+				t.Errorf("Expected the namespace holding a %s to be kept, got %v", object.Kind, err)
+			}
+		})
+	}
+}
+
+func TestGetUnusedConfigmapsEmptiedNamespacesUncheckedResource(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	createEphemeralNamespace(t, clientset)
+	metadataClient := newNamespaceMetadataClient(t, clientset)
+	metadataClient.PrependReactor("list", "ingresses", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewForbidden(action.GetResource().GroupResource(), "", fmt.Errorf("no RBAC"))
+	})
+
+	opts := Opts{DeleteFlag: true, NoInteractive: true, DeleteEmptiedNamespaces: true, MetadataClient: metadataClient, LogOutput: io.Discard}
+	output, _, err := GetUnusedConfigmapsWithWarnings(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+	if strings.Contains(output, "emptiedNamespaces") {
+		t.Errorf("Expected no namespace to be reported when a resource can't be listed, got %s", output)
+	}
+	if _, err := clientset.CoreV1().Namespaces().Get(context.TODO(), "ephemeral", metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected the namespace to be kept when a resource can't be listed, got %v", err)
+	}
+}
@@ -0,0 +1,20 @@
+package kor
+
+import "errors"
+
+// Errors returned by kor wrap one of these, along with the underlying cause, so callers can
+// tell failure classes apart with errors.Is.
+var (
+	// ErrListPods is returned when pods can't be listed
+	ErrListPods = errors.New("failed to list pods")
+	// ErrListNamespaces is returned when the namespaces to scan can't be listed
+	ErrListNamespaces = errors.New("failed to list namespaces")
+	// ErrListConfigMaps is returned when ConfigMaps can't be listed
+	ErrListConfigMaps = errors.New("failed to list configmaps")
+	// ErrFormat is returned when the scan results can't be formatted
+	ErrFormat = errors.New("failed to format output")
+	// ErrReportWebhook is returned when the report can't be posted to the report webhook
+	ErrReportWebhook = errors.New("failed to post report to webhook")
+	// ErrClusterIdentity is returned when finding IDs are requested but the cluster can't be identified
+	ErrClusterIdentity = errors.New("failed to identify the cluster of the findings")
+)
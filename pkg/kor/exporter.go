@@ -28,48 +28,51 @@ func init() {
 }
 
 // TODO: add option to change port / url !?
-func Exporter(includeExcludeLists IncludeExcludeLists, filterOptions *FilterOptions, clientset kubernetes.Interface, outputFormat string, opts Opts) {
-	http.Handle("/metrics", promhttp.Handler())
-	fmt.Println("Server listening on :8080")
-	go exportMetrics(includeExcludeLists, filterOptions, clientset, outputFormat, opts) // Start exporting metrics in the background
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		fmt.Println(err)
-	}
-}
-
-func exportMetrics(includeExcludeLists IncludeExcludeLists, filterOptions *FilterOptions, clientset kubernetes.Interface, outputFormat string, opts Opts) {
+// Exporter serves the unused resources as metrics until the server or a scan fails
+func Exporter(includeExcludeLists IncludeExcludeLists, filterOptions *FilterOptions, clientset kubernetes.Interface, outputFormat string, opts Opts) error {
 	exporterInterval := os.Getenv("EXPORTER_INTERVAL")
 	if exporterInterval == "" {
 		exporterInterval = "10"
 	}
 	exporterIntervalValue, err := strconv.Atoi(exporterInterval)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return fmt.Errorf("invalid EXPORTER_INTERVAL: %w", err)
 	}
 
+	http.Handle("/metrics", promhttp.Handler())
+	fmt.Fprintln(opts.stdout(), "Server listening on :8080")
+	errs := make(chan error, 2)
+	go func() {
+		// Start exporting metrics in the background
+		errs <- exportMetrics(includeExcludeLists, filterOptions, clientset, outputFormat, opts, time.Duration(exporterIntervalValue)*time.Minute)
+	}()
+	go func() {
+		errs <- http.ListenAndServe(":8080", nil)
+	}()
+	return <-errs
+}
+
+func exportMetrics(includeExcludeLists IncludeExcludeLists, filterOptions *FilterOptions, clientset kubernetes.Interface, outputFormat string, opts Opts, interval time.Duration) error {
 	for {
-		fmt.Println("collecting unused resources")
-		if korOutput, err := GetUnusedAll(includeExcludeLists, filterOptions, clientset, outputFormat, opts); err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		} else {
-			var data map[string]map[string][]string
-			if err := json.Unmarshal([]byte(korOutput), &data); err != nil {
-				fmt.Println("Error parsing JSON:", err)
-				return
-			}
+		fmt.Fprintln(opts.stdout(), "collecting unused resources")
+		korOutput, err := GetUnusedAll(includeExcludeLists, filterOptions, clientset, outputFormat, opts)
+		if err != nil {
+			return err
+		}
+		var data map[string]map[string][]string
+		if err := json.Unmarshal([]byte(korOutput), &data); err != nil {
+			return fmt.Errorf("error parsing JSON: %w", err)
+		}
 
-			orphanedResourcesCounter.Reset()
+		orphanedResourcesCounter.Reset()
 
-			for namespace, resources := range data {
-				for kind, resourceList := range resources {
-					for _, resourceName := range resourceList {
-						orphanedResourcesCounter.WithLabelValues(kind, namespace, resourceName).Set(1)
-					}
+		for namespace, resources := range data {
+			for kind, resourceList := range resources {
+				for _, resourceName := range resourceList {
+					orphanedResourcesCounter.WithLabelValues(kind, namespace, resourceName).Set(1)
 				}
 			}
-			time.Sleep(time.Duration(exporterIntervalValue) * time.Minute)
 		}
+		time.Sleep(interval)
 	}
 }
@@ -2,10 +2,17 @@ package kor
 
 import (
 	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 // FilterOptions represents the flags and options for filtering unused Kubernetes resources, such as pods, services, or configmaps.
@@ -17,6 +24,7 @@ import (
 //     If MinSize or MaxSize is zero, no size limit is applied.
 //   - It does not have any labels that match the ExcludeLabels flag. The ExcludeLabels flag supports '=', '==', and '!=' operators,
 //     and multiple label pairs can be separated by commas. For example, -l key1=value1,key2!=value2.
+//   - It does not have any annotations that match the ExcludeAnnotations flag, which supports the same operators.
 type FilterOptions struct {
 	// OlderThan is the minimum age of the resources to be considered unused
 	OlderThan string
@@ -24,6 +32,16 @@ type FilterOptions struct {
 	NewerThan string
 	// ExcludeLabels is a label selector to exclude resources with matching labels
 	ExcludeLabels string
+	// ExcludeAnnotations is a selector of equality and existence terms, like a label selector, to exclude resources
+	// with matching annotations
+	ExcludeAnnotations string
+	// MinDataBytes is the size a ConfigMap's data must exceed for it to be considered unused, zero means no limit
+	MinDataBytes int
+	// HasDataKey, when set, only considers ConfigMaps with this key in their data or binary data as unused
+	HasDataKey string
+	// ProtectedDataKeys are glob patterns of data keys, such as "ca.crt", marking a ConfigMap containing a
+	// matching key as used regardless of references
+	ProtectedDataKeys []string
 }
 
 // NewFilterOptions returns a new FilterOptions instance with default values
@@ -41,9 +59,23 @@ func (o *FilterOptions) Validate() error {
 		return err
 	}
 
+	if _, err := parseAnnotationSelector(o.ExcludeAnnotations); err != nil {
+		return err
+	}
+
+	for _, pattern := range o.ProtectedDataKeys {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid protected data key pattern %q: %w", pattern, err)
+		}
+	}
+
+	if o.MinDataBytes < 0 {
+		return errors.New("MinDataBytes must be non-negative")
+	}
+
 	// Parse the older-than flag value into a time.Duration value
 	if o.OlderThan != "" {
-		olderThan, err := time.ParseDuration(o.OlderThan)
+		olderThan, err := ParseAge(o.OlderThan)
 		if err != nil {
 			return err
 		}
@@ -54,7 +86,7 @@ func (o *FilterOptions) Validate() error {
 
 	// Parse the newer-than flag value into a time.Duration value
 	if o.NewerThan != "" {
-		newerThan, err := time.ParseDuration(o.NewerThan)
+		newerThan, err := ParseAge(o.NewerThan)
 		if err != nil {
 			return err
 		}
@@ -66,6 +98,55 @@ func (o *FilterOptions) Validate() error {
 	return nil
 }
 
+// isoDurationRegex matches ISO8601 durations made of weeks, days, hours, minutes and seconds. Years and months
+// aren't supported since their length varies.
+var isoDurationRegex = regexp.MustCompile(`^P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// daysDurationRegex matches a number of days optionally followed by a Go duration, such as 30d or 1d12h
+var daysDurationRegex = regexp.MustCompile(`^(\d+)d(.*)$`)
+
+// ParseAge parses the age of a resource from a Go duration (72h), a number of days with an optional Go duration
+// (30d, 1d12h) or an ISO8601 duration (P30D, PT12H, P1DT12H)
+func ParseAge(age string) (time.Duration, error) {
+	if strings.HasPrefix(age, "P") {
+		match := isoDurationRegex.FindStringSubmatch(age)
+		if match == nil || age == "P" || strings.HasSuffix(age, "T") {
+			return 0, fmt.Errorf("invalid ISO8601 duration %q", age)
+		}
+		units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+		var duration time.Duration
+		for i, unit := range units {
+			if match[i+1] == "" {
+				continue
+			}
+			value, err := strconv.Atoi(match[i+1])
+			if err != nil {
+				return 0, fmt.Errorf("invalid ISO8601 duration %q: %w", age, err)
+			}
+			duration += time.Duration(value) * unit
+		}
+		return duration, nil
+	}
+
+	if match := daysDurationRegex.FindStringSubmatch(age); match != nil {
+		days, err := strconv.Atoi(match[1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", age, err)
+		}
+		duration := time.Duration(days) * 24 * time.Hour
+		if match[2] != "" {
+			rest, err := time.ParseDuration(match[2])
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q: %w", age, err)
+			}
+			duration += rest
+		}
+		return duration, nil
+	}
+
+	return time.ParseDuration(age)
+}
+
 // HasExcludedLabel parses the excluded selector into a label selector object
 func HasExcludedLabel(resourcelabels map[string]string, excludeSelector string) (bool, error) {
 	if excludeSelector == "" {
@@ -80,6 +161,113 @@ func HasExcludedLabel(resourcelabels map[string]string, excludeSelector string)
 	return exclude.Matches(labelSet), nil
 }
 
+// annotationRequirement is a single term of an annotation selector
+type annotationRequirement struct {
+	key      string
+	value    string
+	operator selection.Operator
+}
+
+func (r annotationRequirement) matches(resourceAnnotations map[string]string) bool {
+	value, ok := resourceAnnotations[r.key]
+	switch r.operator {
+	case selection.Exists:
+		return ok
+	case selection.DoesNotExist:
+		return !ok
+	case selection.Equals:
+		return ok && value == r.value
+	default:
+		return value != r.value
+	}
+}
+
+// parseAnnotationSelector parses comma separated equality (key=value, key==value, key!=value) and existence (key,
+// !key) terms. Unlike label values, annotation values aren't restricted to label characters, so only the keys are
+// validated. Values can't contain commas.
+func parseAnnotationSelector(selector string) ([]annotationRequirement, error) {
+	if strings.TrimSpace(selector) == "" {
+		return nil, nil
+	}
+	var requirements []annotationRequirement
+	for _, term := range strings.Split(selector, ",") {
+		term = strings.TrimSpace(term)
+		var requirement annotationRequirement
+		switch {
+		case strings.Contains(term, "!="):
+			requirement.key, requirement.value, _ = strings.Cut(term, "!=")
+			requirement.operator = selection.NotEquals
+		case strings.Contains(term, "=="):
+			requirement.key, requirement.value, _ = strings.Cut(term, "==")
+			requirement.operator = selection.Equals
+		case strings.Contains(term, "="):
+			requirement.key, requirement.value, _ = strings.Cut(term, "=")
+			requirement.operator = selection.Equals
+		case strings.HasPrefix(term, "!"):
+			requirement.key, requirement.operator = strings.TrimPrefix(term, "!"), selection.DoesNotExist
+		default:
+			requirement.key, requirement.operator = term, selection.Exists
+		}
+		requirement.key = strings.TrimSpace(requirement.key)
+		if errs := validation.IsQualifiedName(requirement.key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid annotation selector %q: invalid key %q: %s", selector, requirement.key, strings.Join(errs, "; "))
+		}
+		requirement.value = strings.TrimSpace(requirement.value)
+		requirements = append(requirements, requirement)
+	}
+	return requirements, nil
+}
+
+// HasExcludedAnnotation checks if the annotations match every term of the excluded selector, which supports
+// equality (key=value, key!=value) and existence (key, !key) checks like a label selector
+func HasExcludedAnnotation(resourceAnnotations map[string]string, excludeSelector string) (bool, error) {
+	requirements, err := parseAnnotationSelector(excludeSelector)
+	if err != nil || len(requirements) == 0 {
+		return false, err
+	}
+	for _, requirement := range requirements {
+		if !requirement.matches(resourceAnnotations) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// HasIncludedSize checks if the size of a resource's data exceeds the MinDataBytes filter option
+func HasIncludedSize(dataBytes int, filterOpts *FilterOptions) bool {
+	return filterOpts.MinDataBytes == 0 || dataBytes > filterOpts.MinDataBytes
+}
+
+// HasIncludedDataKey checks if a resource's data or binary data contains the HasDataKey filter option
+func HasIncludedDataKey(data map[string]string, binaryData map[string][]byte, filterOpts *FilterOptions) bool {
+	if filterOpts.HasDataKey == "" {
+		return true
+	}
+	if _, ok := data[filterOpts.HasDataKey]; ok {
+		return true
+	}
+	_, ok := binaryData[filterOpts.HasDataKey]
+	return ok
+}
+
+// HasProtectedDataKey checks if a resource's data or binary data contains a key matching one of the
+// ProtectedDataKeys filter option patterns
+func HasProtectedDataKey(data map[string]string, binaryData map[string][]byte, filterOpts *FilterOptions) bool {
+	for _, pattern := range filterOpts.ProtectedDataKeys {
+		for key := range data {
+			if matched, _ := path.Match(pattern, key); matched {
+				return true
+			}
+		}
+		for key := range binaryData {
+			if matched, _ := path.Match(pattern, key); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // HasIncludedAge checks if a resource has an age that matches the included criteria specified by the filter options
 // A resource is considered to have an included age if its age (measured from the last modified time) is within the
 // range specified by older-than and newer-than flags.
@@ -99,7 +287,7 @@ func HasIncludedAge(creationTime metav1.Time, filterOpts *FilterOptions) (bool,
 
 	// Parse the older-than flag value into a time.Duration value
 	if filterOpts.OlderThan != "" {
-		olderThan, err := time.ParseDuration(filterOpts.OlderThan)
+		olderThan, err := ParseAge(filterOpts.OlderThan)
 		if err != nil {
 			return false, err
 		}
@@ -108,7 +296,7 @@ func HasIncludedAge(creationTime metav1.Time, filterOpts *FilterOptions) (bool,
 
 	// Parse the newer-than flag value into a time.Duration value
 	if filterOpts.NewerThan != "" {
-		newerThan, err := time.ParseDuration(filterOpts.NewerThan)
+		newerThan, err := ParseAge(filterOpts.NewerThan)
 		if err != nil {
 			return false, err
 		}
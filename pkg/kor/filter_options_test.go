@@ -25,6 +25,16 @@ func TestHasIncludedAge(t *testing.T) {
 			creationTime: metav1.Now().Add(-12 * time.Second),
 			opts:         &FilterOptions{OlderThan: "10s"},
 			want:         true,
+		}, {
+			name:         "The resource age is more than 1 day",
+			creationTime: metav1.Now().Add(-36 * time.Hour),
+			opts:         &FilterOptions{OlderThan: "P1D"},
+			want:         true,
+		}, {
+			name:         "The resource is not older than 2 days",
+			creationTime: metav1.Now().Add(-36 * time.Hour),
+			opts:         &FilterOptions{NewerThan: "2d"},
+			want:         true,
 		}, {
 			name:         "Two flags are provided",
 			creationTime: metav1.Now().Time,
@@ -43,6 +53,47 @@ func TestHasIncludedAge(t *testing.T) {
 
 }
 
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		age     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{age: "72h", want: 72 * time.Hour},
+		{age: "1h2m", want: time.Hour + 2*time.Minute},
+		{age: "30d", want: 30 * 24 * time.Hour},
+		{age: "1d12h", want: 36 * time.Hour},
+		{age: "P30D", want: 30 * 24 * time.Hour},
+		{age: "P2W", want: 14 * 24 * time.Hour},
+		{age: "PT12H", want: 12 * time.Hour},
+		{age: "P1DT2H30M", want: 26*time.Hour + 30*time.Minute},
+		{age: "30", wantErr: true},
+		{age: "30days", wantErr: true},
+		{age: "P", wantErr: true},
+		{age: "P1DT", wantErr: true},
+		{age: "P1M", wantErr: true},
+		{age: "P1Y", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.age, func(t *testing.T) {
+			got, err := ParseAge(tt.age)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFilterOptionsValidateAge(t *testing.T) {
+	assert.NoError(t, (&FilterOptions{OlderThan: "30d"}).Validate())
+	assert.NoError(t, (&FilterOptions{NewerThan: "P1DT12H"}).Validate())
+	assert.Error(t, (&FilterOptions{OlderThan: "thirty days"}).Validate())
+}
+
 func TestHasExcludedLabel(t *testing.T) {
 	tests := []struct {
 		resourcelabels  map[string]string
@@ -79,3 +130,73 @@ func TestHasExcludedLabel(t *testing.T) {
 		})
 	}
 }
+
+func TestHasExcludedAnnotation(t *testing.T) {
+	tests := []struct {
+		resourceAnnotations map[string]string
+		excludeSelector     string
+		want                bool
+		wantErr             bool
+	}{
+		{
+			resourceAnnotations: map[string]string{"lifecycle/keep": "true"},
+			excludeSelector:     "lifecycle/keep=true",
+			want:                true,
+		},
+		{
+			resourceAnnotations: map[string]string{"lifecycle/keep": "false"},
+			excludeSelector:     "lifecycle/keep",
+			want:                true,
+		},
+		{
+			resourceAnnotations: map[string]string{"lifecycle/keep": "false"},
+			excludeSelector:     "lifecycle/keep=true",
+			want:                false,
+		},
+		{
+			resourceAnnotations: map[string]string{"owner": "team-a"},
+			excludeSelector:     "lifecycle/keep",
+			want:                false,
+		},
+		{
+			resourceAnnotations: map[string]string{"lifecycle/keep": "true"},
+			excludeSelector:     "",
+			want:                false,
+		},
+		{
+			resourceAnnotations: map[string]string{"description": "kept for the nightly report"},
+			excludeSelector:     "description=kept for the nightly report",
+			want:                true,
+		},
+		{
+			resourceAnnotations: map[string]string{"owner": "team-a"},
+			excludeSelector:     "!lifecycle/keep,owner!=team-b",
+			want:                true,
+		},
+		{
+			resourceAnnotations: map[string]string{"lifecycle/keep": "true"},
+			excludeSelector:     "lifecycle keep",
+			wantErr:             true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			got, err := HasExcludedAnnotation(tt.resourceAnnotations, tt.excludeSelector)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Error(t, (&FilterOptions{ExcludeAnnotations: tt.excludeSelector}).Validate())
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHasIncludedSize(t *testing.T) {
+	filterOpts := &FilterOptions{MinDataBytes: 1024}
+	assert.False(t, HasIncludedSize(1024, filterOpts))
+	assert.True(t, HasIncludedSize(1025, filterOpts))
+	assert.True(t, HasIncludedSize(0, &FilterOptions{}))
+}
@@ -0,0 +1,161 @@
+package kor
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+// gatewayAPIGroup is the API group of the Gateway API
+const gatewayAPIGroup = "gateway.networking.k8s.io"
+
+// gatewayAPIVersions are the Gateway API versions collected, newest first. GatewayClasses, Gateways and HTTPRoutes are
+// served by each of them.
+var gatewayAPIVersions = []string{"v1", "v1beta1"}
+
+// gatewayAPIResource returns the Gateway API resource served at version
+func gatewayAPIResource(version, resource string) schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: gatewayAPIGroup, Version: version, Resource: resource}
+}
+
+// gatewayAPIVersion returns the version the Gateway API resources are listed at: the preferred version of the group
+// if it is one of gatewayAPIVersions, or else the newest of them the cluster serves. It returns false if the cluster
+// serves none of them.
+func gatewayAPIVersion(client discovery.DiscoveryInterface) (string, bool, error) {
+	groups, err := client.ServerGroups()
+	if err != nil {
+		return "", false, err
+	}
+	for _, group := range groups.Groups {
+		if group.Name != gatewayAPIGroup {
+			continue
+		}
+		if slicesContain(gatewayAPIVersions, group.PreferredVersion.Version) {
+			return group.PreferredVersion.Version, true, nil
+		}
+		for _, version := range gatewayAPIVersions {
+			for _, served := range group.Versions {
+				if served.Version == version {
+					return version, true, nil
+				}
+			}
+		}
+	}
+	return "", false, nil
+}
+
+// collectGatewayAPIReferences returns the ConfigMaps referenced by the backendRefs and extensionRefs of HTTPRoutes,
+// the infrastructure parametersRef of Gateways and the parametersRef of GatewayClasses, listed at the version
+// gatewayAPIVersion finds through discoveryClient. Clusters without the Gateway API have no references.
+func collectGatewayAPIReferences(ctx context.Context, client dynamic.Interface, discoveryClient discovery.DiscoveryInterface) ([]ResourceReference, error) {
+	version, served, err := gatewayAPIVersion(discoveryClient)
+	if err != nil || !served {
+		return nil, err
+	}
+
+	var references []ResourceReference
+
+	gatewayClasses, err := listGatewayAPIResources(ctx, client, gatewayAPIResource(version, "gatewayclasses"))
+	if err != nil {
+		return nil, err
+	}
+	for _, gatewayClass := range gatewayClasses {
+		// the namespace of a parametersRef is required for namespaced resources
+		if reference, ok := gatewayConfigMapRef(gatewayClass.Object, "", "spec", "parametersRef"); ok {
+			references = append(references, reference)
+		}
+	}
+
+	gateways, err := listGatewayAPIResources(ctx, client, gatewayAPIResource(version, "gateways"))
+	if err != nil {
+		return nil, err
+	}
+	for _, gateway := range gateways {
+		if reference, ok := gatewayConfigMapRef(gateway.Object, gateway.GetNamespace(), "spec", "infrastructure", "parametersRef"); ok {
+			references = append(references, reference)
+		}
+	}
+
+	httpRoutes, err := listGatewayAPIResources(ctx, client, gatewayAPIResource(version, "httproutes"))
+	if err != nil {
+		return nil, err
+	}
+	for _, httpRoute := range httpRoutes {
+		rules, _, _ := unstructured.NestedSlice(httpRoute.Object, "spec", "rules")
+		for _, rule := range rules {
+			ruleFields, ok := rule.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			references = append(references, filterConfigMapRefs(ruleFields, httpRoute.GetNamespace())...)
+			backendRefs, _, _ := unstructured.NestedSlice(ruleFields, "backendRefs")
+			for _, backendRef := range backendRefs {
+				backendRefFields, ok := backendRef.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if reference, ok := gatewayConfigMapRef(backendRefFields, httpRoute.GetNamespace()); ok {
+					references = append(references, reference)
+				}
+				references = append(references, filterConfigMapRefs(backendRefFields, httpRoute.GetNamespace())...)
+			}
+		}
+	}
+	return references, nil
+}
+
+// listGatewayAPIResources lists the resource in every namespace, returning nothing if the cluster doesn't serve it
+func listGatewayAPIResources(ctx context.Context, client dynamic.Interface, resource schema.GroupVersionResource) ([]unstructured.Unstructured, error) {
+	list, err := client.Resource(resource).Namespace(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// filterConfigMapRefs returns the ConfigMaps referenced by the extensionRefs of the filters in fields
+func filterConfigMapRefs(fields map[string]interface{}, namespace string) []ResourceReference {
+	var references []ResourceReference
+	filters, _, _ := unstructured.NestedSlice(fields, "filters")
+	for _, filter := range filters {
+		filterFields, ok := filter.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if reference, ok := gatewayConfigMapRef(filterFields, namespace, "extensionRef"); ok {
+			references = append(references, reference)
+		}
+	}
+	return references
+}
+
+// gatewayConfigMapRef returns the ConfigMap named by the object reference at path in fields, if it is a reference to
+// a core ConfigMap. References without a namespace are to the namespace of the referencing resource.
+func gatewayConfigMapRef(fields map[string]interface{}, namespace string, path ...string) (ResourceReference, bool) {
+	ref, found, _ := unstructured.NestedMap(fields, path...)
+	if !found {
+		return ResourceReference{}, false
+	}
+	group, _ := ref["group"].(string)
+	kind, _ := ref["kind"].(string)
+	name, _ := ref["name"].(string)
+	if (group != "" && group != "core") || kind != "ConfigMap" || name == "" {
+		return ResourceReference{}, false
+	}
+	if refNamespace, _ := ref["namespace"].(string); refNamespace != "" {
+		namespace = refNamespace
+	}
+	if namespace == "" {
+		return ResourceReference{}, false
+	}
+	return ResourceReference{Namespace: namespace, Name: name}, true
+}
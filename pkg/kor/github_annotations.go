@@ -0,0 +1,39 @@
+package kor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// sourcePathAnnotation is where kustomize and kpt record the file, relative to the repository, a rendered resource
+// comes from
+const sourcePathAnnotation = "config.kubernetes.io/path"
+
+var (
+	gitHubMessageEscaper  = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	gitHubPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// formatGitHubAnnotations returns a GitHub Actions warning annotation for each unused resource of kind, sorted by
+// namespace and name, so the findings surface in the checks of the workflow run. file returns the file each
+// annotation is attached to; the line isn't known for resources read from the cluster, so none is set.
+func formatGitHubAnnotations(kind string, unused map[string][]string, file func(namespace, name string) string) string {
+	namespaces := make([]string, 0, len(unused))
+	for namespace := range unused {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	var buf strings.Builder
+	for _, namespace := range namespaces {
+		names := append([]string{}, unused[namespace]...)
+		sort.Strings(names)
+		for _, entry := range names {
+			name := resourceNameFromDiff(entry)
+			message := fmt.Sprintf("%s %s in namespace %s is unused", kind, name, namespace)
+			fmt.Fprintf(&buf, "::warning file=%s::%s\n", gitHubPropertyEscaper.Replace(file(namespace, name)), gitHubMessageEscaper.Replace(message))
+		}
+	}
+	return buf.String()
+}
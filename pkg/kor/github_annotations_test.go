@@ -0,0 +1,40 @@
+package kor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetUnusedConfigmapsGitHubAnnotations(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	rendered := CreateTestConfigmap(testNamespace, "rendered-config")
+	rendered.Annotations = map[string]string{sourcePathAnnotation: "deploy/base/rendered-config.yaml"}
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), rendered, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake configmap: %v", err)
+	}
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "table", Opts{GitHubAnnotations: true})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	expected := fmt.Sprintf("::warning file=/api/v1/namespaces/%[1]s/configmaps/configmap-3::ConfigMap configmap-3 in namespace %[1]s is unused\n", testNamespace) +
+		fmt.Sprintf("::warning file=deploy/base/rendered-config.yaml::ConfigMap rendered-config in namespace %s is unused\n", testNamespace)
+	if output != expected {
+		t.Errorf("Expected annotations:\n%s\ngot:\n%s", expected, output)
+	}
+}
+
+func TestFormatGitHubAnnotationsEscaping(t *testing.T) {
+	output := formatGitHubAnnotations("ConfigMap", map[string][]string{"ns": {"100%\nsure"}}, func(namespace, name string) string {
+		return "a:b,c.yaml"
+	})
+
+	expected := "::warning file=a%3Ab%2Cc.yaml::ConfigMap 100%25%0Asure in namespace ns is unused\n"
+	if output != expected {
+		t.Errorf("Expected escaped annotation %q, got %q", expected, output)
+	}
+}
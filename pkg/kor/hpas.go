@@ -3,9 +3,6 @@ package kor
 import (
 	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
-	"os"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -92,22 +89,29 @@ func processNamespaceHpas(clientset kubernetes.Interface, namespace string, filt
 
 func GetUnusedHpas(includeExcludeLists IncludeExcludeLists, filterOpts *FilterOptions, clientset kubernetes.Interface, outputFormat string, opts Opts) (string, error) {
 	var outputBuffer bytes.Buffer
-	namespaces := SetNamespaceList(includeExcludeLists, clientset)
+	namespaces, err := SetNamespaceList(includeExcludeLists, clientset, opts)
+	if err != nil {
+		return "", err
+	}
 	response := make(map[string]map[string][]string)
+	deletionLimit := newDeletionLimit(opts)
 
 	for _, namespace := range namespaces {
 		diff, err := processNamespaceHpas(clientset, namespace, filterOpts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to process namespace %s: %v\n", namespace, err)
+			opts.printError("Failed to process namespace %s: %v\n", namespace, err)
 			continue
 		}
 
 		if opts.DeleteFlag {
-			if diff, err = DeleteResource(diff, clientset, namespace, "HPA", opts.NoInteractive); err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to delete HPA %s in namespace %s: %v\n", diff, namespace, err)
+			if diff, err = deleteNamespaceResources(diff, clientset, namespace, "HPA", opts, deletionLimit); err != nil {
+				opts.printError("Failed to delete HPA %s in namespace %s: %v\n", diff, namespace, err)
 			}
 		}
-		output := FormatOutput(namespace, diff, "HPAs")
+		output, err := FormatOutputWithOpts(namespace, diff, "HPAs", opts)
+		if err != nil {
+			return "", err
+		}
 		outputBuffer.WriteString(output)
 		outputBuffer.WriteString("\n")
 
@@ -116,15 +120,10 @@ func GetUnusedHpas(includeExcludeLists IncludeExcludeLists, filterOpts *FilterOp
 		response[namespace] = resourceMap
 	}
 
-	jsonResponse, err := json.MarshalIndent(response, "", "  ")
+	jsonResponse, err := marshalResponse(response, opts)
 	if err != nil {
 		return "", err
 	}
 
-	unusedHpas, err := unusedResourceFormatter(outputFormat, outputBuffer, opts, jsonResponse)
-	if err != nil {
-		fmt.Printf("err: %v\n", err)
-	}
-
-	return unusedHpas, nil
+	return unusedResourceFormatter(outputFormat, outputBuffer, opts, jsonResponse)
 }
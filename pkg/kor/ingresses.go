@@ -3,9 +3,6 @@ package kor
 import (
 	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
-	"os"
 
 	v1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -105,22 +102,29 @@ func processNamespaceIngresses(clientset kubernetes.Interface, namespace string,
 
 func GetUnusedIngresses(includeExcludeLists IncludeExcludeLists, filterOpts *FilterOptions, clientset kubernetes.Interface, outputFormat string, opts Opts) (string, error) {
 	var outputBuffer bytes.Buffer
-	namespaces := SetNamespaceList(includeExcludeLists, clientset)
+	namespaces, err := SetNamespaceList(includeExcludeLists, clientset, opts)
+	if err != nil {
+		return "", err
+	}
 	response := make(map[string]map[string][]string)
+	deletionLimit := newDeletionLimit(opts)
 
 	for _, namespace := range namespaces {
 		diff, err := processNamespaceIngresses(clientset, namespace, filterOpts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to process namespace %s: %v\n", namespace, err)
+			opts.printError("Failed to process namespace %s: %v\n", namespace, err)
 			continue
 		}
 
 		if opts.DeleteFlag {
-			if diff, err = DeleteResource(diff, clientset, namespace, "Ingress", opts.NoInteractive); err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to delete Ingress %s in namespace %s: %v\n", diff, namespace, err)
+			if diff, err = deleteNamespaceResources(diff, clientset, namespace, "Ingress", opts, deletionLimit); err != nil {
+				opts.printError("Failed to delete Ingress %s in namespace %s: %v\n", diff, namespace, err)
 			}
 		}
-		output := FormatOutput(namespace, diff, "Ingresses")
+		output, err := FormatOutputWithOpts(namespace, diff, "Ingresses", opts)
+		if err != nil {
+			return "", err
+		}
 		outputBuffer.WriteString(output)
 		outputBuffer.WriteString("\n")
 
@@ -129,15 +133,10 @@ func GetUnusedIngresses(includeExcludeLists IncludeExcludeLists, filterOpts *Fil
 		response[namespace] = resourceMap
 	}
 
-	jsonResponse, err := json.MarshalIndent(response, "", "  ")
+	jsonResponse, err := marshalResponse(response, opts)
 	if err != nil {
 		return "", err
 	}
 
-	unusedIngresses, err := unusedResourceFormatter(outputFormat, outputBuffer, opts, jsonResponse)
-	if err != nil {
-		fmt.Printf("err: %v\n", err)
-	}
-
-	return unusedIngresses, nil
+	return unusedResourceFormatter(outputFormat, outputBuffer, opts, jsonResponse)
 }
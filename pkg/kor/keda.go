@@ -0,0 +1,73 @@
+package kor
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// KEDA resources ScaledObject triggers read ConfigMap parameters through
+var (
+	kedaTriggerAuthenticationResource        = schema.GroupVersionResource{Group: "keda.sh", Version: "v1alpha1", Resource: "triggerauthentications"}
+	kedaClusterTriggerAuthenticationResource = schema.GroupVersionResource{Group: "keda.sh", Version: "v1alpha1", Resource: "clustertriggerauthentications"}
+)
+
+// kedaClusterObjectNamespace is the namespace KEDA reads the ConfigMaps of ClusterTriggerAuthentications from, the
+// default of its KEDA_CLUSTER_OBJECT_NAMESPACE setting
+const kedaClusterObjectNamespace = "keda"
+
+// collectKEDAReferences returns the ConfigMaps named by the configMapTargetRef of KEDA TriggerAuthentications and
+// ClusterTriggerAuthentications, which the triggers of ScaledObjects reference for their parameters. Clusters without
+// KEDA installed have no references.
+func collectKEDAReferences(ctx context.Context, client dynamic.Interface) ([]ResourceReference, error) {
+	triggerAuthentications, err := listKEDAResources(ctx, client, kedaTriggerAuthenticationResource)
+	if err != nil {
+		return nil, err
+	}
+	clusterTriggerAuthentications, err := listKEDAResources(ctx, client, kedaClusterTriggerAuthenticationResource)
+	if err != nil {
+		return nil, err
+	}
+
+	var references []ResourceReference
+	for _, triggerAuthentication := range triggerAuthentications {
+		references = append(references, kedaConfigMapTargetRefs(triggerAuthentication, triggerAuthentication.GetNamespace())...)
+	}
+	for _, clusterTriggerAuthentication := range clusterTriggerAuthentications {
+		references = append(references, kedaConfigMapTargetRefs(clusterTriggerAuthentication, kedaClusterObjectNamespace)...)
+	}
+	return references, nil
+}
+
+// listKEDAResources lists the resource in every namespace, returning nothing if the cluster doesn't serve it
+func listKEDAResources(ctx context.Context, client dynamic.Interface, resource schema.GroupVersionResource) ([]unstructured.Unstructured, error) {
+	list, err := client.Resource(resource).Namespace(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// kedaConfigMapTargetRefs returns the ConfigMaps in namespace named by the configMapTargetRef of authentication
+func kedaConfigMapTargetRefs(authentication unstructured.Unstructured, namespace string) []ResourceReference {
+	var references []ResourceReference
+	targetRefs, _, _ := unstructured.NestedSlice(authentication.Object, "spec", "configMapTargetRef")
+	for _, targetRef := range targetRefs {
+		fields, ok := targetRef.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if name, _ := fields["name"].(string); name != "" {
+			references = append(references, ResourceReference{Namespace: namespace, Name: name})
+		}
+	}
+	return references
+}
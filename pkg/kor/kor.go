@@ -3,28 +3,101 @@ package kor
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"sort"
 	"strings"
+	"text/template"
+	"time"
+	"unicode"
 
 	"github.com/olekukonko/tablewriter"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
 	"sigs.k8s.io/yaml"
 )
 
+// ExceptionResource keeps the resource named ResourceName in Namespace from being reported as unused. The "*"
+// namespace protects the name in every namespace, other namespaces only protect it there. Exceptions for the same
+// name add up rather than override each other: a name excepted in "*" stays protected in every namespace whatever
+// the other entries for it, and a name matched by several entries is still protected and reported once.
 type ExceptionResource struct {
-	ResourceName string
-	Namespace    string
+	ResourceName string `json:"resourceName"`
+	Namespace    string `json:"namespace"`
+	// System marks the well-known ConfigMaps read by control plane components, admission plugins and cluster
+	// bootstrap through the API or configuration files. Not every cluster has them, so they are never stale.
+	System bool `json:"system,omitempty"`
 }
+
+// AllNamespacesException is the namespace of the exceptions that apply in every namespace
+const AllNamespacesException = "*"
+
+// AppliesTo reports whether the exception applies in namespace
+func (e ExceptionResource) AppliesTo(namespace string) bool {
+	return e.Namespace == AllNamespacesException || e.Namespace == namespace
+}
+
+// Sources of the protection of a ConfigMap kept from being reported as unused
+const (
+	ProtectionSourceBuiltInException = "built-in exception"
+	ProtectionSourceCustomException  = "custom exception"
+	ProtectionSourceGlob             = "glob"
+	ProtectionSourceLabel            = "label"
+	ProtectionSourceAnnotation       = "annotation"
+)
+
+// systemExceptionReason is the reason reported with the ConfigMaps protected by a system exception
+const systemExceptionReason = "system ConfigMap read by the control plane"
+
+// ProtectedResource is a resource kept from being reported as unused and the source of its protection
+type ProtectedResource struct {
+	ResourceName string `json:"resourceName"`
+	Namespace    string `json:"namespace"`
+	Source       string `json:"source"`
+	// Reason is the reason returned by the UsedPredicate for the ConfigMaps it protects
+	Reason string `json:"reason,omitempty"`
+}
+
 type IncludeExcludeLists struct {
 	IncludeListStr string
 	ExcludeListStr string
+	// NamespaceExcludeRegex excludes namespaces whose whole name matches the regular expression
+	NamespaceExcludeRegex string
+}
+
+// Validate makes sure provided values for IncludeExcludeLists are valid
+func (l IncludeExcludeLists) Validate() error {
+	if _, err := compileNamespaceExcludeRegex(l.NamespaceExcludeRegex); err != nil {
+		return err
+	}
+	return nil
+}
+
+func compileNamespaceExcludeRegex(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid namespace exclude regex: %v", err)
+	}
+	return re, nil
 }
 
 type Opts struct {
@@ -33,6 +106,376 @@ type Opts struct {
 	WebhookURL    string
 	Channel       string
 	Token         string
+	// ConfirmEachNamespace asks for a single confirmation before deleting the unused resources of each namespace.
+	// NoInteractive takes precedence and deletes without asking.
+	ConfirmEachNamespace bool
+	// MaxDeletions caps the number of resources deleted per run, zero means no limit
+	MaxDeletions int
+	// ClusterWideList lists resources once across all namespaces instead of once per namespace
+	ClusterWideList bool
+	// IgnoreTerminatingPods ignores references from pods that are terminating, failed (including evicted) or succeeded
+	IgnoreTerminatingPods bool
+	// IgnoreCompletedJobPods ignores references from pods owned by Jobs that are complete or failed
+	IgnoreCompletedJobPods bool
+	// ReferenceAnnotationKeys are pod and ConfigMap annotation keys whose values name ConfigMaps in use
+	ReferenceAnnotationKeys []string
+	// ReportStaleExceptions reports the ConfigMap exceptions that matched no ConfigMap in the scanned namespaces
+	ReportStaleExceptions bool
+	// ReportProtected reports the ConfigMaps kept from being reported as unused by a built-in exception, the
+	// UsedPredicate, a protected data key glob, a label or an excluded annotation, along with the source of their
+	// protection and the reason given by the UsedPredicate
+	ReportProtected bool
+	// StateFile records ConfigMap references between runs so that only ConfigMaps that were
+	// previously referenced and no longer are get reported as unused
+	StateFile string
+	// SinceResourceVersion limits the ConfigMap scan to namespaces with pod or ConfigMap changes since the
+	// resourceVersion, "0" scans every namespace. The resourceVersion for the next scan is added to the output.
+	SinceResourceVersion string
+	// Canonical sorts namespaces and ConfigMap names so identical cluster state produces byte-identical output
+	Canonical bool
+	// DisplayName replaces the resource kind shown in table output headers
+	DisplayName string
+	// HeaderTemplate is a text/template for the per-namespace table output header.
+	// It is rendered with the .Kind, .Namespace and .Count of unused resources.
+	HeaderTemplate string
+	// IncludeUsed adds the ConfigMaps found in use to the output alongside the unused ones
+	IncludeUsed bool
+	// CategorizeEmpty adds the categories of the ConfigMaps of each namespace to json and yaml output: unused ones
+	// holding data, unused empty ones and empty ones that are used
+	CategorizeEmpty bool
+	// OwnerLabelKey is the label holding the owner of a ConfigMap, such as team or app.kubernetes.io/part-of. When
+	// set, json and yaml output add the owner of each unused ConfigMap and the output ends with the number of unused
+	// ConfigMaps per owner.
+	OwnerLabelKey string
+	// IncludeResourcePaths reports each unused ConfigMap in structured output as an object with its API path
+	IncludeResourcePaths bool
+	// ClusterInfo, when set, wraps structured output in an envelope identifying the cluster
+	ClusterInfo *ClusterInfo
+	// Concurrency is the number of namespaces whose ConfigMaps are scanned in parallel, values below 2 scan sequentially
+	Concurrency int
+	// AutoConcurrency derives Concurrency from QPS and the latency of the first namespace scan, up to MaxConcurrency
+	AutoConcurrency bool
+	// QPS is the request rate limit of the Kubernetes client, zero means the client-go default
+	QPS float32
+	// Burst is the number of requests the Kubernetes client can send above QPS in a burst. Zero means the
+	// client-go default, raised to QPS when QPS is higher
+	Burst int
+	// MaxConcurrency caps the derived Concurrency, zero means defaultMaxConcurrency
+	MaxConcurrency int
+	// ReportWebhookURL receives the JSON report of each scan in a POST request
+	ReportWebhookURL string
+	// ReportWebhookHeaders are added to the report webhook request, e.g. for authentication
+	ReportWebhookHeaders map[string]string
+	// ReportWebhookTimeout limits the report webhook request, zero means defaultReportWebhookTimeout
+	ReportWebhookTimeout time.Duration
+	// ReportWebhookRequired fails the scan when the report can't be posted instead of only printing a warning
+	ReportWebhookRequired bool
+	// ScanJobTemplates treats ConfigMaps referenced by the pod templates of existing Jobs and CronJobs as used
+	ScanJobTemplates bool
+	// ScanEnvValues treats ConfigMaps whose exact name is the value of a container env var as used
+	ScanEnvValues bool
+	// ListPageSize is the number of pods or ConfigMaps requested per list call, the rest of the list is fetched in
+	// further pages. 0 requests pages of 500.
+	ListPageSize int64
+	// AllowStaleReads lists pods and ConfigMaps from the apiserver watch cache, which reduces etcd load but may
+	// miss changes made just before the scan. Stale reads can report a newly referenced ConfigMap as unused.
+	AllowStaleReads bool
+	// IncludeScanMetadata adds the scan start time, duration, kor version and options to structured output
+	IncludeScanMetadata bool
+	// PropagationPolicy is the deletion propagation policy (Foreground, Background or Orphan) sent with deletions,
+	// empty uses the default policy of each resource
+	PropagationPolicy string
+	// ForceRemoveFinalizers removes the finalizers of unused resources once their deletion was accepted. Without it
+	// resources with finalizers are reported as undeletable and left in place, as their deletion would wait on them.
+	ForceRemoveFinalizers bool
+	// BackupDir is where the full yaml of each ConfigMap is written as <namespace>/<name>.yaml before deleting it,
+	// empty writes no backups
+	BackupDir string
+	// RequireBackup leaves the ConfigMaps whose backup failed in place, without it they are deleted anyway
+	RequireBackup bool
+	// MinDeleteConfidence is the lowest confidence ("low" or "high") of a reference that keeps a ConfigMap from being
+	// deleted. With "low", ConfigMaps matched by any heuristic are kept even if the heuristics are disabled for reporting,
+	// and the references keeping them are reported.
+	MinDeleteConfidence string
+	// OmitEmptyNamespaces leaves namespaces without unused ConfigMaps out of the output and adds scan totals instead
+	OmitEmptyNamespaces bool
+	// ReportEmptiedNamespaces reports the namespaces left without user resources by the ConfigMap deletions of the run.
+	// Every namespaced resource served by the API server is checked through MetadataClient, and a namespace with a
+	// resource that can't be listed is never reported.
+	ReportEmptiedNamespaces bool
+	// DeleteEmptiedNamespaces deletes the namespaces reported by ReportEmptiedNamespaces
+	DeleteEmptiedNamespaces bool
+	// CheckDanglingKeys warns about ConfigMap keys referenced by pods that are missing from the ConfigMap
+	CheckDanglingKeys bool
+	// DeleteSelector is a label selector limiting deletion to the unused ConfigMaps it matches, the others are
+	// only reported
+	DeleteSelector string
+	// ImpersonateUser is the user all API requests are made as, e.g. to verify the RBAC of that user
+	ImpersonateUser string
+	// ImpersonateGroups are the groups all API requests are made as, along with ImpersonateUser
+	ImpersonateGroups []string
+	// PrometheusTextfile is a file the number of unused resources per namespace and kind is written to in the
+	// Prometheus text exposition format, for the node-exporter textfile collector
+	PrometheusTextfile string
+	// QuietErrors stops the errors and warnings that don't fail the command, such as the namespaces that failed to
+	// scan or the resources that failed to delete, from being printed to stderr. The warnings of a ConfigMap scan
+	// are still returned by GetUnusedConfigmapsWithWarnings
+	QuietErrors bool
+	// PerNamespaceTimeout bounds the time spent scanning a single namespace, a namespace that times out is
+	// reported as failed and the scan continues with the others. 0 means no timeout
+	PerNamespaceTimeout time.Duration
+	// EmitDeleteCommands outputs a kubectl delete command for each unused ConfigMap instead of the findings,
+	// nothing is deleted even with DeleteFlag
+	EmitDeleteCommands bool
+	// DeleteConcurrency is the number of resources deleted in parallel when no confirmation is prompted for
+	// each resource
+	DeleteConcurrency int
+	// FlatJSON outputs the findings in json and yaml as a single list of namespace, kind and name objects
+	// instead of a map per namespace and kind
+	FlatJSON bool
+	// UsedPredicate is consulted for each ConfigMap that passed the built-in checks, the ConfigMaps it reports
+	// as used are left out of the findings. Their reason is reported with ReportProtected.
+	UsedPredicate UsedPredicate `json:"-"`
+	// DeletedListFile is replaced after each run with the ConfigMaps deleted by the run, one namespace/name per line
+	DeletedListFile string
+	// ScanWorkloadAnnotations also looks up the ReferenceAnnotationKeys in the annotations of Deployments,
+	// DaemonSets and StatefulSets
+	ScanWorkloadAnnotations bool
+	// UserAgent is sent with all API requests so they can be told apart in audit logs, defaults to kor/<version>
+	UserAgent string
+	// DeletedWorkloadsWindow, when set, only reports the unused ConfigMaps that were referenced by the pod template
+	// of a workload whose deletion was reported by a Deleted event within the window. The references of the
+	// workloads are recorded in the StateFile, which is required.
+	DeletedWorkloadsWindow time.Duration
+	// IncludeResourceIdentity adds the UID and resourceVersion each unused ConfigMap was listed with to json and
+	// yaml output, to be used as delete preconditions
+	IncludeResourceIdentity bool
+	// OptInLabel, a key=value label, restricts scanning to the namespaces carrying it
+	OptInLabel string
+	// MetadataClient, when set, lists only the metadata of ConfigMaps unless a filter or option depends on
+	// their data. It is required to find the resources left in namespaces by ReportEmptiedNamespaces.
+	MetadataClient metadata.Interface `json:"-"`
+	// ScanWebhookCA treats the ConfigMaps named by the kor/ca-configmap annotation of validating and mutating
+	// webhook configurations as used
+	ScanWebhookCA bool
+	// ScanKEDA treats ConfigMaps referenced by KEDA TriggerAuthentications and ClusterTriggerAuthentications as used,
+	// listed through DynamicClient
+	ScanKEDA bool
+	// ScanGatewayAPI treats ConfigMaps referenced by Gateway API HTTPRoutes, Gateways and GatewayClasses as used,
+	// listed through DynamicClient at the preferred version of the group, v1beta1 or newer
+	ScanGatewayAPI bool
+	// DynamicClient lists the custom resources of opt-in collectors such as ScanKEDA
+	DynamicClient dynamic.Interface `json:"-"`
+	// GitHubAnnotations outputs a GitHub Actions warning annotation for each unused ConfigMap instead of the
+	// findings, attached to the file in its config.kubernetes.io/path annotation or else to its API path
+	GitHubAnnotations bool
+	// Shard restricts the scan to the namespaces of one shard, so several runs cover the cluster without overlap
+	Shard Shard
+	// ExplainNamespaces prints whether each namespace was selected for scanning and why to stderr
+	ExplainNamespaces bool
+	// OutputTargets are additional renderings of a ConfigMap scan, such as a json file next to the returned table.
+	// They are written even when EmitDeleteCommands or GitHubAnnotations replace the returned output.
+	OutputTargets []OutputTarget
+	// LogOutput receives the messages, prompts and warnings printed while scanning and deleting instead of stdout
+	// and stderr, io.Discard silences them
+	LogOutput io.Writer `json:"-"`
+	// ShowAge adds the age of each unused ConfigMap to the table output
+	ShowAge bool
+	// TimeFormat is the Go layout ages of unused ConfigMaps are rendered with by ShowAge, empty or "relative"
+	// renders them relative to the scan time, such as 3d ago
+	TimeFormat string
+}
+
+// Shard selects the namespaces whose name hashes to Index out of Total shards. A zero Total selects every namespace.
+type Shard struct {
+	Index int
+	Total int
+}
+
+// Includes reports whether the namespace belongs to the shard
+func (s Shard) Includes(namespace string) bool {
+	if s.Total <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(namespace))
+	return int(h.Sum32()%uint32(s.Total)) == s.Index
+}
+
+// Validate makes sure the shard index is within the number of shards
+func (s Shard) Validate() error {
+	if s.Total < 0 {
+		return fmt.Errorf("invalid shard total %d, must be non-negative", s.Total)
+	}
+	if s.Total > 0 && (s.Index < 0 || s.Index >= s.Total) {
+		return fmt.Errorf("invalid shard index %d, must be between 0 and %d", s.Index, s.Total-1)
+	}
+	if s.Total == 0 && s.Index != 0 {
+		return fmt.Errorf("shard index %d requires a shard total", s.Index)
+	}
+	return nil
+}
+
+// UsedPredicate decides whether the resource is used based on custom logic, such as an external inventory,
+// and returns the reason why it is
+type UsedPredicate func(meta metav1.ObjectMeta) (used bool, reason string)
+
+// Validate makes sure provided values for Opts are valid
+func (o Opts) Validate() error {
+	switch metav1.DeletionPropagation(o.PropagationPolicy) {
+	case "", metav1.DeletePropagationForeground, metav1.DeletePropagationBackground, metav1.DeletePropagationOrphan:
+	default:
+		return fmt.Errorf("invalid propagation policy %q, must be one of Foreground, Background or Orphan", o.PropagationPolicy)
+	}
+	if _, err := ParseReferenceConfidence(o.MinDeleteConfidence); err != nil {
+		return err
+	}
+	if _, err := labels.Parse(o.DeleteSelector); err != nil {
+		return fmt.Errorf("invalid delete selector: %w", err)
+	}
+	if _, err := parseOptInLabel(o.OptInLabel); err != nil {
+		return err
+	}
+	if err := o.Shard.Validate(); err != nil {
+		return err
+	}
+	if o.RequireBackup && o.BackupDir == "" {
+		return fmt.Errorf("require backup needs a backup directory")
+	}
+	for _, target := range o.OutputTargets {
+		if err := target.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := validateTimeFormat(o.TimeFormat); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateTimeFormat checks that the time format is "relative" or a Go layout with at least one layout element,
+// since a layout without any renders every age as the layout itself
+func validateTimeFormat(timeFormat string) error {
+	if timeFormat == "" || timeFormat == "relative" {
+		return nil
+	}
+	if time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC).Format(timeFormat) == timeFormat {
+		return fmt.Errorf("invalid time format %q, must be relative or a Go time layout such as 2006-01-02", timeFormat)
+	}
+	return nil
+}
+
+// parseOptInLabel parses a key=value opt-in label into a selector, an empty label selects every namespace
+func parseOptInLabel(optInLabel string) (labels.Selector, error) {
+	if optInLabel == "" {
+		return labels.Everything(), nil
+	}
+	key, value, found := strings.Cut(optInLabel, "=")
+	if !found {
+		return nil, fmt.Errorf("invalid opt-in label %q, must be key=value", optInLabel)
+	}
+	selector, err := labels.ValidatedSelectorFromSet(labels.Set{key: value})
+	if err != nil {
+		return nil, fmt.Errorf("invalid opt-in label %q: %w", optInLabel, err)
+	}
+	return selector, nil
+}
+
+// ClusterInfo identifies the cluster a report was generated against
+type ClusterInfo struct {
+	Host string `json:"host"`
+}
+
+type unusedResourceEnvelope struct {
+	Cluster           *ClusterInfo        `json:"cluster,omitempty"`
+	ResourceVersion   string              `json:"resourceVersion,omitempty"`
+	StaleExceptions   []ExceptionResource `json:"staleExceptions,omitempty"`
+	Protected         []ProtectedResource `json:"protected,omitempty"`
+	Kept              []KeptReference     `json:"kept,omitempty"`
+	Owners            []OwnerSummary      `json:"owners,omitempty"`
+	Metadata          *ScanMetadata       `json:"metadata,omitempty"`
+	Totals            *ScanTotals         `json:"totals,omitempty"`
+	EmptiedNamespaces []string            `json:"emptiedNamespaces,omitempty"`
+	Warnings          []string            `json:"warnings,omitempty"`
+	Namespaces        interface{}         `json:"namespaces"`
+}
+
+// ScanTotals counts the scanned namespaces and findings, including namespaces left out of the output
+type ScanTotals struct {
+	NamespacesScanned      int `json:"namespacesScanned"`
+	NamespacesWithFindings int `json:"namespacesWithFindings"`
+	Unused                 int `json:"unused"`
+}
+
+// ResourceFinding describes a single unused resource in structured output
+type ResourceFinding struct {
+	Name            string    `json:"name"`
+	Path            string    `json:"path,omitempty"`
+	UID             types.UID `json:"uid,omitempty"`
+	ResourceVersion string    `json:"resourceVersion,omitempty"`
+	FindingID       string    `json:"findingID"`
+}
+
+// ResourceIdentity is the UID and resourceVersion a resource was listed with, to delete it with preconditions,
+// and its creation time and finalizers
+type ResourceIdentity struct {
+	UID               types.UID
+	ResourceVersion   string
+	CreationTimestamp metav1.Time
+	Finalizers        []string
+}
+
+// FlatFinding is a single unused resource in flat structured output
+type FlatFinding struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	FindingID string `json:"findingID"`
+}
+
+// FindingID returns a stable identifier of an unused resource, so integrations such as ticketing can recognize
+// the same finding across runs. Suffixes added when deleting don't change the identifier.
+func FindingID(cluster, namespace, kind, name string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{cluster, namespace, kind, resourceNameFromDiff(name)}, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// clusterIdentityNamespace is the namespace whose UID identifies the cluster, as it exists for the lifetime of the
+// cluster whichever address its API server is reached at
+const clusterIdentityNamespace = "kube-system"
+
+// resolveFindingCluster returns the cluster findings are identified with: the UID of the kube-system namespace, or
+// the API server of the cluster info when the namespace can't be read. Findings of different clusters would
+// otherwise share their IDs, so an unidentified cluster is an error.
+func resolveFindingCluster(clientset kubernetes.Interface, opts Opts) (string, error) {
+	namespace, err := clientset.CoreV1().Namespaces().Get(context.TODO(), clusterIdentityNamespace, metav1.GetOptions{})
+	if err == nil && namespace.UID != "" {
+		return string(namespace.UID), nil
+	}
+	if opts.ClusterInfo != nil && opts.ClusterInfo.Host != "" {
+		return opts.ClusterInfo.Host, nil
+	}
+	if err == nil {
+		err = fmt.Errorf("namespace %s has no UID", clusterIdentityNamespace)
+	}
+	return "", fmt.Errorf("%w: %w, grant get access to the %s namespace or set the cluster info, with --include-cluster-info", ErrClusterIdentity, err, clusterIdentityNamespace)
+}
+
+// flattenFindings returns the unused resources of kind per namespace as a single list sorted by namespace
+func flattenFindings(cluster, kind string, unused map[string][]string) []FlatFinding {
+	namespaces := make([]string, 0, len(unused))
+	for namespace := range unused {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	findings := []FlatFinding{}
+	for _, namespace := range namespaces {
+		for _, name := range unused[namespace] {
+			findings = append(findings, FlatFinding{Namespace: namespace, Kind: kind, Name: name, FindingID: FindingID(cluster, namespace, kind, name)})
+		}
+	}
+	return findings
 }
 
 func RemoveDuplicatesAndSort(slice []string) []string {
@@ -53,20 +496,13 @@ func GetKubeConfigPath() string {
 	return filepath.Join(home, ".kube", "config")
 }
 
-func GetKubeClient(kubeconfig string) *kubernetes.Clientset {
+func GetKubeConfig(kubeconfig string) (*rest.Config, error) {
 	if _, err := os.Stat("/var/run/secrets/kubernetes.io/serviceaccount/token"); err == nil {
 		config, err := rest.InClusterConfig()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to load kubeconfig: %v\n", err)
-			os.Exit(1)
-		}
-
-		clientset, err := kubernetes.NewForConfig(config)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to create Kubernetes client: %v\n", err)
-			os.Exit(1)
+			return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
 		}
-		return clientset
+		return config, nil
 	}
 	if kubeconfig == "" {
 		if configEnv := os.Getenv("KUBECONFIG"); configEnv != "" {
@@ -77,59 +513,221 @@ func GetKubeClient(kubeconfig string) *kubernetes.Clientset {
 	}
 	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to load kubeconfig: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
 	}
+	return config, nil
+}
+
+func GetKubeClient(kubeconfig string) (*kubernetes.Clientset, error) {
+	return GetKubeClientWithQPS(kubeconfig, 0)
+}
+
+// GetKubeClientWithQPS returns a client limited to qps requests per second, zero keeps the client-go default
+func GetKubeClientWithQPS(kubeconfig string, qps float32) (*kubernetes.Clientset, error) {
+	return GetKubeClientWithOpts(kubeconfig, Opts{QPS: qps})
+}
 
+// GetKubeClientWithOpts returns a client configured with the client options of opts, see applyClientOpts
+func GetKubeClientWithOpts(kubeconfig string, opts Opts) (*kubernetes.Clientset, error) {
+	config, err := GetKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	applyClientOpts(config, opts)
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create Kubernetes client: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
 	}
-	return clientset
+	return clientset, nil
 }
 
-func SetNamespaceList(namespaceLists IncludeExcludeLists, clientset kubernetes.Interface) []string {
+// GetMetadataClientWithOpts returns a metadata-only client configured with the client options of opts
+func GetMetadataClientWithOpts(kubeconfig string, opts Opts) (metadata.Interface, error) {
+	config, err := GetKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	applyClientOpts(config, opts)
+	metadataClient, err := metadata.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes metadata client: %w", err)
+	}
+	return metadataClient, nil
+}
+
+// GetDynamicClientWithOpts returns a dynamic client configured with the client options of opts
+func GetDynamicClientWithOpts(kubeconfig string, opts Opts) (dynamic.Interface, error) {
+	config, err := GetKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	applyClientOpts(config, opts)
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes dynamic client: %w", err)
+	}
+	return dynamicClient, nil
+}
+
+// applyClientOpts sets the request rate limit and burst, the impersonated user and groups and the User-Agent of opts on config
+func applyClientOpts(config *rest.Config, opts Opts) {
+	config.UserAgent = opts.UserAgent
+	if config.UserAgent == "" {
+		config.UserAgent = "kor/" + korVersion()
+	}
+	if opts.QPS > 0 {
+		config.QPS = opts.QPS
+		if burst := int(math.Ceil(float64(opts.QPS))); burst > rest.DefaultBurst {
+			config.Burst = burst
+		}
+	}
+	if opts.Burst > 0 {
+		config.Burst = opts.Burst
+	}
+	if opts.ImpersonateUser != "" || len(opts.ImpersonateGroups) > 0 {
+		config.Impersonate = rest.ImpersonationConfig{UserName: opts.ImpersonateUser, Groups: opts.ImpersonateGroups}
+	}
+}
+
+// NewClusterInfo returns the identity of the cluster targeted by the rest config
+func NewClusterInfo(config *rest.Config) *ClusterInfo {
+	return &ClusterInfo{Host: config.Host}
+}
+
+// Reasons a namespace was selected or excluded by SetNamespaceListWithDecisions
+const (
+	NamespaceReasonIncludeList   = "include-list"
+	NamespaceReasonExcludeList   = "exclude-list"
+	NamespaceReasonExcludeRegex  = "exclude-regex"
+	NamespaceReasonLabel         = "label"
+	NamespaceReasonShard         = "shard"
+	NamespaceReasonSystemDefault = "system-default"
+	NamespaceReasonTerminating   = "terminating"
+)
+
+// NamespaceDecision is whether a namespace was selected for scanning and why
+type NamespaceDecision struct {
+	Namespace string `json:"namespace"`
+	Included  bool   `json:"included"`
+	Reason    string `json:"reason"`
+}
+
+// SetNamespaceList returns the namespaces to scan. When opts.OptInLabel is set, only the namespaces labeled with
+// it are scanned, including when they are listed in the include list, and only the namespaces of opts.Shard.
+// With opts.ExplainNamespaces the decision made for each namespace is printed to stderr.
+func SetNamespaceList(namespaceLists IncludeExcludeLists, clientset kubernetes.Interface, opts Opts) ([]string, error) {
+	namespaces, decisions, err := SetNamespaceListWithDecisions(namespaceLists, clientset, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ExplainNamespaces {
+		for _, decision := range decisions {
+			verdict := "excluded"
+			if decision.Included {
+				verdict = "included"
+			}
+			fmt.Fprintf(opts.stderr(), "Namespace %s %s: %s\n", decision.Namespace, verdict, decision.Reason)
+		}
+	}
+	return namespaces, nil
+}
+
+// SetNamespaceListWithDecisions returns the namespaces to scan like SetNamespaceList, along with the decision made
+// for every namespace of the cluster sorted by name. Namespaces are included by the include list, or by the system
+// default without one. Terminating namespaces are always excluded.
+func SetNamespaceListWithDecisions(namespaceLists IncludeExcludeLists, clientset kubernetes.Interface, opts Opts) ([]string, []NamespaceDecision, error) {
 	namespaces := make([]string, 0)
 	namespacesMap := make(map[string]bool)
+	reasons := make(map[string]string)
 	if namespaceLists.IncludeListStr != "" && namespaceLists.ExcludeListStr != "" {
-		fmt.Fprintf(os.Stderr, "Exclude namespaces can't be used together with include namespaces. Ignoring --exclude-namespace(-e) flag\n")
+		fmt.Fprintf(opts.stderr(), "Exclude namespaces can't be used together with include namespaces. Ignoring --exclude-namespace(-e) flag\n")
 		namespaceLists.ExcludeListStr = ""
 	}
+	if namespaceLists.IncludeListStr != "" && namespaceLists.NamespaceExcludeRegex != "" {
+		fmt.Fprintf(opts.stderr(), "Exclude namespaces regex can't be used together with include namespaces. Ignoring --exclude-namespaces-regex flag\n")
+		namespaceLists.NamespaceExcludeRegex = ""
+	}
+	excludeRegex, err := compileNamespaceExcludeRegex(namespaceLists.NamespaceExcludeRegex)
+	if err != nil {
+		return nil, nil, err
+	}
+	optInSelector, err := parseOptInLabel(opts.OptInLabel)
+	if err != nil {
+		return nil, nil, err
+	}
 	includeNamespaces := strings.Split(namespaceLists.IncludeListStr, ",")
 	excludeNamespaces := strings.Split(namespaceLists.ExcludeListStr, ",")
 	namespaceList, err := clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to retrieve namespaces: %v\n", err)
-		os.Exit(1)
+		return nil, nil, fmt.Errorf("%w: %w", ErrListNamespaces, err)
+	}
+	// Resources of terminating namespaces can't be deleted and are about to be removed anyway
+	terminating := make(map[string]bool)
+	optedOut := make(map[string]bool)
+	for _, ns := range namespaceList.Items {
+		if ns.DeletionTimestamp != nil {
+			terminating[ns.Name] = true
+		}
+		if !optInSelector.Matches(labels.Set(ns.Labels)) {
+			optedOut[ns.Name] = true
+		}
 	}
 	if namespaceLists.IncludeListStr != "" {
 		for _, ns := range namespaceList.Items {
 			namespacesMap[ns.Name] = false
+			reasons[ns.Name] = NamespaceReasonIncludeList
 		}
 		for _, ns := range includeNamespaces {
 			if _, exists := namespacesMap[ns]; exists {
 				namespacesMap[ns] = true
 			} else {
-				fmt.Fprintf(os.Stderr, "namespace [%s] not found\n", ns)
+				opts.printError("namespace [%s] not found\n", ns)
 			}
 		}
 	} else {
 		for _, ns := range namespaceList.Items {
 			namespacesMap[ns.Name] = true
+			reasons[ns.Name] = NamespaceReasonSystemDefault
 		}
 		for _, ns := range excludeNamespaces {
 			if _, exists := namespacesMap[ns]; exists {
 				namespacesMap[ns] = false
+				reasons[ns] = NamespaceReasonExcludeList
+			}
+		}
+		if excludeRegex != nil {
+			for ns := range namespacesMap {
+				if namespacesMap[ns] && excludeRegex.MatchString(ns) {
+					namespacesMap[ns] = false
+					reasons[ns] = NamespaceReasonExcludeRegex
+				}
 			}
 		}
 	}
+	decisions := make([]NamespaceDecision, 0, len(namespacesMap))
 	for ns := range namespacesMap {
-		if namespacesMap[ns] {
+		decision := NamespaceDecision{Namespace: ns, Included: namespacesMap[ns], Reason: reasons[ns]}
+		switch {
+		case !decision.Included:
+		case terminating[ns]:
+			decision.Included, decision.Reason = false, NamespaceReasonTerminating
+		case optedOut[ns]:
+			decision.Included, decision.Reason = false, NamespaceReasonLabel
+		case !opts.Shard.Includes(ns):
+			decision.Included, decision.Reason = false, NamespaceReasonShard
+		default:
 			namespaces = append(namespaces, ns)
 		}
+		decisions = append(decisions, decision)
 	}
-	return namespaces
+	sort.Slice(decisions, func(i, j int) bool { return decisions[i].Namespace < decisions[j].Namespace })
+	return namespaces, decisions, nil
+}
+
+type outputHeaderData struct {
+	Kind      string
+	Namespace string
+	Count     int
 }
 
 func FormatOutput(namespace string, resources []string, resourceType string) string {
@@ -137,17 +735,129 @@ func FormatOutput(namespace string, resources []string, resourceType string) str
 		return fmt.Sprintf("No unused %s found in the namespace: %s \n", resourceType, namespace)
 	}
 
+	return fmt.Sprintf("Unused %s in Namespace: %s\n%s", resourceType, namespace, formatResourceTable(resources))
+}
+
+// FormatUsedOutput formats the resources found in use in the namespace
+func FormatUsedOutput(namespace string, resources []string, resourceType string) string {
+	return fmt.Sprintf("Used %s in Namespace: %s\n%s", resourceType, namespace, formatResourceTable(resources))
+}
+
+// FormatStaleExceptions formats the exceptions that matched no resource during the scan
+func FormatStaleExceptions(exceptions []ExceptionResource) string {
+	if len(exceptions) == 0 {
+		return "No stale exceptions found\n"
+	}
+
 	var buf bytes.Buffer
 	table := tablewriter.NewWriter(&buf)
-	table.SetHeader([]string{"#", "Resource Name"})
+	table.SetHeader([]string{"#", "Namespace", "Resource Name"})
+
+	for i, exception := range exceptions {
+		table.Append([]string{fmt.Sprintf("%d", i+1), exception.Namespace, exception.ResourceName})
+	}
+
+	table.Render()
+	return fmt.Sprintf("Stale exceptions matching no resource:\n%s", buf.String())
+}
+
+// FormatProtectedResources formats the resources kept from being reported as unused and their protection source
+func FormatProtectedResources(protected []ProtectedResource) string {
+	if len(protected) == 0 {
+		return "No protected resources found\n"
+	}
+
+	var buf bytes.Buffer
+	table := tablewriter.NewWriter(&buf)
+	table.SetHeader([]string{"#", "Namespace", "Resource Name", "Source", "Reason"})
+
+	for i, resource := range protected {
+		table.Append([]string{fmt.Sprintf("%d", i+1), resource.Namespace, resource.ResourceName, resource.Source, resource.Reason})
+	}
+
+	table.Render()
+	return fmt.Sprintf("Protected resources:\n%s", buf.String())
+}
+
+// FormatOutputWithOpts formats like FormatOutput using the display name and header template from opts when set
+func FormatOutputWithOpts(namespace string, resources []string, resourceType string, opts Opts) (string, error) {
+	return formatOutputWithAges(namespace, resources, resourceType, nil, opts)
+}
+
+// formatOutputWithAges formats like FormatOutputWithOpts, adding an age column when ages has one per resource
+func formatOutputWithAges(namespace string, resources []string, resourceType string, ages []string, opts Opts) (string, error) {
+	if opts.DisplayName != "" {
+		resourceType = opts.DisplayName
+	}
+	if opts.HeaderTemplate == "" {
+		if len(resources) == 0 {
+			return FormatOutput(namespace, resources, resourceType), nil
+		}
+		return fmt.Sprintf("Unused %s in Namespace: %s\n%s", resourceType, namespace, formatResourceTableWithAges(resources, ages)), nil
+	}
+
+	tmpl, err := template.New("header").Parse(opts.HeaderTemplate)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid header template: %w", ErrFormat, err)
+	}
+	var header bytes.Buffer
+	if err := tmpl.Execute(&header, outputHeaderData{Kind: resourceType, Namespace: namespace, Count: len(resources)}); err != nil {
+		return "", fmt.Errorf("%w: failed to render header template: %w", ErrFormat, err)
+	}
+
+	if len(resources) == 0 {
+		return header.String() + "\n", nil
+	}
+	return fmt.Sprintf("%s\n%s", header.String(), formatResourceTableWithAges(resources, ages)), nil
+}
+
+func formatResourceTable(resources []string) string {
+	return formatResourceTableWithAges(resources, nil)
+}
+
+func formatResourceTableWithAges(resources []string, ages []string) string {
+	withAges := len(ages) == len(resources)
+	var buf bytes.Buffer
+	table := tablewriter.NewWriter(&buf)
+	if withAges {
+		table.SetHeader([]string{"#", "Resource Name", "Age"})
+	} else {
+		table.SetHeader([]string{"#", "Resource Name"})
+	}
 
 	for i, name := range resources {
-		table.Append([]string{fmt.Sprintf("%d", i+1), name})
+		row := []string{fmt.Sprintf("%d", i+1), name}
+		if withAges {
+			row = append(row, ages[i])
+		}
+		table.Append(row)
 	}
 
 	table.Render()
+	return buf.String()
+}
 
-	return fmt.Sprintf("Unused %s in Namespace: %s\n%s", resourceType, namespace, buf.String())
+// FormatAge renders the creation time of a resource with the Go layout timeFormat, or relative to now, such as
+// 3d ago, when timeFormat is empty or "relative". An unknown creation time renders empty.
+func FormatAge(created, now time.Time, timeFormat string) string {
+	if created.IsZero() {
+		return ""
+	}
+	if timeFormat != "" && timeFormat != "relative" {
+		return created.Format(timeFormat)
+	}
+
+	age := now.Sub(created)
+	switch {
+	case age < time.Minute:
+		return fmt.Sprintf("%ds ago", int(age.Seconds()))
+	case age < time.Hour:
+		return fmt.Sprintf("%dm ago", int(age.Minutes()))
+	case age < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(age.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(age.Hours()/24))
+	}
 }
 
 func FormatOutputAll(namespace string, allDiffs []ResourceDiff) string {
@@ -182,6 +892,8 @@ func FormatOutputAll(namespace string, allDiffs []ResourceDiff) string {
 
 // TODO create formatter by resource "#", "Resource Name", "Namespace"
 
+// CalculateResourceDifference returns the resources of allResourceNames missing from usedResourceNames. Names are
+// compared without their namespace, so both lists must belong to the same namespace.
 func CalculateResourceDifference(usedResourceNames []string, allResourceNames []string) []string {
 	var difference []string
 	for _, name := range allResourceNames {
@@ -199,25 +911,208 @@ func CalculateResourceDifference(usedResourceNames []string, allResourceNames []
 	return difference
 }
 
-func unusedResourceFormatter(outputFormat string, outputBuffer bytes.Buffer, opts Opts, jsonResponse []byte) (string, error) {
-	if outputFormat == "table" {
+// resourceNameFromDiff strips the suffixes DeleteResourceWithLimit adds to resource names.
+// Kubernetes names are lowercase so the suffixes can't be part of the name itself.
+func resourceNameFromDiff(entry string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(entry, "-DELETED"), "-SKIPPED"), "-UNDELETABLE")
+}
 
-		if opts.WebhookURL != "" || opts.Channel != "" && opts.Token != "" {
-			if err := SendToSlack(SlackMessage{}, opts, outputBuffer.String()); err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to send message to slack: %v\n", err)
-				os.Exit(1)
-			}
-		} else {
-			return outputBuffer.String(), nil
+// resourceStatusFromDiff returns the lowercased suffix resourceNameFromDiff strips, or "" when entry has none
+func resourceStatusFromDiff(entry string) string {
+	if name := resourceNameFromDiff(entry); name != entry {
+		return strings.ToLower(strings.TrimPrefix(entry, name+"-"))
+	}
+	return ""
+}
+
+func marshalResponse(response interface{}, opts Opts) ([]byte, error) {
+	return marshalEnvelope(unusedResourceEnvelope{Cluster: opts.ClusterInfo, Namespaces: response}, opts.ClusterInfo != nil)
+}
+
+// marshalEnvelope returns the bare namespaces response unless wrap is set
+func marshalEnvelope(envelope unusedResourceEnvelope, wrap bool) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeEnvelope(&buf, envelope, wrap); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeEnvelope writes the report marshalEnvelope returns to w. The namespaces response, the bulk of the report, is
+// streamed with encodeIndented after the other fields of the envelope.
+func encodeEnvelope(w io.Writer, envelope unusedResourceEnvelope, wrap bool) error {
+	if !wrap {
+		return encodeIndented(w, envelope.Namespaces)
+	}
+	namespaces := envelope.Namespaces
+	envelope.Namespaces = nil
+	header, err := json.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		return err
+	}
+	// namespaces is the last field of the envelope, encoded as null in its place
+	header = bytes.TrimSuffix(header, []byte("null\n}"))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if err := encodeIndentedWithPrefix(w, namespaces, "  "); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n}")
+	return err
+}
+
+// encodeIndented writes v to w like json.MarshalIndent(v, "", "  "). Maps such as the per namespace response are
+// written one entry at a time, so only a single namespace is held encoded in memory rather than the whole report.
+func encodeIndented(w io.Writer, v interface{}) error {
+	return encodeIndentedWithPrefix(w, v, "")
+}
+
+// encodeIndentedWithPrefix writes v to w like json.MarshalIndent(v, prefix, "  ") without the prefix of the first
+// line, as encodeIndented does
+func encodeIndentedWithPrefix(w io.Writer, v interface{}, prefix string) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Map || value.Type().Key().Kind() != reflect.String || value.IsNil() || value.Len() == 0 {
+		data, err := json.MarshalIndent(v, prefix, "  ")
+		if err != nil {
+			return err
 		}
-	} else {
-		if outputFormat == "yaml" {
-			yamlResponse, err := yaml.JSONToYAML(jsonResponse)
-			if err != nil {
-				fmt.Printf("err: %v\n", err)
-			}
-			return string(yamlResponse), nil
+		_, err = w.Write(data)
+		return err
+	}
+
+	keys := value.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	if _, err := io.WriteString(w, "{\n"); err != nil {
+		return err
+	}
+	for i, key := range keys {
+		encodedKey, err := json.Marshal(key.String())
+		if err != nil {
+			return err
+		}
+		encodedValue, err := json.MarshalIndent(value.MapIndex(key).Interface(), prefix+"  ", "  ")
+		if err != nil {
+			return err
+		}
+		separator := ",\n"
+		if i == len(keys)-1 {
+			separator = "\n"
+		}
+		if _, err := fmt.Fprintf(w, "%s  %s: %s%s", prefix, encodedKey, encodedValue, separator); err != nil {
+			return err
 		}
 	}
+	_, err := io.WriteString(w, prefix+"}")
+	return err
+}
+
+// resourceOutputFormats lists the output formats rendered from the scan output of every resource kind
+var resourceOutputFormats = []string{"table", "json", "yaml"}
+
+// findingRenderer renders the unused resources of kind per namespace, found by a scan started at startedAt
+type findingRenderer func(kind string, unused map[string][]string, startedAt time.Time) (string, error)
+
+// findingRenderers registers the output formats that only depend on the findings, by format name.
+// They are supported by the configmap command and its output targets.
+var findingRenderers = map[string]findingRenderer{
+	CustomResourceOutputFormat: func(kind string, unused map[string][]string, _ time.Time) (string, error) {
+		return renderOrphanReport(kind, unused)
+	},
+	TreeOutputFormat: func(kind string, unused map[string][]string, _ time.Time) (string, error) {
+		report := make(map[string]map[string][]string, len(unused))
+		for namespace, diff := range unused {
+			report[namespace] = map[string][]string{kind: diff}
+		}
+		return renderTree(report), nil
+	},
+	RemoteWriteOutputFormat: renderRemoteWriteSamples,
+}
+
+// supportedOutputFormats lists the values accepted for the output format: the resource formats followed by the
+// registered finding formats in name order
+func supportedOutputFormats() []string {
+	formats := append([]string{}, resourceOutputFormats...)
+	findingFormats := make([]string, 0, len(findingRenderers))
+	for format := range findingRenderers {
+		findingFormats = append(findingFormats, format)
+	}
+	sort.Strings(findingFormats)
+	return append(formats, findingFormats...)
+}
+
+// trimTrailingBlankLines removes the trailing whitespace and blank lines of text output, keeping the final newline
+func trimTrailingBlankLines(output string) string {
+	trimmed := strings.TrimRightFunc(output, unicode.IsSpace)
+	if trimmed == "" {
+		return ""
+	}
+	return trimmed + "\n"
+}
+
+func unusedResourceFormatter(outputFormat string, outputBuffer bytes.Buffer, opts Opts, jsonResponse []byte) (string, error) {
+	switch outputFormat {
+	case "table":
+		output := trimTrailingBlankLines(outputBuffer.String())
+		if !slackConfigured(opts) {
+			return output, nil
+		}
+		if err := SendToSlack(SlackMessage{}, opts, output); err != nil {
+			return "", fmt.Errorf("failed to send message to slack: %w", err)
+		}
+	case "yaml":
+		yamlResponse, err := yaml.JSONToYAML(jsonResponse)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrFormat, err)
+		}
+		return string(yamlResponse), nil
+	case "json":
+	default:
+		if _, ok := findingRenderers[outputFormat]; ok {
+			return "", fmt.Errorf("%w: output format %q is only supported for configmaps (supported: %s)", ErrFormat, outputFormat, strings.Join(resourceOutputFormats, ", "))
+		}
+		return "", fmt.Errorf("%w: unsupported output format %q (supported: %s)", ErrFormat, outputFormat, strings.Join(supportedOutputFormats(), ", "))
+	}
 	return string(jsonResponse), nil
 }
+
+// slackConfigured reports whether the output is sent to Slack rather than returned
+func slackConfigured(opts Opts) bool {
+	return opts.WebhookURL != "" || opts.Channel != "" && opts.Token != ""
+}
+
+// sendTextOutput sends text output that isn't a table to Slack like the table output when Slack is configured,
+// returning nothing as the output then went to Slack instead
+func sendTextOutput(opts Opts, output string) (string, error) {
+	if !slackConfigured(opts) {
+		return output, nil
+	}
+	if err := SendToSlack(SlackMessage{}, opts, output); err != nil {
+		return "", fmt.Errorf("failed to send message to slack: %w", err)
+	}
+	return "", nil
+}
+
+// stdout is where progress messages and prompts are printed, opts.LogOutput when set
+func (o Opts) stdout() io.Writer {
+	if o.LogOutput != nil {
+		return o.LogOutput
+	}
+	return os.Stdout
+}
+
+// stderr is where errors and warnings are printed, opts.LogOutput when set
+func (o Opts) stderr() io.Writer {
+	if o.LogOutput != nil {
+		return o.LogOutput
+	}
+	return os.Stderr
+}
+
+// printError prints an error or warning that doesn't fail the command to stderr, unless QuietErrors is set
+func (o Opts) printError(format string, args ...interface{}) {
+	if o.QuietErrors {
+		return
+	}
+	fmt.Fprintf(o.stderr(), format, args...)
+}
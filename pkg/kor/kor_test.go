@@ -1,9 +1,29 @@
 package kor
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"reflect"
 	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func stringSlicesEqual(a, b []string) bool {
@@ -99,8 +119,8 @@ func TestGetKubeClientFromEnvVar(t *testing.T) {
 	defer os.Setenv("KUBECONFIG", originalKCEnv)
 	os.Setenv("KUBECONFIG", configFile.Name())
 
-	kcs := GetKubeClient("")
-	if kcs == nil {
+	kcs, err := GetKubeClient("")
+	if err != nil || kcs == nil {
 		t.Errorf("Expected valid clientSet")
 	}
 }
@@ -125,8 +145,492 @@ func TestGetKubeClientFromInput(t *testing.T) {
 		os.Setenv("KUBERNETES_SERVICE_PORT", oldKubeServicePort)
 	}()
 
-	kcs := GetKubeClient(configFile.Name())
-	if kcs == nil {
+	kcs, err := GetKubeClient(configFile.Name())
+	if err != nil || kcs == nil {
 		t.Errorf("Expected valid clientSet")
 	}
 }
+
+func TestNewClusterInfo(t *testing.T) {
+	config := &rest.Config{Host: "https://cluster.example.com:6443"}
+
+	clusterInfo := NewClusterInfo(config)
+	if clusterInfo.Host != config.Host {
+		t.Errorf("Expected host %s, got %s", config.Host, clusterInfo.Host)
+	}
+}
+
+func TestApplyClientOptsImpersonation(t *testing.T) {
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"kind":"NamespaceList","apiVersion":"v1","items":[]}`))
+	}))
+	defer server.Close()
+
+	config := &rest.Config{Host: server.URL}
+	applyClientOpts(config, Opts{ImpersonateUser: "auditor", ImpersonateGroups: []string{"security", "readers"}})
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		t.Fatalf("Error creating clientset: %v", err)
+	}
+	if _, err := clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{}); err != nil {
+		t.Fatalf("Error listing namespaces: %v", err)
+	}
+
+	if user := headers.Get("Impersonate-User"); user != "auditor" {
+		t.Errorf("Expected Impersonate-User auditor, got %q", user)
+	}
+	if groups := headers.Values("Impersonate-Group"); !reflect.DeepEqual(groups, []string{"security", "readers"}) {
+		t.Errorf("Expected Impersonate-Group security and readers, got %v", groups)
+	}
+}
+
+func TestApplyClientOptsBurst(t *testing.T) {
+	for _, test := range []struct {
+		opts  Opts
+		burst int
+	}{
+		{opts: Opts{}, burst: 0},
+		{opts: Opts{QPS: 2}, burst: 0},
+		{opts: Opts{QPS: 50.5}, burst: 51},
+		{opts: Opts{QPS: 2, Burst: 30}, burst: 30},
+	} {
+		config := &rest.Config{}
+		applyClientOpts(config, test.opts)
+		if config.Burst != test.burst {
+			t.Errorf("Expected burst %d with QPS %v and burst %d, got %d", test.burst, test.opts.QPS, test.opts.Burst, config.Burst)
+		}
+	}
+}
+
+func TestApplyClientOptsUserAgent(t *testing.T) {
+	config := &rest.Config{}
+	applyClientOpts(config, Opts{})
+	if expected := "kor/" + korVersion(); config.UserAgent != expected {
+		t.Errorf("Expected the default User-Agent %q, got %q", expected, config.UserAgent)
+	}
+
+	applyClientOpts(config, Opts{UserAgent: "kor-audit/1.0"})
+	if config.UserAgent != "kor-audit/1.0" {
+		t.Errorf("Expected the User-Agent kor-audit/1.0, got %q", config.UserAgent)
+	}
+}
+
+func TestFormatOutputWithOpts(t *testing.T) {
+	output, err := FormatOutputWithOpts("ns1", []string{"cm1", "cm2"}, "Configmaps", Opts{})
+	if err != nil {
+		t.Fatalf("Error formatting output: %v", err)
+	}
+	if output != FormatOutput("ns1", []string{"cm1", "cm2"}, "Configmaps") {
+		t.Errorf("Expected default output to match FormatOutput, got %s", output)
+	}
+
+	opts := Opts{
+		DisplayName:    "Config Maps",
+		HeaderTemplate: "{{.Count}} unused {{.Kind}} in {{.Namespace}}",
+	}
+	output, err = FormatOutputWithOpts("ns1", []string{"cm1", "cm2"}, "Configmaps", opts)
+	if err != nil {
+		t.Fatalf("Error formatting output: %v", err)
+	}
+	if !strings.HasPrefix(output, "2 unused Config Maps in ns1\n") {
+		t.Errorf("Expected custom header, got %s", output)
+	}
+	if !strings.Contains(output, "cm2") {
+		t.Errorf("Expected resources table in output, got %s", output)
+	}
+
+	if _, err := FormatOutputWithOpts("ns1", nil, "Configmaps", Opts{HeaderTemplate: "{{.Count"}); err == nil {
+		t.Errorf("Expected error for invalid header template")
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	created := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	now := created.Add(3*24*time.Hour + 5*time.Hour)
+
+	for timeFormat, expected := range map[string]string{
+		"":           "3d ago",
+		"relative":   "3d ago",
+		time.RFC3339: "2024-03-01T12:00:00Z",
+		"02.01.2006": "01.03.2024",
+	} {
+		if age := FormatAge(created, now, timeFormat); age != expected {
+			t.Errorf("Expected age %q with time format %q, got %q", expected, timeFormat, age)
+		}
+	}
+	if age := FormatAge(created, created.Add(90*time.Minute), ""); age != "1h ago" {
+		t.Errorf("Expected age 1h ago, got %q", age)
+	}
+
+	output, err := formatOutputWithAges("ns1", []string{"cm1"}, "Configmaps", []string{FormatAge(created, now, "")}, Opts{})
+	if err != nil {
+		t.Fatalf("Error formatting output: %v", err)
+	}
+	if !strings.Contains(output, "AGE") || !strings.Contains(output, "3d ago") {
+		t.Errorf("Expected an age column in output, got %s", output)
+	}
+}
+
+func TestOptsValidateTimeFormat(t *testing.T) {
+	for _, timeFormat := range []string{"", "relative", time.RFC3339, "02.01.2006"} {
+		if err := (Opts{TimeFormat: timeFormat}).Validate(); err != nil {
+			t.Errorf("Expected time format %q to be valid, got %v", timeFormat, err)
+		}
+	}
+	for _, timeFormat := range []string{"relativ", "iso"} {
+		if err := (Opts{TimeFormat: timeFormat}).Validate(); err == nil {
+			t.Errorf("Expected time format %q to be rejected", timeFormat)
+		}
+	}
+}
+
+func TestSetNamespaceListExcludeRegex(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	for _, ns := range []string{"pr-1234", "pr-5678", "default", "app-pr-1"} {
+		_, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: ns},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatalf("Error creating namespace %s: %v", ns, err)
+		}
+	}
+
+	namespaces, err := SetNamespaceList(IncludeExcludeLists{NamespaceExcludeRegex: "pr-.*"}, clientset, Opts{})
+	if err != nil {
+		t.Fatalf("Error calling SetNamespaceList: %v", err)
+	}
+
+	expected := []string{"app-pr-1", "default"}
+	if !stringSlicesEqual(namespaces, expected) {
+		t.Errorf("Expected namespaces %v, got %v", expected, namespaces)
+	}
+}
+
+func TestSetNamespaceListErrors(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	if _, err := SetNamespaceList(IncludeExcludeLists{NamespaceExcludeRegex: "pr-("}, clientset, Opts{}); err == nil {
+		t.Error("Expected an invalid exclude regex to be returned as an error")
+	}
+
+	clientset.PrependReactor("list", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "namespaces"}, "", nil)
+	})
+	if _, err := SetNamespaceList(IncludeExcludeLists{}, clientset, Opts{}); !errors.Is(err, ErrListNamespaces) {
+		t.Errorf("Expected ErrListNamespaces when namespaces can't be listed, got %v", err)
+	}
+	if _, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{}); !errors.Is(err, ErrListNamespaces) {
+		t.Errorf("Expected the scan to fail with ErrListNamespaces, got %v", err)
+	}
+}
+
+func TestSetNamespaceListSkipsTerminating(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	deletionTimestamp := metav1.Now()
+	for _, ns := range []*corev1.Namespace{
+		{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "stuck", DeletionTimestamp: &deletionTimestamp, Finalizers: []string{"kubernetes"}}},
+	} {
+		if _, err := clientset.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating namespace %s: %v", ns.Name, err)
+		}
+	}
+
+	for _, lists := range []IncludeExcludeLists{{}, {IncludeListStr: "default,stuck"}} {
+		namespaces, err := SetNamespaceList(lists, clientset, Opts{})
+		if err != nil {
+			t.Fatalf("Error calling SetNamespaceList: %v", err)
+		}
+
+		expected := []string{"default"}
+		if !stringSlicesEqual(namespaces, expected) {
+			t.Errorf("Expected namespaces %v, got %v", expected, namespaces)
+		}
+	}
+}
+
+func TestSetNamespaceListWithDecisions(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	deletionTimestamp := metav1.Now()
+	for _, ns := range []*corev1.Namespace{
+		{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "pr-1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "sandbox"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "stuck", DeletionTimestamp: &deletionTimestamp, Finalizers: []string{"kubernetes"}}},
+	} {
+		if _, err := clientset.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating namespace %s: %v", ns.Name, err)
+		}
+	}
+
+	lists := IncludeExcludeLists{ExcludeListStr: "sandbox", NamespaceExcludeRegex: "pr-.*"}
+	namespaces, decisions, err := SetNamespaceListWithDecisions(lists, clientset, Opts{})
+	if err != nil {
+		t.Fatalf("Error calling SetNamespaceListWithDecisions: %v", err)
+	}
+	if expected := []string{"default"}; !stringSlicesEqual(namespaces, expected) {
+		t.Errorf("Expected namespaces %v, got %v", expected, namespaces)
+	}
+	expected := []NamespaceDecision{
+		{Namespace: "default", Included: true, Reason: NamespaceReasonSystemDefault},
+		{Namespace: "pr-1", Included: false, Reason: NamespaceReasonExcludeRegex},
+		{Namespace: "sandbox", Included: false, Reason: NamespaceReasonExcludeList},
+		{Namespace: "stuck", Included: false, Reason: NamespaceReasonTerminating},
+	}
+	if !reflect.DeepEqual(decisions, expected) {
+		t.Errorf("Expected decisions %+v, got %+v", expected, decisions)
+	}
+
+	if _, decisions, err = SetNamespaceListWithDecisions(IncludeExcludeLists{IncludeListStr: "pr-1"}, clientset, Opts{}); err != nil {
+		t.Fatalf("Error calling SetNamespaceListWithDecisions: %v", err)
+	}
+	for _, decision := range decisions {
+		if decision.Reason != NamespaceReasonIncludeList || decision.Included != (decision.Namespace == "pr-1") {
+			t.Errorf("Expected only pr-1 to be included by the include list, got %+v", decision)
+		}
+	}
+}
+
+func TestSetNamespaceListOptInLabel(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	for _, ns := range []*corev1.Namespace{
+		{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"kor/scan": "true"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "team-b", Labels: map[string]string{"kor/scan": "false"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+	} {
+		if _, err := clientset.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating namespace %s: %v", ns.Name, err)
+		}
+	}
+
+	for _, lists := range []IncludeExcludeLists{{}, {IncludeListStr: "team-a,team-b"}} {
+		namespaces, err := SetNamespaceList(lists, clientset, Opts{OptInLabel: "kor/scan=true"})
+		if err != nil {
+			t.Fatalf("Error calling SetNamespaceList: %v", err)
+		}
+
+		expected := []string{"team-a"}
+		if !stringSlicesEqual(namespaces, expected) {
+			t.Errorf("Expected only the opted-in namespaces %v, got %v", expected, namespaces)
+		}
+	}
+}
+
+func TestSetNamespaceListShard(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	var all []string
+	for i := 0; i < 20; i++ {
+		ns := fmt.Sprintf("team-%d", i)
+		if _, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}}, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating namespace %s: %v", ns, err)
+		}
+		all = append(all, ns)
+	}
+
+	covered := make(map[string]int)
+	for index := 0; index < 2; index++ {
+		namespaces, err := SetNamespaceList(IncludeExcludeLists{}, clientset, Opts{Shard: Shard{Index: index, Total: 2}})
+		if err != nil {
+			t.Fatalf("Error calling SetNamespaceList: %v", err)
+		}
+		if len(namespaces) == 0 || len(namespaces) == len(all) {
+			t.Errorf("Expected shard %d to hold a part of the namespaces, got %v", index, namespaces)
+		}
+		for _, ns := range namespaces {
+			covered[ns]++
+		}
+	}
+	for _, ns := range all {
+		if covered[ns] != 1 {
+			t.Errorf("Expected namespace %s to be in exactly one shard, got %d", ns, covered[ns])
+		}
+	}
+}
+
+func TestShardValidate(t *testing.T) {
+	for _, shard := range []Shard{{}, {Index: 0, Total: 1}, {Index: 2, Total: 3}} {
+		if err := shard.Validate(); err != nil {
+			t.Errorf("Expected shard %+v to be valid, got %v", shard, err)
+		}
+	}
+	for _, shard := range []Shard{{Index: 3, Total: 3}, {Index: -1, Total: 2}, {Index: 1}, {Total: -1}} {
+		if err := shard.Validate(); err == nil {
+			t.Errorf("Expected error for shard %+v", shard)
+		}
+	}
+}
+
+func TestOptsValidateOptInLabel(t *testing.T) {
+	if err := (Opts{OptInLabel: "kor/scan=true"}).Validate(); err != nil {
+		t.Errorf("Expected valid opt-in label, got %v", err)
+	}
+	for _, optInLabel := range []string{"kor/scan", "kor scan=true", "kor/scan=not valid"} {
+		if err := (Opts{OptInLabel: optInLabel}).Validate(); err == nil {
+			t.Errorf("Expected error for invalid opt-in label %q", optInLabel)
+		}
+	}
+}
+
+func TestIncludeExcludeListsValidate(t *testing.T) {
+	if err := (IncludeExcludeLists{NamespaceExcludeRegex: "pr-.*"}).Validate(); err != nil {
+		t.Errorf("Expected valid regex, got %v", err)
+	}
+	if err := (IncludeExcludeLists{NamespaceExcludeRegex: "pr-(["}).Validate(); err == nil {
+		t.Errorf("Expected error for invalid regex")
+	}
+}
+
+func TestUnusedResourceFormatterUnknownFormat(t *testing.T) {
+	_, err := unusedResourceFormatter("xml", bytes.Buffer{}, Opts{}, []byte("{}"))
+	if !errors.Is(err, ErrFormat) {
+		t.Errorf("Expected ErrFormat, got %v", err)
+	}
+}
+
+func TestSupportedOutputFormats(t *testing.T) {
+	expected := []string{"table", "json", "yaml", CustomResourceOutputFormat, RemoteWriteOutputFormat, TreeOutputFormat}
+	if formats := supportedOutputFormats(); !reflect.DeepEqual(formats, expected) {
+		t.Errorf("Expected %v, got %v", expected, formats)
+	}
+
+	_, err := unusedResourceFormatter(TreeOutputFormat, bytes.Buffer{}, Opts{}, []byte("{}"))
+	if !errors.Is(err, ErrFormat) || !strings.Contains(err.Error(), "only supported for configmaps") {
+		t.Errorf("Expected the finding formats to be rejected for other kinds, got %v", err)
+	}
+}
+
+func TestFindingID(t *testing.T) {
+	id := FindingID("https://cluster-1", testNamespace, "ConfigMap", "configmap-1")
+	if id != FindingID("https://cluster-1", testNamespace, "ConfigMap", "configmap-1") {
+		t.Error("Expected the finding ID to be deterministic")
+	}
+	if id != FindingID("https://cluster-1", testNamespace, "ConfigMap", "configmap-1-DELETED") {
+		t.Error("Expected the deletion suffix not to change the finding ID")
+	}
+
+	distinct := [][4]string{
+		{"https://cluster-2", testNamespace, "ConfigMap", "configmap-1"},
+		{"https://cluster-1", "namespace-2", "ConfigMap", "configmap-1"},
+		{"https://cluster-1", testNamespace, "Secret", "configmap-1"},
+		{"https://cluster-1", testNamespace, "ConfigMap", "configmap-2"},
+		{"https://cluster-1", testNamespace + "/ConfigMap", "", "configmap-1"},
+	}
+	for _, finding := range distinct {
+		if FindingID(finding[0], finding[1], finding[2], finding[3]) == id {
+			t.Errorf("Expected %v to have a different finding ID", finding)
+		}
+	}
+}
+
+func TestGetUnusedConfigmapsFindingIDAcrossRuns(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	opts := Opts{FlatJSON: true, ClusterInfo: &ClusterInfo{Host: "https://cluster-1"}}
+
+	scan := func() []FlatFinding {
+		output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+		if err != nil {
+			t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+		}
+		var envelope struct {
+			Namespaces []FlatFinding `json:"namespaces"`
+		}
+		if err := json.Unmarshal([]byte(output), &envelope); err != nil {
+			t.Fatalf("Error unmarshaling actual output: %v", err)
+		}
+		return envelope.Namespaces
+	}
+
+	first, second := scan(), scan()
+	if len(first) != 1 || first[0].FindingID == "" {
+		t.Fatalf("Expected a finding with an ID, got %v", first)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("Expected the same finding IDs across runs, got %v and %v", first, second)
+	}
+	if first[0].FindingID != FindingID("https://cluster-1", testNamespace, "ConfigMap", "configmap-3") {
+		t.Errorf("Expected the finding ID to include the cluster, got %s", first[0].FindingID)
+	}
+}
+
+func TestGetUnusedConfigmapsFindingIDCluster(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	if _, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{FlatJSON: true}); !errors.Is(err, ErrClusterIdentity) {
+		t.Errorf("Expected ErrClusterIdentity without a cluster identity, got %v", err)
+	}
+
+	cluster := createClusterIdentityNamespace(t, clientset)
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{FlatJSON: true, ClusterInfo: &ClusterInfo{Host: "https://cluster-1"}})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+	if want := FindingID(cluster, testNamespace, "ConfigMap", "configmap-3"); !strings.Contains(output, want) {
+		t.Errorf("Expected the finding ID to use the kube-system UID over the API server, got %s", output)
+	}
+}
+
+func TestEncodeIndented(t *testing.T) {
+	reports := []interface{}{
+		map[string]map[string]interface{}{
+			"namespace-1": {"ConfigMap": []string{"configmap-1", "configmap-2"}, "used": []string{"<used>"}},
+			"namespace-2": {"ConfigMap": []ResourceFinding{{Name: "configmap-3", Path: "/api/v1/namespaces/namespace-2/configmaps/configmap-3"}}},
+			"namespace-3": {"ConfigMap": []string{}},
+		},
+		map[string]map[string][]string{"namespace-1": {"Secret": {"secret-1"}}},
+		map[string]map[string][]string{},
+		map[string]map[string][]string(nil),
+		[]FlatFinding{{Namespace: "namespace-1", Kind: "ConfigMap", Name: "configmap-1"}},
+	}
+
+	for _, report := range reports {
+		expected, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			t.Fatalf("Error marshaling report: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := encodeIndented(&buf, report); err != nil {
+			t.Fatalf("Error encoding report: %v", err)
+		}
+		if buf.String() != string(expected) {
+			t.Errorf("Expected streamed output:\n%s\ngot:\n%s", expected, buf.String())
+		}
+	}
+}
+
+func TestEncodeEnvelope(t *testing.T) {
+	envelopes := []unusedResourceEnvelope{
+		{Namespaces: map[string]map[string][]string{"namespace-1": {"ConfigMap": {"configmap-1"}}, "namespace-2": {"ConfigMap": {}}}},
+		{
+			Cluster:         &ClusterInfo{Host: "https://cluster-1"},
+			ResourceVersion: "42",
+			Warnings:        []string{"namespace-3: forbidden"},
+			Namespaces:      map[string]map[string][]string{"namespace-1": {"ConfigMap": {"configmap-1", "configmap-2"}}},
+		},
+		{ResourceVersion: "42", Namespaces: map[string]map[string][]string{}},
+		{ResourceVersion: "42", Namespaces: []FlatFinding{{Namespace: "namespace-1", Kind: "ConfigMap", Name: "configmap-1"}}},
+	}
+
+	for _, envelope := range envelopes {
+		expected, err := json.MarshalIndent(envelope, "", "  ")
+		if err != nil {
+			t.Fatalf("Error marshaling envelope: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := encodeEnvelope(&buf, envelope, true); err != nil {
+			t.Fatalf("Error encoding envelope: %v", err)
+		}
+		if buf.String() != string(expected) {
+			t.Errorf("Expected streamed envelope:\n%s\ngot:\n%s", expected, buf.String())
+		}
+	}
+}
+
+func TestOptsPrintError(t *testing.T) {
+	var output bytes.Buffer
+	Opts{LogOutput: &output}.printError("Failed to delete %s\n", "configmap-1")
+	Opts{LogOutput: &output, QuietErrors: true}.printError("Failed to delete %s\n", "configmap-2")
+	if output.String() != "Failed to delete configmap-1\n" {
+		t.Errorf("Expected only the error printed without QuietErrors, got %q", output.String())
+	}
+}
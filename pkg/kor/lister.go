@@ -0,0 +1,462 @@
+package kor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+)
+
+// ResourceLister is the minimal set of list operations kor depends on to determine resource usage.
+// Implementations are not required to be backed by a live cluster, which allows callers to wrap the
+// Kubernetes client (caching, logging) or to supply resources from another source entirely.
+type ResourceLister interface {
+	ListPods(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.PodList, error)
+	ListConfigMaps(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.ConfigMapList, error)
+}
+
+type clientsetLister struct {
+	clientset kubernetes.Interface
+}
+
+// NewResourceLister returns a ResourceLister backed by the given Kubernetes clientset
+func NewResourceLister(clientset kubernetes.Interface) ResourceLister {
+	return &clientsetLister{clientset: clientset}
+}
+
+func (l *clientsetLister) ListPods(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.PodList, error) {
+	return l.clientset.CoreV1().Pods(namespace).List(ctx, opts)
+}
+
+func (l *clientsetLister) ListConfigMaps(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.ConfigMapList, error) {
+	return l.clientset.CoreV1().ConfigMaps(namespace).List(ctx, opts)
+}
+
+// configMapMetadataLister lists only the metadata of ConfigMaps through the metadata client, leaving their data
+// out of the list responses. The listed ConfigMaps have no data.
+type configMapMetadataLister struct {
+	ResourceLister
+	metadataClient metadata.Interface
+}
+
+func newConfigMapMetadataLister(lister ResourceLister, metadataClient metadata.Interface) *configMapMetadataLister {
+	return &configMapMetadataLister{ResourceLister: lister, metadataClient: metadataClient}
+}
+
+func (l *configMapMetadataLister) ListConfigMaps(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.ConfigMapList, error) {
+	list, err := l.metadataClient.Resource(corev1.SchemeGroupVersion.WithResource("configmaps")).Namespace(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	configmaps := &corev1.ConfigMapList{ListMeta: list.ListMeta, Items: make([]corev1.ConfigMap, 0, len(list.Items))}
+	for _, item := range list.Items {
+		configmaps.Items = append(configmaps.Items, corev1.ConfigMap{ObjectMeta: item.ObjectMeta})
+	}
+	return configmaps, nil
+}
+
+// defaultListPageSize is the number of pods or ConfigMaps requested per list call when no page size is set
+const defaultListPageSize = 500
+
+// pagingLister lists pods and ConfigMaps in pages of at most pageSize items, following the continue tokens of the
+// responses until the list is complete. Smaller pages lower the memory held by each response at the cost of more
+// round-trips.
+type pagingLister struct {
+	ResourceLister
+	pageSize int64
+}
+
+func newPagingLister(lister ResourceLister, pageSize int64) *pagingLister {
+	if pageSize <= 0 {
+		pageSize = defaultListPageSize
+	}
+	return &pagingLister{ResourceLister: lister, pageSize: pageSize}
+}
+
+func (l *pagingLister) ListPods(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.PodList, error) {
+	opts.Limit = l.pageSize
+	pods, err := l.ResourceLister.ListPods(ctx, namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+	for pods.Continue != "" {
+		page, err := l.ResourceLister.ListPods(ctx, namespace, continueOptions(opts, pods.Continue))
+		if err != nil {
+			return nil, err
+		}
+		pods.Items = append(pods.Items, page.Items...)
+		pods.ListMeta = page.ListMeta
+	}
+	return pods, nil
+}
+
+func (l *pagingLister) ListConfigMaps(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.ConfigMapList, error) {
+	opts.Limit = l.pageSize
+	configmaps, err := l.ResourceLister.ListConfigMaps(ctx, namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+	for configmaps.Continue != "" {
+		page, err := l.ResourceLister.ListConfigMaps(ctx, namespace, continueOptions(opts, configmaps.Continue))
+		if err != nil {
+			return nil, err
+		}
+		configmaps.Items = append(configmaps.Items, page.Items...)
+		configmaps.ListMeta = page.ListMeta
+	}
+	return configmaps, nil
+}
+
+// continueOptions returns the options requesting the page after a continue token, which must be sent without a
+// resourceVersion as the token already pins the list to the resourceVersion of the first page
+func continueOptions(opts metav1.ListOptions, continueToken string) metav1.ListOptions {
+	opts.Continue = continueToken
+	opts.ResourceVersion = ""
+	opts.ResourceVersionMatch = ""
+	return opts
+}
+
+// clusterWideLister serves namespaced list calls from a single cluster-wide list per resource kind.
+// The list options of the first call for a kind are used for the cluster-wide list.
+// It is safe for concurrent use.
+type clusterWideLister struct {
+	mu         sync.Mutex
+	lister     ResourceLister
+	pods       map[string][]corev1.Pod
+	configmaps map[string][]corev1.ConfigMap
+}
+
+func newClusterWideLister(lister ResourceLister) *clusterWideLister {
+	return &clusterWideLister{lister: lister}
+}
+
+func (l *clusterWideLister) ListPods(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.PodList, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.pods == nil {
+		pods, err := l.lister.ListPods(ctx, metav1.NamespaceAll, opts)
+		if err != nil {
+			return nil, err
+		}
+		l.pods = make(map[string][]corev1.Pod)
+		for _, pod := range pods.Items {
+			l.pods[pod.Namespace] = append(l.pods[pod.Namespace], pod)
+		}
+	}
+	return &corev1.PodList{Items: l.pods[namespace]}, nil
+}
+
+func (l *clusterWideLister) ListConfigMaps(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.ConfigMapList, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.configmaps == nil {
+		configmaps, err := l.lister.ListConfigMaps(ctx, metav1.NamespaceAll, opts)
+		if err != nil {
+			return nil, err
+		}
+		l.configmaps = make(map[string][]corev1.ConfigMap)
+		for _, configmap := range configmaps.Items {
+			l.configmaps[configmap.Namespace] = append(l.configmaps[configmap.Namespace], configmap)
+		}
+	}
+	return &corev1.ConfigMapList{Items: l.configmaps[namespace]}, nil
+}
+
+// activePodsLister omits pods that are terminating or have finished running, including evicted pods,
+// so their references don't keep otherwise orphaned resources in use
+type activePodsLister struct {
+	ResourceLister
+}
+
+func newActivePodsLister(lister ResourceLister) *activePodsLister {
+	return &activePodsLister{ResourceLister: lister}
+}
+
+func (l *activePodsLister) ListPods(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.PodList, error) {
+	pods, err := l.ResourceLister.ListPods(ctx, namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	active := make([]corev1.Pod, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded {
+			continue
+		}
+		active = append(active, pod)
+	}
+	return &corev1.PodList{ListMeta: pods.ListMeta, Items: active}, nil
+}
+
+// jobCache lists the Jobs of each namespace once per scan and serves later calls from the first list, so the
+// listers filtering or adding pods by Job don't list them again on every ListPods call. Once the Jobs of every
+// namespace were listed, the Jobs of a namespace are served from that list.
+// It is safe for concurrent use.
+type jobCache struct {
+	mu        sync.Mutex
+	clientset kubernetes.Interface
+	jobs      map[string][]batchv1.Job
+	// clusterWide are the Jobs of the cluster-wide list by namespace, nil until one is made
+	clusterWide map[string][]batchv1.Job
+}
+
+func newJobCache(clientset kubernetes.Interface) *jobCache {
+	return &jobCache{clientset: clientset, jobs: make(map[string][]batchv1.Job)}
+}
+
+func (c *jobCache) ListJobs(ctx context.Context, namespace string) ([]batchv1.Job, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.clusterWide != nil && namespace != metav1.NamespaceAll {
+		return c.clusterWide[namespace], nil
+	}
+	if jobs, ok := c.jobs[namespace]; ok {
+		return jobs, nil
+	}
+	jobs, err := c.clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	c.jobs[namespace] = jobs.Items
+	if namespace == metav1.NamespaceAll {
+		c.clusterWide = make(map[string][]batchv1.Job)
+		for _, job := range jobs.Items {
+			c.clusterWide[job.Namespace] = append(c.clusterWide[job.Namespace], job)
+		}
+	}
+	return jobs.Items, nil
+}
+
+// completedJobPodsLister omits pods controlled by Jobs that are complete or failed, including the template pods
+// added by jobTemplatesLister, so ConfigMaps referenced only by finished Jobs can be reclaimed while the Jobs and
+// their pods linger
+type completedJobPodsLister struct {
+	ResourceLister
+	jobs *jobCache
+}
+
+func newCompletedJobPodsLister(lister ResourceLister, jobs *jobCache) *completedJobPodsLister {
+	return &completedJobPodsLister{ResourceLister: lister, jobs: jobs}
+}
+
+func (l *completedJobPodsLister) ListPods(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.PodList, error) {
+	pods, err := l.ResourceLister.ListPods(ctx, namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := l.jobs.ListJobs(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	finished := make(map[types.UID]bool)
+	for _, job := range jobs {
+		for _, condition := range job.Status.Conditions {
+			if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) && condition.Status == corev1.ConditionTrue {
+				finished[job.UID] = true
+			}
+		}
+	}
+
+	items := make([]corev1.Pod, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		if owner := metav1.GetControllerOf(&pod); owner != nil && owner.Kind == "Job" && finished[owner.UID] {
+			continue
+		}
+		items = append(items, pod)
+	}
+	return &corev1.PodList{ListMeta: pods.ListMeta, Items: items}, nil
+}
+
+// staleReadsLister lists with resourceVersion "0" unless a resourceVersion is set, so the apiserver serves the
+// list from its watch cache rather than a quorum read from etcd. The result may lag behind the latest changes.
+type staleReadsLister struct {
+	ResourceLister
+}
+
+func newStaleReadsLister(lister ResourceLister) *staleReadsLister {
+	return &staleReadsLister{ResourceLister: lister}
+}
+
+func (l *staleReadsLister) ListPods(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.PodList, error) {
+	return l.ResourceLister.ListPods(ctx, namespace, staleReadOptions(opts))
+}
+
+func (l *staleReadsLister) ListConfigMaps(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.ConfigMapList, error) {
+	return l.ResourceLister.ListConfigMaps(ctx, namespace, staleReadOptions(opts))
+}
+
+func staleReadOptions(opts metav1.ListOptions) metav1.ListOptions {
+	if opts.ResourceVersion == "" {
+		opts.ResourceVersion = "0"
+	}
+	return opts
+}
+
+// deadlineLister makes every list call with a context that expires at the deadline, so the calls of the underlying
+// lister, including the ones its decorators make through the clientset, are cancelled once the deadline passes.
+// Listers that don't honor their context aren't interrupted.
+type deadlineLister struct {
+	ResourceLister
+	deadline time.Time
+}
+
+func newDeadlineLister(lister ResourceLister, deadline time.Time) *deadlineLister {
+	return &deadlineLister{ResourceLister: lister, deadline: deadline}
+}
+
+func (l *deadlineLister) ListPods(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.PodList, error) {
+	ctx, cancel := context.WithDeadline(ctx, l.deadline)
+	defer cancel()
+	return l.ResourceLister.ListPods(ctx, namespace, opts)
+}
+
+func (l *deadlineLister) ListConfigMaps(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.ConfigMapList, error) {
+	ctx, cancel := context.WithDeadline(ctx, l.deadline)
+	defer cancel()
+	return l.ResourceLister.ListConfigMaps(ctx, namespace, opts)
+}
+
+// snapshotLister serves every list call of a namespace after the first one from the list it returned, so the steps of
+// a namespace scan share one list of pods and one of ConfigMaps. Like clusterWideLister the list options of the first
+// call are used. It is created for the scan of a single namespace, so the lists don't outlive it, and isn't safe for
+// concurrent use.
+type snapshotLister struct {
+	lister     ResourceLister
+	pods       map[string]*corev1.PodList
+	configmaps map[string]*corev1.ConfigMapList
+}
+
+func newSnapshotLister(lister ResourceLister) *snapshotLister {
+	return &snapshotLister{lister: lister, pods: make(map[string]*corev1.PodList), configmaps: make(map[string]*corev1.ConfigMapList)}
+}
+
+func (l *snapshotLister) ListPods(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.PodList, error) {
+	if pods, listed := l.pods[namespace]; listed {
+		return pods, nil
+	}
+	pods, err := l.lister.ListPods(ctx, namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+	l.pods[namespace] = pods
+	return pods, nil
+}
+
+func (l *snapshotLister) ListConfigMaps(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.ConfigMapList, error) {
+	if configmaps, listed := l.configmaps[namespace]; listed {
+		return configmaps, nil
+	}
+	configmaps, err := l.lister.ListConfigMaps(ctx, namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+	l.configmaps[namespace] = configmaps
+	return configmaps, nil
+}
+
+// jobTemplatesLister adds a pod for the pod template of each existing Job and CronJob to the listed pods, so
+// resources used by pods that are only created on demand stay in use while their controller exists.
+// Each added pod is controlled by its Job or CronJob.
+// This is the only transitive reference kor follows. Selectors of PodDisruptionBudgets and NetworkPolicies
+// aren't followed since the pods they select are listed anyway, and pods of other controllers are expected to exist.
+type jobTemplatesLister struct {
+	ResourceLister
+	clientset kubernetes.Interface
+	jobs      *jobCache
+}
+
+func newJobTemplatesLister(lister ResourceLister, clientset kubernetes.Interface, jobs *jobCache) *jobTemplatesLister {
+	return &jobTemplatesLister{ResourceLister: lister, clientset: clientset, jobs: jobs}
+}
+
+func (l *jobTemplatesLister) ListPods(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.PodList, error) {
+	pods, err := l.ResourceLister.ListPods(ctx, namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := l.jobs.ListJobs(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	cronjobs, err := l.clientset.BatchV1().CronJobs(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]corev1.Pod, 0, len(pods.Items)+len(jobs)+len(cronjobs.Items))
+	items = append(items, pods.Items...)
+	for i := range jobs {
+		job := &jobs[i]
+		owner := metav1.NewControllerRef(job, batchv1.SchemeGroupVersion.WithKind("Job"))
+		items = append(items, templatePod(job.Namespace, job.Name, *owner, job.Spec.Template))
+	}
+	for i := range cronjobs.Items {
+		cronjob := &cronjobs.Items[i]
+		owner := metav1.NewControllerRef(cronjob, batchv1.SchemeGroupVersion.WithKind("CronJob"))
+		items = append(items, templatePod(cronjob.Namespace, cronjob.Name, *owner, cronjob.Spec.JobTemplate.Spec.Template))
+	}
+	return &corev1.PodList{ListMeta: pods.ListMeta, Items: items}, nil
+}
+
+// templatePod returns the pod the controller owner named name would create from template
+func templatePod(namespace, name string, owner metav1.OwnerReference, template corev1.PodTemplateSpec) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       namespace,
+			Name:            name,
+			Labels:          template.Labels,
+			Annotations:     template.Annotations,
+			OwnerReferences: []metav1.OwnerReference{owner},
+		},
+		Spec: template.Spec,
+	}
+}
+
+// workloadAnnotationsLister lists the annotations of the Deployments, DaemonSets and StatefulSets of a namespace, so
+// ConfigMaps named in workload annotations by operators are found by the reference annotation keys. The workloads
+// are only looked up for these references, they aren't listed as pods.
+type workloadAnnotationsLister struct {
+	clientset kubernetes.Interface
+}
+
+// newWorkloadAnnotationsLister returns the lister of workload annotations when opts enables it, or nil
+func newWorkloadAnnotationsLister(clientset kubernetes.Interface, opts Opts) *workloadAnnotationsLister {
+	if !opts.ScanWorkloadAnnotations || len(opts.ReferenceAnnotationKeys) == 0 {
+		return nil
+	}
+	return &workloadAnnotationsLister{clientset: clientset}
+}
+
+func (l *workloadAnnotationsLister) ListWorkloadAnnotations(ctx context.Context, namespace string) ([]map[string]string, error) {
+	deployments, err := l.clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	daemonsets, err := l.clientset.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	statefulsets, err := l.clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := make([]map[string]string, 0, len(deployments.Items)+len(daemonsets.Items)+len(statefulsets.Items))
+	for _, deployment := range deployments.Items {
+		annotations = append(annotations, deployment.Annotations)
+	}
+	for _, daemonset := range daemonsets.Items {
+		annotations = append(annotations, daemonset.Annotations)
+	}
+	for _, statefulset := range statefulsets.Items {
+		annotations = append(annotations, statefulset.Annotations)
+	}
+	return annotations, nil
+}
@@ -0,0 +1,104 @@
+package kor
+
+import (
+	"runtime/debug"
+	"time"
+)
+
+// Version is the kor version reported in scan metadata. It can be set at build time with
+// -ldflags "-X github.com/yonahd/kor/pkg/kor.Version=<version>" and otherwise falls back to the module version.
+var Version = ""
+
+// ScanMetadata records when and how a scan was run
+type ScanMetadata struct {
+	ScanStartedAt  time.Time     `json:"scanStartedAt"`
+	ScanDurationMs int64         `json:"scanDurationMs"`
+	KorVersion     string        `json:"korVersion"`
+	Options        scanOptions   `json:"options"`
+	FilterOptions  FilterOptions `json:"filterOptions"`
+}
+
+func newScanMetadata(startedAt time.Time, opts Opts, filterOpts *FilterOptions) *ScanMetadata {
+	return &ScanMetadata{
+		ScanStartedAt:  startedAt.UTC(),
+		ScanDurationMs: time.Since(startedAt).Milliseconds(),
+		KorVersion:     korVersion(),
+		Options:        newScanOptions(opts),
+		FilterOptions:  *filterOpts,
+	}
+}
+
+func korVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "unknown"
+}
+
+// scanOptions are the options of a scan reported in its metadata. Only options that change what the scan finds
+// or does are copied, so credentials and the settings of the output destinations are never reported. Options left
+// at their zero value are omitted.
+type scanOptions struct {
+	DeleteFlag              bool     `json:"delete,omitempty"`
+	NoInteractive           bool     `json:"noInteractive,omitempty"`
+	MaxDeletions            int      `json:"maxDeletions,omitempty"`
+	DeleteSelector          string   `json:"deleteSelector,omitempty"`
+	MinDeleteConfidence     string   `json:"minDeleteConfidence,omitempty"`
+	PropagationPolicy       string   `json:"propagationPolicy,omitempty"`
+	ForceRemoveFinalizers   bool     `json:"forceRemoveFinalizers,omitempty"`
+	ClusterWideList         bool     `json:"clusterWideList,omitempty"`
+	AllowStaleReads         bool     `json:"allowStaleReads,omitempty"`
+	IgnoreTerminatingPods   bool     `json:"ignoreTerminatingPods,omitempty"`
+	IgnoreCompletedJobPods  bool     `json:"ignoreCompletedJobPods,omitempty"`
+	ScanJobTemplates        bool     `json:"scanJobTemplates,omitempty"`
+	ScanEnvValues           bool     `json:"scanEnvValues,omitempty"`
+	ScanWorkloadAnnotations bool     `json:"scanWorkloadAnnotations,omitempty"`
+	ScanWebhookCA           bool     `json:"scanWebhookCA,omitempty"`
+	ScanKEDA                bool     `json:"scanKEDA,omitempty"`
+	ScanGatewayAPI          bool     `json:"scanGatewayAPI,omitempty"`
+	ReferenceAnnotationKeys []string `json:"referenceAnnotationKeys,omitempty"`
+	OptInLabel              string   `json:"optInLabel,omitempty"`
+	SinceResourceVersion    string   `json:"sinceResourceVersion,omitempty"`
+	DeletedWorkloadsWindow  string   `json:"deletedWorkloadsWindow,omitempty"`
+	PerNamespaceTimeout     string   `json:"perNamespaceTimeout,omitempty"`
+	ShardIndex              int      `json:"shardIndex,omitempty"`
+	ShardTotal              int      `json:"shardTotal,omitempty"`
+}
+
+// newScanOptions copies the options reported in the scan metadata from opts
+func newScanOptions(opts Opts) scanOptions {
+	options := scanOptions{
+		DeleteFlag:              opts.DeleteFlag,
+		NoInteractive:           opts.NoInteractive,
+		MaxDeletions:            opts.MaxDeletions,
+		DeleteSelector:          opts.DeleteSelector,
+		MinDeleteConfidence:     opts.MinDeleteConfidence,
+		PropagationPolicy:       opts.PropagationPolicy,
+		ForceRemoveFinalizers:   opts.ForceRemoveFinalizers,
+		ClusterWideList:         opts.ClusterWideList,
+		AllowStaleReads:         opts.AllowStaleReads,
+		IgnoreTerminatingPods:   opts.IgnoreTerminatingPods,
+		IgnoreCompletedJobPods:  opts.IgnoreCompletedJobPods,
+		ScanJobTemplates:        opts.ScanJobTemplates,
+		ScanEnvValues:           opts.ScanEnvValues,
+		ScanWorkloadAnnotations: opts.ScanWorkloadAnnotations,
+		ScanWebhookCA:           opts.ScanWebhookCA,
+		ScanKEDA:                opts.ScanKEDA,
+		ScanGatewayAPI:          opts.ScanGatewayAPI,
+		ReferenceAnnotationKeys: opts.ReferenceAnnotationKeys,
+		OptInLabel:              opts.OptInLabel,
+		SinceResourceVersion:    opts.SinceResourceVersion,
+		ShardIndex:              opts.Shard.Index,
+		ShardTotal:              opts.Shard.Total,
+	}
+	if opts.DeletedWorkloadsWindow > 0 {
+		options.DeletedWorkloadsWindow = opts.DeletedWorkloadsWindow.String()
+	}
+	if opts.PerNamespaceTimeout > 0 {
+		options.PerNamespaceTimeout = opts.PerNamespaceTimeout.String()
+	}
+	return options
+}
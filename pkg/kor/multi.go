@@ -4,100 +4,105 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"os"
 	"strings"
 
 	"k8s.io/client-go/kubernetes"
 	"sigs.k8s.io/yaml"
 )
 
-func retrieveNamespaceDiffs(clientset kubernetes.Interface, namespace string, resourceList []string) []ResourceDiff {
+func retrieveNamespaceDiffs(clientset kubernetes.Interface, namespace string, resourceList []string, opts Opts) []ResourceDiff {
 	var allDiffs []ResourceDiff
 	for _, resource := range resourceList {
 		switch resource {
 		case "cm", "configmap", "configmaps":
-			namespaceCMDiff := getUnusedCMs(clientset, namespace, nil)
+			namespaceCMDiff := getUnusedCMs(clientset, namespace, nil, opts)
 			allDiffs = append(allDiffs, namespaceCMDiff)
 		case "svc", "service", "services":
-			namespaceSVCDiff := getUnusedSVCs(clientset, namespace)
+			namespaceSVCDiff := getUnusedSVCs(clientset, namespace, opts)
 			allDiffs = append(allDiffs, namespaceSVCDiff)
 		case "scrt", "secret", "secrets":
-			namespaceSecretDiff := getUnusedSecrets(clientset, namespace, nil)
+			namespaceSecretDiff := getUnusedSecrets(clientset, namespace, nil, opts)
 			allDiffs = append(allDiffs, namespaceSecretDiff)
 		case "sa", "serviceaccount", "serviceaccounts":
-			namespaceSADiff := getUnusedServiceAccounts(clientset, namespace)
+			namespaceSADiff := getUnusedServiceAccounts(clientset, namespace, opts)
 			allDiffs = append(allDiffs, namespaceSADiff)
 		case "deploy", "deployment", "deployments":
-			namespaceDeploymentDiff := getUnusedDeployments(clientset, namespace, nil)
+			namespaceDeploymentDiff := getUnusedDeployments(clientset, namespace, nil, opts)
 			allDiffs = append(allDiffs, namespaceDeploymentDiff)
 		case "sts", "statefulset", "statefulsets":
-			namespaceStatefulsetDiff := getUnusedStatefulSets(clientset, namespace, nil)
+			namespaceStatefulsetDiff := getUnusedStatefulSets(clientset, namespace, nil, opts)
 			allDiffs = append(allDiffs, namespaceStatefulsetDiff)
 		case "role", "roles":
-			namespaceRoleDiff := getUnusedRoles(clientset, namespace, nil)
+			namespaceRoleDiff := getUnusedRoles(clientset, namespace, nil, opts)
 			allDiffs = append(allDiffs, namespaceRoleDiff)
 		case "hpa", "horizontalpodautoscaler", "horizontalpodautoscalers":
-			namespaceHpaDiff := getUnusedHpas(clientset, namespace, nil)
+			namespaceHpaDiff := getUnusedHpas(clientset, namespace, nil, opts)
 			allDiffs = append(allDiffs, namespaceHpaDiff)
 		case "pvc", "persistentvolumeclaim", "persistentvolumeclaims":
-			namespacePvcDiff := getUnusedPvcs(clientset, namespace, nil)
+			namespacePvcDiff := getUnusedPvcs(clientset, namespace, nil, opts)
 			allDiffs = append(allDiffs, namespacePvcDiff)
 		case "ing", "ingress", "ingresses":
-			namespaceIngressDiff := getUnusedIngresses(clientset, namespace, nil)
+			namespaceIngressDiff := getUnusedIngresses(clientset, namespace, nil, opts)
 			allDiffs = append(allDiffs, namespaceIngressDiff)
 		case "pdb", "poddisruptionbudget", "poddisruptionbudgets":
-			namespacePdbDiff := getUnusedPdbs(clientset, namespace, nil)
+			namespacePdbDiff := getUnusedPdbs(clientset, namespace, nil, opts)
 			allDiffs = append(allDiffs, namespacePdbDiff)
 		default:
-			fmt.Printf("resource type %q is not supported\n", resource)
+			opts.printError("resource type %q is not supported\n", resource)
 		}
 	}
 	return allDiffs
 }
 
-func GetUnusedMulti(includeExcludeLists IncludeExcludeLists, kubeconfig, resourceNames string, opts Opts) {
-	var clientset kubernetes.Interface
-	var namespaces []string
-
+func GetUnusedMulti(includeExcludeLists IncludeExcludeLists, kubeconfig, resourceNames string, opts Opts) error {
 	var outputBuffer bytes.Buffer
 
-	clientset = GetKubeClient(kubeconfig)
+	clientset, err := GetKubeClientWithOpts(kubeconfig, opts)
+	if err != nil {
+		return err
+	}
 
 	resourceList := strings.Split(resourceNames, ",")
-	namespaces = SetNamespaceList(includeExcludeLists, clientset)
+	namespaces, err := SetNamespaceList(includeExcludeLists, clientset, opts)
+	if err != nil {
+		return err
+	}
 
 	for _, namespace := range namespaces {
-		allDiffs := retrieveNamespaceDiffs(clientset, namespace, resourceList)
+		allDiffs := retrieveNamespaceDiffs(clientset, namespace, resourceList, opts)
 		output := FormatOutputAll(namespace, allDiffs)
 
 		outputBuffer.WriteString(output)
 		outputBuffer.WriteString("\n")
 	}
 
-	if opts.WebhookURL != "" || opts.Channel != "" && opts.Token != "" {
+	if slackConfigured(opts) {
 		if err := SendToSlack(SlackMessage{}, opts, outputBuffer.String()); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to send message to slack: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("failed to send message to slack: %w", err)
 		}
-	} else {
-		fmt.Println(outputBuffer.String())
+		return nil
 	}
+	_, err = fmt.Fprintln(opts.stdout(), outputBuffer.String())
+	return err
 }
 
-func GetUnusedMultiStructured(includeExcludeLists IncludeExcludeLists, kubeconfig, outputFormat, resourceNames string) (string, error) {
-	var clientset kubernetes.Interface
-	var namespaces []string
-
-	clientset = GetKubeClient(kubeconfig)
+func GetUnusedMultiStructured(includeExcludeLists IncludeExcludeLists, kubeconfig, outputFormat, resourceNames string, opts Opts) (string, error) {
+	clientset, err := GetKubeClientWithOpts(kubeconfig, opts)
+	if err != nil {
+		return "", err
+	}
 
 	resourceList := strings.Split(resourceNames, ",")
-	namespaces = SetNamespaceList(includeExcludeLists, clientset)
+	namespaces, err := SetNamespaceList(includeExcludeLists, clientset, opts)
+	if err != nil {
+		return "", err
+	}
 
 	// Create the JSON response object
 	response := make(map[string]map[string][]string)
 
 	for _, namespace := range namespaces {
-		allDiffs := retrieveNamespaceDiffs(clientset, namespace, resourceList)
+		allDiffs := retrieveNamespaceDiffs(clientset, namespace, resourceList, opts)
 		// Store the unused resources for each resource type in the JSON response
 		resourceMap := make(map[string][]string)
 		for _, diff := range allDiffs {
@@ -115,7 +120,7 @@ func GetUnusedMultiStructured(includeExcludeLists IncludeExcludeLists, kubeconfi
 	if outputFormat == "yaml" {
 		yamlResponse, err := yaml.JSONToYAML(jsonResponse)
 		if err != nil {
-			fmt.Printf("err: %v\n", err)
+			return "", fmt.Errorf("%w: %w", ErrFormat, err)
 		}
 		return string(yamlResponse), nil
 	} else {
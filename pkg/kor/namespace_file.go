@@ -0,0 +1,59 @@
+package kor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// LoadNamespaceListsFile reads include and exclude namespace lists from a file with one namespace per line,
+// listed under an "[include]" or "[exclude]" section header. Empty lines and lines starting with # are ignored.
+// The namespaces are added to the ones already in lists.
+func LoadNamespaceListsFile(path string, lists IncludeExcludeLists) (IncludeExcludeLists, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return lists, err
+	}
+	defer file.Close()
+
+	sections := map[string][]string{"include": nil, "exclude": nil}
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if _, ok := sections[section]; !ok {
+				return lists, fmt.Errorf("%s:%d: unknown section %q, must be include or exclude", path, lineNumber, section)
+			}
+			continue
+		}
+		if section == "" {
+			return lists, fmt.Errorf("%s:%d: namespace %q is not in an include or exclude section", path, lineNumber, line)
+		}
+		if errs := validation.IsDNS1123Label(line); len(errs) > 0 {
+			return lists, fmt.Errorf("%s:%d: invalid namespace %q: %s", path, lineNumber, line, strings.Join(errs, ", "))
+		}
+		sections[section] = append(sections[section], line)
+	}
+	if err := scanner.Err(); err != nil {
+		return lists, err
+	}
+
+	lists.IncludeListStr = joinNamespaceList(lists.IncludeListStr, sections["include"])
+	lists.ExcludeListStr = joinNamespaceList(lists.ExcludeListStr, sections["exclude"])
+	return lists, nil
+}
+
+func joinNamespaceList(existing string, namespaces []string) string {
+	if existing != "" {
+		namespaces = append([]string{existing}, namespaces...)
+	}
+	return strings.Join(namespaces, ",")
+}
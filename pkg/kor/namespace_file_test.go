@@ -0,0 +1,73 @@
+package kor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func writeNamespaceFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "namespaces")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Error writing namespace file: %v", err)
+	}
+	return path
+}
+
+func TestLoadNamespaceListsFile(t *testing.T) {
+	path := writeNamespaceFile(t, `# namespaces scanned by the pipeline
+[include]
+team-a
+team-b
+
+[exclude]
+kube-system
+`)
+
+	lists, err := LoadNamespaceListsFile(path, IncludeExcludeLists{})
+	if err != nil {
+		t.Fatalf("Error loading namespace file: %v", err)
+	}
+	if lists.IncludeListStr != "team-a,team-b" || lists.ExcludeListStr != "kube-system" {
+		t.Errorf("Unexpected namespace lists %+v", lists)
+	}
+
+	clientset := fake.NewSimpleClientset()
+	for _, ns := range []string{"team-a", "team-b", "team-c"} {
+		_, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: ns},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatalf("Error creating namespace %s: %v", ns, err)
+		}
+	}
+
+	namespaces, err := SetNamespaceList(IncludeExcludeLists{IncludeListStr: lists.IncludeListStr}, clientset, Opts{})
+	if err != nil {
+		t.Fatalf("Error calling SetNamespaceList: %v", err)
+	}
+
+	expected := []string{"team-a", "team-b"}
+	if !stringSlicesEqual(namespaces, expected) {
+		t.Errorf("Expected namespaces %v, got %v", expected, namespaces)
+	}
+}
+
+func TestLoadNamespaceListsFileInvalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"invalid namespace": "[include]\nTeam_A\n",
+		"missing section":   "team-a\n",
+		"unknown section":   "[scan]\nteam-a\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadNamespaceListsFile(writeNamespaceFile(t, content), IncludeExcludeLists{}); err == nil {
+				t.Error("Expected an error for an invalid namespace file")
+			}
+		})
+	}
+}
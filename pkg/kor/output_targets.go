@@ -0,0 +1,49 @@
+package kor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// OutputTarget is an additional rendering of the findings of a ConfigMap scan, written to the file at Path or to
+// Writer. Every target is rendered from the same scan as the returned output.
+type OutputTarget struct {
+	Format string
+	Path   string
+	Writer io.Writer `json:"-"`
+}
+
+// ParseOutputTarget parses a target given as format=path, such as json=report.json
+func ParseOutputTarget(value string) (OutputTarget, error) {
+	format, path, found := strings.Cut(value, "=")
+	if !found || format == "" || path == "" {
+		return OutputTarget{}, fmt.Errorf("invalid output target %q, must be format=path", value)
+	}
+	target := OutputTarget{Format: format, Path: path}
+	return target, target.Validate()
+}
+
+// Validate checks that the target has a supported format and a single destination
+func (t OutputTarget) Validate() error {
+	if formats := supportedOutputFormats(); !slicesContain(formats, t.Format) {
+		return fmt.Errorf("%w: unsupported output target format %q (supported: %s)", ErrFormat, t.Format, strings.Join(formats, ", "))
+	}
+	if (t.Path == "") == (t.Writer == nil) {
+		return fmt.Errorf("output target %s must have either a path or a writer", t.Format)
+	}
+	return nil
+}
+
+// write replaces the file at Path with output, or writes it to Writer
+func (t OutputTarget) write(output string) error {
+	if t.Writer != nil {
+		_, err := io.WriteString(t.Writer, output)
+		return err
+	}
+	if err := os.WriteFile(t.Path, []byte(output), 0644); err != nil {
+		return fmt.Errorf("failed to write %s output to %s: %w", t.Format, t.Path, err)
+	}
+	return nil
+}
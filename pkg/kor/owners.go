@@ -0,0 +1,65 @@
+package kor
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// UnknownOwner is the owner of the unused resources without the owner label
+const UnknownOwner = "unknown"
+
+// OwnerSummary counts the unused resources of an owner, as derived from the owner label
+type OwnerSummary struct {
+	Owner  string `json:"owner"`
+	Unused int    `json:"unused"`
+}
+
+// resourceOwners returns the owner of each unused resource in diff, which may carry deletion suffixes, from the
+// owner labels of the resources found unused
+func resourceOwners(diff []string, owners map[string]string) map[string]string {
+	resourceOwners := make(map[string]string, len(diff))
+	for _, entry := range diff {
+		owner := owners[resourceNameFromDiff(entry)]
+		if owner == "" {
+			owner = UnknownOwner
+		}
+		resourceOwners[entry] = owner
+	}
+	return resourceOwners
+}
+
+// summarizeOwners counts the unused resources per owner, sorted by descending count and then by owner
+func summarizeOwners(counts map[string]int) []OwnerSummary {
+	summary := make([]OwnerSummary, 0, len(counts))
+	for owner, unused := range counts {
+		summary = append(summary, OwnerSummary{Owner: owner, Unused: unused})
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Unused != summary[j].Unused {
+			return summary[i].Unused > summary[j].Unused
+		}
+		return summary[i].Owner < summary[j].Owner
+	})
+	return summary
+}
+
+// FormatOwnerSummary formats the number of unused resources of each owner
+func FormatOwnerSummary(summary []OwnerSummary) string {
+	if len(summary) == 0 {
+		return "No unused resources by owner\n"
+	}
+
+	var buf bytes.Buffer
+	table := tablewriter.NewWriter(&buf)
+	table.SetHeader([]string{"#", "Owner", "Unused"})
+
+	for i, owner := range summary {
+		table.Append([]string{fmt.Sprintf("%d", i+1), owner.Owner, fmt.Sprintf("%d", owner.Unused)})
+	}
+
+	table.Render()
+	return fmt.Sprintf("Unused resources by owner:\n%s", buf.String())
+}
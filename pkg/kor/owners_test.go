@@ -0,0 +1,64 @@
+package kor
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetUnusedConfigmapsOwnerLabelKey(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	owners := map[string]string{"configmap-1": "payments", "configmap-3": "payments", "configmap-4": "payments", "configmap-5": "search", "configmap-6": ""}
+	for name, owner := range owners {
+		configmap := CreateTestConfigmap(testNamespace, name)
+		if owner != "" {
+			configmap.Labels = map[string]string{"team": owner}
+		}
+		var err error
+		if name == "configmap-1" || name == "configmap-3" {
+			_, err = clientset.CoreV1().ConfigMaps(testNamespace).Update(context.TODO(), configmap, metav1.UpdateOptions{})
+		} else {
+			_, err = clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), configmap, metav1.CreateOptions{})
+		}
+		if err != nil {
+			t.Fatalf("Error writing fake configmap %s: %v", name, err)
+		}
+	}
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{OwnerLabelKey: "team"})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	var actualOutput struct {
+		Owners     []OwnerSummary `json:"owners"`
+		Namespaces map[string]struct {
+			Owners map[string]string `json:"owners"`
+		} `json:"namespaces"`
+	}
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+
+	// configmap-1 is used, so its owner isn't counted
+	expectedSummary := []OwnerSummary{{Owner: "payments", Unused: 2}, {Owner: "search", Unused: 1}, {Owner: UnknownOwner, Unused: 1}}
+	if !reflect.DeepEqual(actualOutput.Owners, expectedSummary) {
+		t.Errorf("Expected owner summary %v, got %v", expectedSummary, actualOutput.Owners)
+	}
+	expectedOwners := map[string]string{"configmap-3": "payments", "configmap-4": "payments", "configmap-5": "search", "configmap-6": UnknownOwner}
+	if actual := actualOutput.Namespaces[testNamespace].Owners; !reflect.DeepEqual(actual, expectedOwners) {
+		t.Errorf("Expected owners %v, got %v", expectedOwners, actual)
+	}
+
+	tableOutput, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "table", Opts{OwnerLabelKey: "team"})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+	if !strings.Contains(tableOutput, "Unused resources by owner:") || !strings.Contains(tableOutput, "payments") {
+		t.Errorf("Expected the owner summary in table output, got %s", tableOutput)
+	}
+}
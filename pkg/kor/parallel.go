@@ -0,0 +1,98 @@
+package kor
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// defaultMaxConcurrency caps the derived concurrency when no ceiling is configured
+const defaultMaxConcurrency = 10
+
+// forEachNamespace calls fn for every namespace using up to workers goroutines and returns once all calls are done.
+// fn receives the index of the namespace so results can be stored without locking and read back in namespace order.
+func forEachNamespace(namespaces []string, workers int, fn func(i int, namespace string)) {
+	if workers < 2 {
+		for i, namespace := range namespaces {
+			fn(i, namespace)
+		}
+		return
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(namespaces); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i, namespaces[i])
+			}
+		}()
+	}
+	for i := range namespaces {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// autoConcurrency returns the number of workers needed to keep qps requests per second in flight when each
+// request takes latency, between 1 and ceiling. A zero qps or ceiling uses the client-go and kor defaults.
+func autoConcurrency(qps float32, latency time.Duration, ceiling int) int {
+	if qps <= 0 {
+		qps = rest.DefaultQPS
+	}
+	if ceiling <= 0 {
+		ceiling = defaultMaxConcurrency
+	}
+
+	workers := int(math.Ceil(float64(qps) * latency.Seconds()))
+	if workers < 1 {
+		return 1
+	}
+	if workers > ceiling {
+		return ceiling
+	}
+	return workers
+}
+
+// timingLister records the average latency of the list calls made through it
+type timingLister struct {
+	ResourceLister
+	calls   atomic.Int64
+	elapsed atomic.Int64
+}
+
+func newTimingLister(lister ResourceLister) *timingLister {
+	return &timingLister{ResourceLister: lister}
+}
+
+func (l *timingLister) observe(start time.Time) {
+	l.calls.Add(1)
+	l.elapsed.Add(int64(time.Since(start)))
+}
+
+func (l *timingLister) ListPods(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.PodList, error) {
+	defer l.observe(time.Now())
+	return l.ResourceLister.ListPods(ctx, namespace, opts)
+}
+
+func (l *timingLister) ListConfigMaps(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.ConfigMapList, error) {
+	defer l.observe(time.Now())
+	return l.ResourceLister.ListConfigMaps(ctx, namespace, opts)
+}
+
+func (l *timingLister) averageLatency() time.Duration {
+	calls := l.calls.Load()
+	if calls == 0 {
+		return 0
+	}
+	return time.Duration(l.elapsed.Load() / calls)
+}
@@ -0,0 +1,31 @@
+package kor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAutoConcurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		qps      float32
+		latency  time.Duration
+		ceiling  int
+		expected int
+	}{
+		{name: "derived from qps and latency", qps: 20, latency: 200 * time.Millisecond, ceiling: 10, expected: 4},
+		{name: "rounds up", qps: 5, latency: 300 * time.Millisecond, ceiling: 10, expected: 2},
+		{name: "capped by ceiling", qps: 100, latency: time.Second, ceiling: 8, expected: 8},
+		{name: "at least one worker", qps: 5, latency: time.Millisecond, ceiling: 10, expected: 1},
+		{name: "default qps", qps: 0, latency: time.Second, ceiling: 10, expected: 5},
+		{name: "default ceiling", qps: 100, latency: time.Second, ceiling: 0, expected: defaultMaxConcurrency},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := autoConcurrency(test.qps, test.latency, test.ceiling); got != test.expected {
+				t.Errorf("Expected %d workers, got %d", test.expected, got)
+			}
+		})
+	}
+}
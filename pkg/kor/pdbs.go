@@ -3,9 +3,6 @@ package kor
 import (
 	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
-	"os"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -61,22 +58,29 @@ func processNamespacePdbs(clientset kubernetes.Interface, namespace string, filt
 
 func GetUnusedPdbs(includeExcludeLists IncludeExcludeLists, filterOpts *FilterOptions, clientset kubernetes.Interface, outputFormat string, opts Opts) (string, error) {
 	var outputBuffer bytes.Buffer
-	namespaces := SetNamespaceList(includeExcludeLists, clientset)
+	namespaces, err := SetNamespaceList(includeExcludeLists, clientset, opts)
+	if err != nil {
+		return "", err
+	}
 	response := make(map[string]map[string][]string)
+	deletionLimit := newDeletionLimit(opts)
 
 	for _, namespace := range namespaces {
 		diff, err := processNamespacePdbs(clientset, namespace, filterOpts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to process namespace %s: %v\n", namespace, err)
+			opts.printError("Failed to process namespace %s: %v\n", namespace, err)
 			continue
 		}
 
 		if opts.DeleteFlag {
-			if diff, err = DeleteResource(diff, clientset, namespace, "PDB", opts.NoInteractive); err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to delete PDB %s in namespace %s: %v\n", diff, namespace, err)
+			if diff, err = deleteNamespaceResources(diff, clientset, namespace, "PDB", opts, deletionLimit); err != nil {
+				opts.printError("Failed to delete PDB %s in namespace %s: %v\n", diff, namespace, err)
 			}
 		}
-		output := FormatOutput(namespace, diff, "PDBs")
+		output, err := FormatOutputWithOpts(namespace, diff, "PDBs", opts)
+		if err != nil {
+			return "", err
+		}
 		outputBuffer.WriteString(output)
 		outputBuffer.WriteString("\n")
 
@@ -85,15 +89,10 @@ func GetUnusedPdbs(includeExcludeLists IncludeExcludeLists, filterOpts *FilterOp
 		response[namespace] = resourceMap
 	}
 
-	jsonResponse, err := json.MarshalIndent(response, "", "  ")
+	jsonResponse, err := marshalResponse(response, opts)
 	if err != nil {
 		return "", err
 	}
 
-	unusedPdbs, err := unusedResourceFormatter(outputFormat, outputBuffer, opts, jsonResponse)
-	if err != nil {
-		fmt.Printf("err: %v\n", err)
-	}
-
-	return unusedPdbs, nil
+	return unusedResourceFormatter(outputFormat, outputBuffer, opts, jsonResponse)
 }
@@ -3,9 +3,7 @@ package kor
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -15,8 +13,7 @@ import (
 func retreiveUsedPvcs(clientset kubernetes.Interface, namespace string) ([]string, error) {
 	pods, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
-		fmt.Printf("Failed to list Pods: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("%w: %w", ErrListPods, err)
 	}
 	var usedPvcs []string
 	// Iterate through each Pod and check for PVC usage
@@ -66,22 +63,29 @@ func processNamespacePvcs(clientset kubernetes.Interface, namespace string, filt
 
 func GetUnusedPvcs(includeExcludeLists IncludeExcludeLists, filterOpts *FilterOptions, clientset kubernetes.Interface, outputFormat string, opts Opts) (string, error) {
 	var outputBuffer bytes.Buffer
-	namespaces := SetNamespaceList(includeExcludeLists, clientset)
+	namespaces, err := SetNamespaceList(includeExcludeLists, clientset, opts)
+	if err != nil {
+		return "", err
+	}
 	response := make(map[string]map[string][]string)
+	deletionLimit := newDeletionLimit(opts)
 
 	for _, namespace := range namespaces {
 		diff, err := processNamespacePvcs(clientset, namespace, filterOpts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to process namespace %s: %v\n", namespace, err)
+			opts.printError("Failed to process namespace %s: %v\n", namespace, err)
 			continue
 		}
 
 		if opts.DeleteFlag {
-			if diff, err = DeleteResource(diff, clientset, namespace, "PVC", opts.NoInteractive); err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to delete PVC %s in namespace %s: %v\n", diff, namespace, err)
+			if diff, err = deleteNamespaceResources(diff, clientset, namespace, "PVC", opts, deletionLimit); err != nil {
+				opts.printError("Failed to delete PVC %s in namespace %s: %v\n", diff, namespace, err)
 			}
 		}
-		output := FormatOutput(namespace, diff, "PVCs")
+		output, err := FormatOutputWithOpts(namespace, diff, "PVCs", opts)
+		if err != nil {
+			return "", err
+		}
 		outputBuffer.WriteString(output)
 		outputBuffer.WriteString("\n")
 
@@ -90,15 +94,10 @@ func GetUnusedPvcs(includeExcludeLists IncludeExcludeLists, filterOpts *FilterOp
 		response[namespace] = resourceMap
 	}
 
-	jsonResponse, err := json.MarshalIndent(response, "", "  ")
+	jsonResponse, err := marshalResponse(response, opts)
 	if err != nil {
 		return "", err
 	}
 
-	unusedPvcs, err := unusedResourceFormatter(outputFormat, outputBuffer, opts, jsonResponse)
-	if err != nil {
-		fmt.Printf("err: %v\n", err)
-	}
-
-	return unusedPvcs, nil
+	return unusedResourceFormatter(outputFormat, outputBuffer, opts, jsonResponse)
 }
@@ -0,0 +1,45 @@
+package kor
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// RemoteWriteOutputFormat renders the unused counts as timestamped samples that can be converted to Prometheus
+// remote-write requests
+const RemoteWriteOutputFormat = "remote-write"
+
+// remoteWriteSample is a single sample of a time series, in the shape of a Prometheus remote-write sample
+type remoteWriteSample struct {
+	Metric    string            `json:"metric"`
+	Labels    map[string]string `json:"labels"`
+	Value     float64           `json:"value"`
+	Timestamp int64             `json:"timestamp"`
+}
+
+// renderRemoteWriteSamples returns a kor_unused_resources sample per namespace with the number of unused resources
+// of kind, sorted by namespace. The timestamp is in milliseconds since the epoch, as remote-write expects.
+func renderRemoteWriteSamples(kind string, unused map[string][]string, timestamp time.Time) (string, error) {
+	namespaces := make([]string, 0, len(unused))
+	for namespace := range unused {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	samples := make([]remoteWriteSample, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		samples = append(samples, remoteWriteSample{
+			Metric:    "kor_unused_resources",
+			Labels:    map[string]string{"namespace": namespace, "kind": kind},
+			Value:     float64(len(unused[namespace])),
+			Timestamp: timestamp.UnixMilli(),
+		})
+	}
+
+	output, err := json.MarshalIndent(samples, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
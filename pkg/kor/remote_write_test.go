@@ -0,0 +1,67 @@
+package kor
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRenderRemoteWriteSamples(t *testing.T) {
+	unused := map[string][]string{
+		"ns-b": {},
+		"ns-a": {"configmap-1", "configmap-2"},
+	}
+	timestamp := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	output, err := renderRemoteWriteSamples("ConfigMap", unused, timestamp)
+	if err != nil {
+		t.Fatalf("Error rendering samples: %v", err)
+	}
+
+	var samples []remoteWriteSample
+	if err := json.Unmarshal([]byte(output), &samples); err != nil {
+		t.Fatalf("Error unmarshaling samples: %v", err)
+	}
+	expected := []remoteWriteSample{
+		{Metric: "kor_unused_resources", Labels: map[string]string{"namespace": "ns-a", "kind": "ConfigMap"}, Value: 2, Timestamp: 1704164645000},
+		{Metric: "kor_unused_resources", Labels: map[string]string{"namespace": "ns-b", "kind": "ConfigMap"}, Value: 0, Timestamp: 1704164645000},
+	}
+	if !reflect.DeepEqual(samples, expected) {
+		t.Errorf("Expected samples %+v, got %+v", expected, samples)
+	}
+}
+
+func TestGetUnusedConfigmapsRemoteWriteOutput(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	before := time.Now()
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, RemoteWriteOutputFormat, Opts{})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	var samples []map[string]interface{}
+	if err := json.Unmarshal([]byte(output), &samples); err != nil {
+		t.Fatalf("Error unmarshaling samples: %v", err)
+	}
+	if len(samples) != 1 {
+		t.Fatalf("Expected 1 sample, got %s", output)
+	}
+	sample := samples[0]
+	for _, field := range []string{"metric", "labels", "value", "timestamp"} {
+		if _, ok := sample[field]; !ok {
+			t.Errorf("Expected sample to have field %q, got %s", field, output)
+		}
+	}
+	expectedLabels := map[string]interface{}{"namespace": testNamespace, "kind": "ConfigMap"}
+	if !reflect.DeepEqual(sample["labels"], expectedLabels) {
+		t.Errorf("Expected labels %v, got %v", expectedLabels, sample["labels"])
+	}
+	if sample["metric"] != "kor_unused_resources" || sample["value"] != float64(1) {
+		t.Errorf("Expected 1 unused configmap in kor_unused_resources, got %s", output)
+	}
+	if timestamp, _ := sample["timestamp"].(float64); int64(timestamp) < before.UnixMilli() {
+		t.Errorf("Expected the sample to be timestamped at the scan, got %s", output)
+	}
+}
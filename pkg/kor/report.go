@@ -0,0 +1,63 @@
+package kor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// CustomResourceOutputFormat renders findings as an OrphanReport custom resource that can be applied to a cluster
+	CustomResourceOutputFormat = "custom-resource"
+
+	orphanReportAPIVersion = "kor.yonahd.io/v1alpha1"
+	orphanReportKind       = "OrphanReport"
+)
+
+// renderOrphanReport renders the unused resources of kind per namespace as an OrphanReport YAML manifest.
+// Items are sorted by namespace and name so the manifest only changes when the findings do.
+func renderOrphanReport(kind string, unused map[string][]string) (string, error) {
+	var items []interface{}
+	namespaces := make([]string, 0, len(unused))
+	for namespace := range unused {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	for _, namespace := range namespaces {
+		names := make([]string, 0, len(unused[namespace]))
+		for _, entry := range unused[namespace] {
+			names = append(names, resourceNameFromDiff(entry))
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			items = append(items, map[string]interface{}{
+				"kind":      kind,
+				"namespace": namespace,
+				"name":      name,
+			})
+		}
+	}
+	if items == nil {
+		items = []interface{}{}
+	}
+
+	report := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"items": items},
+	}}
+	report.SetAPIVersion(orphanReportAPIVersion)
+	report.SetKind(orphanReportKind)
+	report.SetName("kor-" + strings.ToLower(kind) + "s")
+
+	jsonReport, err := report.MarshalJSON()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrFormat, err)
+	}
+	yamlReport, err := yaml.JSONToYAML(jsonReport)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrFormat, err)
+	}
+	return string(yamlReport), nil
+}
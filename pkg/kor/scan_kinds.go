@@ -0,0 +1,69 @@
+package kor
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+type namespaceKindScanner func(clientset kubernetes.Interface, namespace string, filterOpts *FilterOptions) ([]string, error)
+
+// kindScanners are the per-namespace scans ScanKinds routes each kind to
+var kindScanners = map[string]namespaceKindScanner{
+	"ConfigMap": processNamespaceCM,
+	"Secret":    processNamespaceSecret,
+}
+
+func supportedScanKinds() []string {
+	kinds := make([]string, 0, len(kindScanners))
+	for kind := range kindScanners {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// ScanKinds scans the namespaces for unused resources of each of the kinds and returns a single report of
+// all of them, so library callers don't have to merge the output of the per-kind functions. A kind that fails
+// to be scanned in a namespace is left out of its report, like the per-kind functions do.
+func ScanKinds(kinds []string, includeExcludeLists IncludeExcludeLists, filterOpts *FilterOptions, clientset kubernetes.Interface, outputFormat string, opts Opts) (string, error) {
+	for _, kind := range kinds {
+		if _, ok := kindScanners[kind]; !ok {
+			return "", fmt.Errorf("unsupported kind %q (supported: %s)", kind, strings.Join(supportedScanKinds(), ", "))
+		}
+	}
+
+	var outputBuffer bytes.Buffer
+	namespaces, err := SetNamespaceList(includeExcludeLists, clientset, opts)
+	if err != nil {
+		return "", err
+	}
+	response := make(map[string]map[string][]string)
+
+	for _, namespace := range namespaces {
+		var allDiffs []ResourceDiff
+		resourceMap := make(map[string][]string)
+		for _, kind := range kinds {
+			diff, err := kindScanners[kind](clientset, namespace, filterOpts)
+			if err != nil {
+				opts.printError("Failed to scan %s in namespace %s: %v\n", kind, namespace, err)
+				continue
+			}
+			allDiffs = append(allDiffs, ResourceDiff{kind, diff})
+			resourceMap[kind] = diff
+		}
+		outputBuffer.WriteString(FormatOutputAll(namespace, allDiffs))
+		outputBuffer.WriteString("\n")
+		response[namespace] = resourceMap
+	}
+
+	jsonResponse, err := marshalResponse(response, opts)
+	if err != nil {
+		return "", err
+	}
+
+	return unusedResourceFormatter(outputFormat, outputBuffer, opts, jsonResponse)
+}
@@ -0,0 +1,103 @@
+package kor
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestScanKindsOnlyScansRequestedKinds(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	output, err := ScanKinds([]string{"ConfigMap"}, IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{})
+	if err != nil {
+		t.Fatalf("Error calling ScanKinds: %v", err)
+	}
+
+	var actualOutput map[string]map[string][]string
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+	expectedOutput := map[string]map[string][]string{
+		testNamespace: {"ConfigMap": {"configmap-3"}},
+	}
+	if !reflect.DeepEqual(actualOutput, expectedOutput) {
+		t.Errorf("Expected output %v, got %v", expectedOutput, actualOutput)
+	}
+
+	for _, action := range clientset.Actions() {
+		if action.GetResource().Resource == "secrets" {
+			t.Errorf("Expected secrets not to be scanned, got a %s action", action.GetVerb())
+		}
+	}
+}
+
+func TestScanKindsUnsupportedKind(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	clientset.ClearActions()
+
+	if _, err := ScanKinds([]string{"ConfigMap", "Widget"}, IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{}); err == nil {
+		t.Error("Expected an error for an unsupported kind")
+	}
+	if len(clientset.Actions()) != 0 {
+		t.Errorf("Expected nothing to be scanned when a kind is unsupported, got %d actions", len(clientset.Actions()))
+	}
+}
+
+func TestScanKindsContinuesAfterFailedKind(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	clientset.PrependReactor("list", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", nil)
+	})
+
+	var logOutput bytes.Buffer
+	output, err := ScanKinds([]string{"ConfigMap", "Secret"}, IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{LogOutput: &logOutput})
+	if err != nil {
+		t.Fatalf("Error calling ScanKinds: %v", err)
+	}
+
+	var actualOutput map[string]map[string][]string
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+	expectedOutput := map[string]map[string][]string{
+		testNamespace: {"ConfigMap": {"configmap-3"}},
+	}
+	if !reflect.DeepEqual(actualOutput, expectedOutput) {
+		t.Errorf("Expected output %v, got %v", expectedOutput, actualOutput)
+	}
+	if !strings.Contains(logOutput.String(), "Failed to scan Secret in namespace "+testNamespace) {
+		t.Errorf("Expected the failed scan to be reported, got %q", logOutput.String())
+	}
+}
+
+func TestScanKindsClusterInfo(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	opts := Opts{ClusterInfo: &ClusterInfo{Host: "https://cluster.example.com:6443"}}
+	output, err := ScanKinds([]string{"ConfigMap"}, IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+	if err != nil {
+		t.Fatalf("Error calling ScanKinds: %v", err)
+	}
+
+	var actualOutput struct {
+		Cluster    *ClusterInfo                   `json:"cluster"`
+		Namespaces map[string]map[string][]string `json:"namespaces"`
+	}
+	if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+		t.Fatalf("Error unmarshaling actual output: %v", err)
+	}
+	if actualOutput.Cluster == nil || actualOutput.Cluster.Host != "https://cluster.example.com:6443" {
+		t.Errorf("Expected cluster host to be populated, got %v", actualOutput.Cluster)
+	}
+	if !reflect.DeepEqual(actualOutput.Namespaces[testNamespace]["ConfigMap"], []string{"configmap-3"}) {
+		t.Errorf("Expected unused configmaps under namespaces, got %v", actualOutput.Namespaces)
+	}
+}
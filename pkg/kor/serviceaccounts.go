@@ -3,16 +3,14 @@ package kor
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
 var exceptionServiceAccounts = []ExceptionResource{
-	{ResourceName: "default", Namespace: "*"},
+	{ResourceName: "default", Namespace: AllNamespacesException},
 }
 
 func getServiceAccountsFromClusterRoleBindings(clientset kubernetes.Interface, namespace string) ([]string, error) {
@@ -85,7 +83,7 @@ func retrieveUsedSA(clientset kubernetes.Interface, namespace string) ([]string,
 	}
 
 	for _, resource := range exceptionServiceAccounts {
-		if resource.Namespace == namespace || resource.Namespace == "*" {
+		if resource.AppliesTo(namespace) {
 			podServiceAccounts = append(podServiceAccounts, resource.ResourceName)
 		}
 	}
@@ -142,22 +140,29 @@ func processNamespaceSA(clientset kubernetes.Interface, namespace string) ([]str
 func GetUnusedServiceAccounts(includeExcludeLists IncludeExcludeLists, clientset kubernetes.Interface, outputFormat string, opts Opts) (string, error) {
 	var outputBuffer bytes.Buffer
 
-	namespaces := SetNamespaceList(includeExcludeLists, clientset)
+	namespaces, err := SetNamespaceList(includeExcludeLists, clientset, opts)
+	if err != nil {
+		return "", err
+	}
 	response := make(map[string]map[string][]string)
+	deletionLimit := newDeletionLimit(opts)
 
 	for _, namespace := range namespaces {
 		diff, err := processNamespaceSA(clientset, namespace)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to process namespace %s: %v\n", namespace, err)
+			opts.printError("Failed to process namespace %s: %v\n", namespace, err)
 			continue
 		}
 
 		if opts.DeleteFlag {
-			if diff, err = DeleteResource(diff, clientset, namespace, "Serviceaccount", opts.NoInteractive); err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to delete Serviceaccount %s in namespace %s: %v\n", diff, namespace, err)
+			if diff, err = deleteNamespaceResources(diff, clientset, namespace, "Serviceaccount", opts, deletionLimit); err != nil {
+				opts.printError("Failed to delete Serviceaccount %s in namespace %s: %v\n", diff, namespace, err)
 			}
 		}
-		output := FormatOutput(namespace, diff, "Serviceaccounts")
+		output, err := FormatOutputWithOpts(namespace, diff, "Serviceaccounts", opts)
+		if err != nil {
+			return "", err
+		}
 		outputBuffer.WriteString(output)
 		outputBuffer.WriteString("\n")
 
@@ -166,15 +171,10 @@ func GetUnusedServiceAccounts(includeExcludeLists IncludeExcludeLists, clientset
 		response[namespace] = resourceMap
 	}
 
-	jsonResponse, err := json.MarshalIndent(response, "", "  ")
+	jsonResponse, err := marshalResponse(response, opts)
 	if err != nil {
 		return "", err
 	}
 
-	unusedServiceAccounts, err := unusedResourceFormatter(outputFormat, outputBuffer, opts, jsonResponse)
-	if err != nil {
-		fmt.Printf("err: %v\n", err)
-	}
-
-	return unusedServiceAccounts, nil
+	return unusedResourceFormatter(outputFormat, outputBuffer, opts, jsonResponse)
 }
@@ -32,7 +32,7 @@ func (sm SlackMessage) SendToSlack(opts Opts, outputBuffer string) error {
 		}
 		return nil
 	} else if opts.Channel != "" && opts.Token != "" {
-		fmt.Printf("Sending message to Slack channel %s...", opts.Channel)
+		fmt.Fprintf(opts.stdout(), "Sending message to Slack channel %s...", opts.Channel)
 		outputFilePath, _ := writeOutputToFile(outputBuffer)
 
 		var formData bytes.Buffer
@@ -0,0 +1,176 @@
+package kor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// MarkedUnusedLabel is set to "true" on the ConfigMaps marked as unused by MarkUnusedConfigmaps
+	MarkedUnusedLabel = "kor/marked-unused"
+	// MarkedUnusedAtAnnotation records when a ConfigMap was first marked as unused, in RFC 3339 format
+	MarkedUnusedAtAnnotation = "kor/marked-unused-at"
+)
+
+// retrieveUnusedNamespaceCM returns the unused ConfigMaps of the namespace along with the candidates they were
+// found among
+func retrieveUnusedNamespaceCM(lister ResourceLister, workloads *workloadAnnotationsLister, namespace string, clusterReferences []string, filterOpts *FilterOptions, opts Opts) ([]string, configMapCandidates, error) {
+	scan := scanNamespaceCM(lister, workloads, namespace, filterOpts, opts)
+	if scan.err != nil {
+		return nil, configMapCandidates{}, scan.err
+	}
+	usedConfigMaps := append(append([]string{}, scan.used...), clusterReferences...)
+	return CalculateResourceDifference(usedConfigMaps, scan.candidates.names), scan.candidates, nil
+}
+
+func listMarkedConfigMaps(clientset kubernetes.Interface, namespace string) ([]corev1.ConfigMap, error) {
+	configmaps, err := clientset.CoreV1().ConfigMaps(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: MarkedUnusedLabel + "=true"})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrListConfigMaps, err)
+	}
+	return configmaps.Items, nil
+}
+
+// patchMark sets the unused mark of the ConfigMap to markedAt, or removes it when markedAt is empty
+func patchMark(clientset kubernetes.Interface, namespace, name, markedAt string) error {
+	var label, annotation interface{}
+	if markedAt != "" {
+		label, annotation = "true", markedAt
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels":      map[string]interface{}{MarkedUnusedLabel: label},
+			"annotations": map[string]interface{}{MarkedUnusedAtAnnotation: annotation},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = clientset.CoreV1().ConfigMaps(namespace).Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// MarkUnusedConfigmaps labels the unused ConfigMaps with MarkedUnusedLabel and records when they were first found
+// unused, without deleting them. Marked ConfigMaps found in use again are unmarked. It returns the marked
+// ConfigMaps as namespace/name. SweepMarkedConfigmaps deletes the ConfigMaps marked for longer than a grace period.
+func MarkUnusedConfigmaps(includeExcludeLists IncludeExcludeLists, filterOpts *FilterOptions, clientset kubernetes.Interface, opts Opts) ([]string, error) {
+	markedAt := time.Now().UTC().Format(time.RFC3339)
+	lister := newConfigMapScanLister(clientset, filterOpts, opts)
+	workloads := newWorkloadAnnotationsLister(clientset, opts)
+	clusterReferences, warnings := collectClusterReferences(clientset, opts)
+	printWarnings(warnings, opts)
+
+	namespaces, err := SetNamespaceList(includeExcludeLists, clientset, opts)
+	if err != nil {
+		return nil, err
+	}
+	var marked []string
+	for _, namespace := range namespaces {
+		unused, _, err := retrieveUnusedNamespaceCM(lister, workloads, namespace, clusterReferences[namespace], filterOpts, opts)
+		if err != nil {
+			return marked, err
+		}
+		unusedNames := make(map[string]bool, len(unused))
+		for _, name := range unused {
+			unusedNames[name] = true
+		}
+
+		alreadyMarked := make(map[string]bool)
+		markedConfigMaps, err := listMarkedConfigMaps(clientset, namespace)
+		if err != nil {
+			return marked, err
+		}
+		for _, configmap := range markedConfigMaps {
+			if unusedNames[configmap.Name] {
+				alreadyMarked[configmap.Name] = true
+				continue
+			}
+			if err := patchMark(clientset, namespace, configmap.Name, ""); err != nil {
+				return marked, fmt.Errorf("failed to unmark ConfigMap %s in namespace %s: %w", configmap.Name, namespace, err)
+			}
+		}
+
+		for _, name := range unused {
+			if !alreadyMarked[name] {
+				if err := patchMark(clientset, namespace, name, markedAt); err != nil {
+					return marked, fmt.Errorf("failed to mark ConfigMap %s in namespace %s: %w", name, namespace, err)
+				}
+			}
+			marked = append(marked, namespace+"/"+name)
+		}
+	}
+	return marked, nil
+}
+
+// SweepMarkedConfigmaps deletes the ConfigMaps marked by MarkUnusedConfigmaps for longer than grace that are still
+// unused. ConfigMaps found in use again are left for MarkUnusedConfigmaps to unmark. The scan, delete and
+// confirmation options of opts apply like they do to GetUnusedConfigmaps. It returns the deleted ConfigMaps as
+// namespace/name.
+func SweepMarkedConfigmaps(includeExcludeLists IncludeExcludeLists, filterOpts *FilterOptions, clientset kubernetes.Interface, grace time.Duration, opts Opts) ([]string, error) {
+	now := time.Now()
+	deletionLimit := newDeletionLimit(opts)
+	lister := newConfigMapScanLister(clientset, filterOpts, opts)
+	workloads := newWorkloadAnnotationsLister(clientset, opts)
+	clusterReferences, warnings := collectClusterReferences(clientset, opts)
+	printWarnings(warnings, opts)
+
+	namespaces, err := SetNamespaceList(includeExcludeLists, clientset, opts)
+	if err != nil {
+		return nil, err
+	}
+	var deleted []string
+	for _, namespace := range namespaces {
+		markedConfigMaps, err := listMarkedConfigMaps(clientset, namespace)
+		if err != nil {
+			return deleted, err
+		}
+		if len(markedConfigMaps) == 0 {
+			continue
+		}
+
+		unused, candidates, err := retrieveUnusedNamespaceCM(lister, workloads, namespace, clusterReferences[namespace], filterOpts, opts)
+		if err != nil {
+			return deleted, err
+		}
+		unused, _ = protectReferencedCM(namespace, unused, candidates.heuristics, opts)
+		unused, _ = selectDeletionCandidatesCM(unused, candidates.deleteSelected)
+		unusedNames := make(map[string]bool, len(unused))
+		for _, name := range unused {
+			unusedNames[name] = true
+		}
+
+		var expired []string
+		for _, configmap := range markedConfigMaps {
+			if !unusedNames[configmap.Name] {
+				continue
+			}
+			markedAt, err := time.Parse(time.RFC3339, configmap.Annotations[MarkedUnusedAtAnnotation])
+			if err != nil {
+				opts.printError("Skipping ConfigMap %s in namespace %s: invalid %s annotation\n", configmap.Name, namespace, MarkedUnusedAtAnnotation)
+				continue
+			}
+			if now.Sub(markedAt) >= grace {
+				expired = append(expired, configmap.Name)
+			}
+		}
+
+		diff, err := deleteNamespaceResourcesWithIdentities(expired, clientset, namespace, "ConfigMap", opts, deletionLimit, candidates.identities)
+		if err != nil {
+			return deleted, err
+		}
+		for _, entry := range diff {
+			if strings.HasSuffix(entry, "-DELETED") {
+				deleted = append(deleted, namespace+"/"+resourceNameFromDiff(entry))
+			}
+		}
+	}
+	return deleted, nil
+}
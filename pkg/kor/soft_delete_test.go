@@ -0,0 +1,155 @@
+package kor
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func markedConfigmap(name string, markedAt time.Time) *corev1.ConfigMap {
+	configmap := CreateTestConfigmap(testNamespace, name)
+	configmap.Labels = map[string]string{MarkedUnusedLabel: "true"}
+	configmap.Annotations = map[string]string{MarkedUnusedAtAnnotation: markedAt.UTC().Format(time.RFC3339)}
+	return configmap
+}
+
+func TestMarkUnusedConfigmaps(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	// configmap-1 is used by a pod again since it was marked
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Update(context.TODO(), markedConfigmap("configmap-1", time.Now()), metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("Error updating fake configmap: %v", err)
+	}
+
+	marked, err := MarkUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, Opts{})
+	if err != nil {
+		t.Fatalf("Error marking unused configmaps: %v", err)
+	}
+	if !reflect.DeepEqual(marked, []string{testNamespace + "/configmap-3"}) {
+		t.Errorf("Expected configmap-3 to be marked, got %v", marked)
+	}
+
+	configmap, err := clientset.CoreV1().ConfigMaps(testNamespace).Get(context.TODO(), "configmap-3", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Error getting configmap-3: %v", err)
+	}
+	firstMarkedAt := configmap.Annotations[MarkedUnusedAtAnnotation]
+	if configmap.Labels[MarkedUnusedLabel] != "true" || firstMarkedAt == "" {
+		t.Errorf("Expected configmap-3 to carry the unused mark, got labels %v and annotations %v", configmap.Labels, configmap.Annotations)
+	}
+
+	used, err := clientset.CoreV1().ConfigMaps(testNamespace).Get(context.TODO(), "configmap-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Error getting configmap-1: %v", err)
+	}
+	if _, found := used.Labels[MarkedUnusedLabel]; found {
+		t.Errorf("Expected the used configmap-1 to be unmarked, got labels %v", used.Labels)
+	}
+	if _, found := used.Annotations[MarkedUnusedAtAnnotation]; found {
+		t.Errorf("Expected the used configmap-1 to be unmarked, got annotations %v", used.Annotations)
+	}
+
+	// marking again keeps the time the configmap was first found unused
+	if _, err := MarkUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, Opts{}); err != nil {
+		t.Fatalf("Error marking unused configmaps: %v", err)
+	}
+	configmap, err = clientset.CoreV1().ConfigMaps(testNamespace).Get(context.TODO(), "configmap-3", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Error getting configmap-3: %v", err)
+	}
+	if configmap.Annotations[MarkedUnusedAtAnnotation] != firstMarkedAt {
+		t.Errorf("Expected the mark time %s to be kept, got %s", firstMarkedAt, configmap.Annotations[MarkedUnusedAtAnnotation])
+	}
+}
+
+func TestSweepMarkedConfigmaps(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	now := time.Now()
+	for _, configmap := range []*corev1.ConfigMap{
+		markedConfigmap("configmap-1", now.Add(-48*time.Hour)),
+		markedConfigmap("configmap-3", now.Add(-48*time.Hour)),
+	} {
+		if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Update(context.TODO(), configmap, metav1.UpdateOptions{}); err != nil {
+			t.Fatalf("Error updating fake configmap: %v", err)
+		}
+	}
+	for _, configmap := range []*corev1.ConfigMap{
+		markedConfigmap("recently-marked", now.Add(-time.Hour)),
+		CreateTestConfigmap(testNamespace, "unmarked"),
+	} {
+		if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), configmap, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+
+	deleted, err := SweepMarkedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, 24*time.Hour, Opts{NoInteractive: true})
+	if err != nil {
+		t.Fatalf("Error sweeping marked configmaps: %v", err)
+	}
+	if !reflect.DeepEqual(deleted, []string{testNamespace + "/configmap-3"}) {
+		t.Errorf("Expected only configmap-3 to be deleted, got %v", deleted)
+	}
+
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Get(context.TODO(), "configmap-3", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("Expected configmap-3 to be deleted, got %v", err)
+	}
+	// used again, marked within the grace period or never marked
+	for _, name := range []string{"configmap-1", "recently-marked", "unmarked"} {
+		if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Get(context.TODO(), name, metav1.GetOptions{}); err != nil {
+			t.Errorf("Expected %s to be kept, got %v", name, err)
+		}
+	}
+}
+
+func TestSweepMarkedConfigmapsScanOptions(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Update(context.TODO(), markedConfigmap("configmap-3", time.Now().Add(-48*time.Hour)), metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("Error updating fake configmap: %v", err)
+	}
+	// configmap-3 is only referenced by the pod template of a CronJob
+	cronjob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "cronjob-1", Namespace: testNamespace},
+		Spec: batchv1.CronJobSpec{JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "configmap-3"}}}}},
+		}}}}},
+	}
+	if _, err := clientset.BatchV1().CronJobs(testNamespace).Create(context.TODO(), cronjob, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake cronjob: %v", err)
+	}
+
+	deleted, err := SweepMarkedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, 24*time.Hour, Opts{NoInteractive: true, ScanJobTemplates: true})
+	if err != nil {
+		t.Fatalf("Error sweeping marked configmaps: %v", err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("Expected the configmap used by a job template to be kept, got %v deleted", deleted)
+	}
+}
+
+func TestSweepMarkedConfigmapsConfirmEachNamespace(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Update(context.TODO(), markedConfigmap("configmap-3", time.Now().Add(-48*time.Hour)), metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("Error updating fake configmap: %v", err)
+	}
+	originalInput := confirmationInput
+	defer func() { confirmationInput = originalInput }()
+	confirmationInput = strings.NewReader("n\n")
+
+	deleted, err := SweepMarkedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, 24*time.Hour, Opts{ConfirmEachNamespace: true, LogOutput: io.Discard})
+	if err != nil {
+		t.Fatalf("Error sweeping marked configmaps: %v", err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("Expected the declined deletion to keep configmap-3, got %v deleted", deleted)
+	}
+	if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Get(context.TODO(), "configmap-3", metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected configmap-3 to be kept, got %v", err)
+	}
+}
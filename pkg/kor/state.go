@@ -0,0 +1,111 @@
+package kor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// OrphanState records the ConfigMaps seen referenced by previous scans, keyed by namespace.
+// It is used to report only ConfigMaps that were referenced before and no longer are, rather than
+// ConfigMaps that were never referenced at all.
+type OrphanState struct {
+	Referenced map[string][]string `json:"referenced"`
+	// Workloads records the ConfigMaps referenced by the pod template of each workload, keyed by namespace and
+	// then by kind/name, so the ConfigMaps of a deleted workload are still known after its deletion
+	Workloads map[string]map[string][]string `json:"workloads,omitempty"`
+}
+
+// LoadOrphanState reads the state file at path, returning an empty state when the file doesn't exist yet
+func LoadOrphanState(path string) (*OrphanState, error) {
+	state := &OrphanState{Referenced: make(map[string][]string)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %v", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %v", err)
+	}
+	if state.Referenced == nil {
+		state.Referenced = make(map[string][]string)
+	}
+	return state, nil
+}
+
+// Save writes the state to the file at path
+func (s *OrphanState) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+	return nil
+}
+
+// FilterRecentlyOrphaned returns the unused resources that were referenced by a previous scan
+func (s *OrphanState) FilterRecentlyOrphaned(namespace string, unused []string) []string {
+	var orphaned []string
+	for _, name := range unused {
+		if slicesContain(s.Referenced[namespace], name) {
+			orphaned = append(orphaned, name)
+		}
+	}
+	return orphaned
+}
+
+// Record updates the namespace state with the currently referenced resources. Resources referenced by a
+// previous scan are kept until they no longer exist, so they are reported until they're deleted or used again.
+func (s *OrphanState) Record(namespace string, referenced, existing []string) {
+	var kept []string
+	for _, name := range s.Referenced[namespace] {
+		if slicesContain(existing, name) {
+			kept = append(kept, name)
+		}
+	}
+	s.Referenced[namespace] = RemoveDuplicatesAndSort(append(kept, referenced...))
+}
+
+// RecordWorkloads updates the namespace state with the ConfigMaps referenced by the current workloads. The
+// references of workloads that no longer exist are kept for the ConfigMaps that still exist, so a deleted workload
+// can be correlated with its ConfigMaps by later scans.
+func (s *OrphanState) RecordWorkloads(namespace string, references map[string][]string, existing []string) {
+	workloads := make(map[string][]string, len(references))
+	for workload, configmaps := range s.Workloads[namespace] {
+		if _, exists := references[workload]; exists {
+			continue
+		}
+		var kept []string
+		for _, name := range configmaps {
+			if slicesContain(existing, name) {
+				kept = append(kept, name)
+			}
+		}
+		if len(kept) > 0 {
+			workloads[workload] = kept
+		}
+	}
+	for workload, configmaps := range references {
+		if len(configmaps) > 0 {
+			workloads[workload] = configmaps
+		}
+	}
+	if s.Workloads == nil {
+		s.Workloads = make(map[string]map[string][]string)
+	}
+	s.Workloads[namespace] = workloads
+}
+
+func slicesContain(slice []string, value string) bool {
+	for _, item := range slice {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
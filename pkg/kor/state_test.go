@@ -0,0 +1,80 @@
+package kor
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetUnusedConfigmapsRecentlyOrphaned(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	opts := Opts{
+		NoInteractive: true,
+		StateFile:     filepath.Join(t.TempDir(), "state.json"),
+	}
+
+	scan := func() []string {
+		output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+		if err != nil {
+			t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+		}
+		var actualOutput map[string]map[string][]string
+		if err := json.Unmarshal([]byte(output), &actualOutput); err != nil {
+			t.Fatalf("Error unmarshaling actual output: %v", err)
+		}
+		return actualOutput[testNamespace]["ConfigMap"]
+	}
+
+	// configmap-3 was never referenced, so it isn't reported
+	if unused := scan(); len(unused) != 0 {
+		t.Errorf("Expected no recently orphaned configmaps on the first scan, got %v", unused)
+	}
+
+	// pod-3 and pod-4 are the only references to configmap-2
+	for _, pod := range []string{"pod-3", "pod-4"} {
+		if err := clientset.CoreV1().Pods(testNamespace).Delete(context.TODO(), pod, metav1.DeleteOptions{}); err != nil {
+			t.Fatalf("Error deleting fake pod: %v", err)
+		}
+	}
+
+	expected := []string{"configmap-2"}
+	if unused := scan(); !reflect.DeepEqual(unused, expected) {
+		t.Errorf("Expected recently orphaned configmaps %v, got %v", expected, unused)
+	}
+	if unused := scan(); !reflect.DeepEqual(unused, expected) {
+		t.Errorf("Expected configmap-2 to be reported until it is deleted, got %v", unused)
+	}
+}
+
+func TestOrphanStateRecord(t *testing.T) {
+	state := &OrphanState{Referenced: map[string][]string{testNamespace: {"configmap-1", "configmap-2"}}}
+
+	state.Record(testNamespace, []string{"configmap-3"}, []string{"configmap-1", "configmap-3"})
+
+	expected := []string{"configmap-1", "configmap-3"}
+	if !reflect.DeepEqual(state.Referenced[testNamespace], expected) {
+		t.Errorf("Expected referenced configmaps %v, got %v", expected, state.Referenced[testNamespace])
+	}
+}
+
+func TestOrphanStateRecordWorkloads(t *testing.T) {
+	state := &OrphanState{Workloads: map[string]map[string][]string{testNamespace: {
+		"Deployment/billing": {"billing-config", "settings"},
+		"Deployment/legacy":  {"legacy-config"},
+	}}}
+
+	state.RecordWorkloads(testNamespace, map[string][]string{"Deployment/reports": {"reports-config"}, "Job/migrate": nil}, []string{"billing-config", "reports-config"})
+
+	expected := map[string][]string{
+		"Deployment/billing": {"billing-config"},
+		"Deployment/reports": {"reports-config"},
+	}
+	if !reflect.DeepEqual(state.Workloads[testNamespace], expected) {
+		t.Errorf("Expected recorded workloads %v, got %v", expected, state.Workloads[testNamespace])
+	}
+}
@@ -0,0 +1,32 @@
+package kor
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// writePrometheusTextfile writes the number of unused resources of kind per namespace to path in the
+// Prometheus text exposition format, for the node-exporter textfile collector. The file is replaced
+// atomically so the collector never reads a partial file.
+func writePrometheusTextfile(path, kind string, unused map[string][]string) error {
+	unusedResources := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kor_unused_resources",
+			Help: "Number of unused resources in Kubernetes",
+		},
+		[]string{"namespace", "kind"},
+	)
+	for namespace, diff := range unused {
+		unusedResources.WithLabelValues(namespace, kind).Set(float64(len(diff)))
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(unusedResources); err != nil {
+		return err
+	}
+	if err := prometheus.WriteToTextfile(path, registry); err != nil {
+		return fmt.Errorf("failed to write prometheus textfile %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package kor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetUnusedConfigmapsPrometheusTextfile(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+	path := filepath.Join(t.TempDir(), "kor.prom")
+
+	opts := Opts{NoInteractive: true, PrometheusTextfile: path}
+	if _, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts); err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading prometheus textfile: %v", err)
+	}
+	expected := fmt.Sprintf(`# HELP kor_unused_resources Number of unused resources in Kubernetes
+# TYPE kor_unused_resources gauge
+kor_unused_resources{kind="ConfigMap",namespace=%q} 1
+`, testNamespace)
+	if string(content) != expected {
+		t.Errorf("Expected prometheus textfile:\n%s\ngot:\n%s", expected, content)
+	}
+}
+
+func TestWritePrometheusTextfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kor.prom")
+	unused := map[string][]string{
+		"namespace-1": {"configmap-1", "configmap-2"},
+		"namespace-2": {},
+	}
+
+	if err := writePrometheusTextfile(path, "ConfigMap", unused); err != nil {
+		t.Fatalf("Error writing prometheus textfile: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading prometheus textfile: %v", err)
+	}
+	expected := `# HELP kor_unused_resources Number of unused resources in Kubernetes
+# TYPE kor_unused_resources gauge
+kor_unused_resources{kind="ConfigMap",namespace="namespace-1"} 2
+kor_unused_resources{kind="ConfigMap",namespace="namespace-2"} 0
+`
+	if string(content) != expected {
+		t.Errorf("Expected prometheus textfile:\n%s\ngot:\n%s", expected, content)
+	}
+}
@@ -0,0 +1,61 @@
+package kor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TreeOutputFormat renders findings as an indented tree of namespaces, kinds and resources
+const TreeOutputFormat = "tree"
+
+// renderTree renders the unused resources per namespace and kind as a tree rooted at each namespace, with the
+// number of resources at each namespace and kind node. Namespaces, kinds and resources are sorted. Resources the
+// run deleted or skipped are shown by name, followed by their status.
+func renderTree(report map[string]map[string][]string) string {
+	namespaces := make([]string, 0, len(report))
+	for namespace := range report {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	var buf strings.Builder
+	for _, namespace := range namespaces {
+		kinds := make([]string, 0, len(report[namespace]))
+		count := 0
+		for kind, resources := range report[namespace] {
+			if len(resources) == 0 {
+				continue
+			}
+			kinds = append(kinds, kind)
+			count += len(resources)
+		}
+		sort.Strings(kinds)
+
+		fmt.Fprintf(&buf, "%s (%d)\n", namespace, count)
+		for i, kind := range kinds {
+			branch, indent := "├── ", "│   "
+			if i == len(kinds)-1 {
+				branch, indent = "└── ", "    "
+			}
+			resources := append([]string{}, report[namespace][kind]...)
+			sort.Slice(resources, func(a, b int) bool {
+				return resourceNameFromDiff(resources[a]) < resourceNameFromDiff(resources[b])
+			})
+
+			fmt.Fprintf(&buf, "%s%s (%d)\n", branch, kind, len(resources))
+			for j, resource := range resources {
+				leaf := "├── "
+				if j == len(resources)-1 {
+					leaf = "└── "
+				}
+				fmt.Fprintf(&buf, "%s%s%s", indent, leaf, resourceNameFromDiff(resource))
+				if status := resourceStatusFromDiff(resource); status != "" {
+					fmt.Fprintf(&buf, " [%s]", status)
+				}
+				buf.WriteString("\n")
+			}
+		}
+	}
+	return buf.String()
+}
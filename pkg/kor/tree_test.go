@@ -0,0 +1,43 @@
+package kor
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRenderTree(t *testing.T) {
+	report := map[string]map[string][]string{
+		"ns-b": {"ConfigMap": {}},
+		"ns-a": {
+			"Secret":    {"secret-1"},
+			"ConfigMap": {"configmap-2-SKIPPED", "configmap-1-DELETED", "configmap-10"},
+		},
+	}
+
+	expected := `ns-a (4)
+├── ConfigMap (3)
+│   ├── configmap-1 [deleted]
+│   ├── configmap-10
+│   └── configmap-2 [skipped]
+└── Secret (1)
+    └── secret-1
+ns-b (0)
+`
+	if output := renderTree(report); output != expected {
+		t.Errorf("Expected tree:\n%s\ngot:\n%s", expected, output)
+	}
+}
+
+func TestGetUnusedConfigmapsTreeOutput(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, TreeOutputFormat, Opts{})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	expected := fmt.Sprintf("%s (1)\n└── ConfigMap (1)\n    └── configmap-3\n", testNamespace)
+	if output != expected {
+		t.Errorf("Expected tree:\n%s\ngot:\n%s", expected, output)
+	}
+}
@@ -0,0 +1,127 @@
+package kor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// resourceVersionWatchTimeout is how long the API server is asked to keep each watch replaying changes open. It
+// ends the watch with a bookmark marking how far the replay went.
+const resourceVersionWatchTimeout = 10 * time.Second
+
+// resourceVersionWatchGrace is how long past resourceVersionWatchTimeout a watch waits for its final bookmark
+const resourceVersionWatchGrace = 5 * time.Second
+
+// ChangedNamespacesSince returns the namespaces with pod or ConfigMap changes, including deletions, since
+// resourceVersion along with the current resourceVersion to pass to the next scan.
+// A nil map means every namespace must be scanned: when resourceVersion is "0", when it is too old for the API
+// server to replay changes from, or when the replay of a resource didn't reach the current resourceVersion.
+func ChangedNamespacesSince(clientset kubernetes.Interface, resourceVersion string) (map[string]bool, string, error) {
+	namespaceList, err := clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to retrieve current resource version: %v", err)
+	}
+	currentResourceVersion := namespaceList.ResourceVersion
+
+	if resourceVersion == "0" {
+		return nil, currentResourceVersion, nil
+	}
+	if resourceVersion == currentResourceVersion {
+		return map[string]bool{}, currentResourceVersion, nil
+	}
+
+	timeoutSeconds := int64(resourceVersionWatchTimeout / time.Second)
+	watchOpts := metav1.ListOptions{ResourceVersion: resourceVersion, TimeoutSeconds: &timeoutSeconds, AllowWatchBookmarks: true}
+	watchers := []struct {
+		resource string
+		watch    func(ctx context.Context) (watch.Interface, error)
+	}{
+		{"pods", func(ctx context.Context) (watch.Interface, error) {
+			return clientset.CoreV1().Pods(metav1.NamespaceAll).Watch(ctx, watchOpts)
+		}},
+		{"configmaps", func(ctx context.Context) (watch.Interface, error) {
+			return clientset.CoreV1().ConfigMaps(metav1.NamespaceAll).Watch(ctx, watchOpts)
+		}},
+	}
+
+	changed := make(map[string]bool)
+	for _, watcher := range watchers {
+		complete, err := replayChanges(watcher.watch, currentResourceVersion, changed)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to watch %s since resource version %s: %v", watcher.resource, resourceVersion, err)
+		}
+		if !complete {
+			return nil, currentResourceVersion, nil
+		}
+	}
+
+	return changed, currentResourceVersion, nil
+}
+
+// replayChanges starts a watch with its own deadline and records the namespaces it reports changes in. It reports
+// whether the replay reached untilResourceVersion, which the namespaces are only complete up to.
+func replayChanges(startWatch func(ctx context.Context) (watch.Interface, error), untilResourceVersion string, changed map[string]bool) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), resourceVersionWatchTimeout+resourceVersionWatchGrace)
+	defer cancel()
+
+	watcher, err := startWatch(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer watcher.Stop()
+	return collectChangedNamespaces(ctx, watcher, untilResourceVersion, changed)
+}
+
+// collectChangedNamespaces records the namespace of every watch event until an event or bookmark at or past
+// untilResourceVersion shows the replay is complete. It reports false when the watch ends, the deadline passes or
+// the watched resourceVersion has expired before then, as changes may have been missed.
+func collectChangedNamespaces(ctx context.Context, watcher watch.Interface, untilResourceVersion string, changed map[string]bool) (bool, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return false, nil
+			}
+			if event.Type == watch.Error {
+				if status, ok := event.Object.(*metav1.Status); ok && status.Code == http.StatusGone {
+					return false, nil
+				}
+				return false, fmt.Errorf("unexpected watch error: %v", event.Object)
+			}
+			object, err := meta.Accessor(event.Object)
+			if err != nil {
+				return false, err
+			}
+			if event.Type != watch.Bookmark {
+				changed[object.GetNamespace()] = true
+			}
+			if reachedResourceVersion(object.GetResourceVersion(), untilResourceVersion) {
+				return true, nil
+			}
+		}
+	}
+}
+
+// reachedResourceVersion reports whether resourceVersion is at or past untilResourceVersion. Resource versions are
+// compared as the integers etcd backed API servers use, other resource versions are never reached.
+func reachedResourceVersion(resourceVersion, untilResourceVersion string) bool {
+	current, err := strconv.ParseUint(resourceVersion, 10, 64)
+	if err != nil {
+		return false
+	}
+	until, err := strconv.ParseUint(untilResourceVersion, 10, 64)
+	if err != nil {
+		return false
+	}
+	return current >= until
+}
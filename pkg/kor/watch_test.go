@@ -0,0 +1,184 @@
+package kor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const otherTestNamespace = "other-namespace"
+
+func createTestChangedNamespaces(t *testing.T) *fake.Clientset {
+	clientset := createTestConfigmaps(t)
+
+	_, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: otherTestNamespace},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Error creating namespace %s: %v", otherTestNamespace, err)
+	}
+	_, err = clientset.CoreV1().ConfigMaps(otherTestNamespace).Create(context.TODO(), CreateTestConfigmap(otherTestNamespace, "configmap-1"), metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Error creating fake configmap: %v", err)
+	}
+
+	clientset.PrependReactor("list", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &corev1.NamespaceList{
+			ListMeta: metav1.ListMeta{ResourceVersion: "42"},
+			Items: []corev1.Namespace{
+				{ObjectMeta: metav1.ObjectMeta{Name: testNamespace}},
+				{ObjectMeta: metav1.ObjectMeta{Name: otherTestNamespace}},
+			},
+		}, nil
+	})
+
+	return clientset
+}
+
+// prependReplayWatchReactor makes watches of resource replay events followed by a bookmark at the current
+// resourceVersion 42, like an API server replaying the changes since a resourceVersion
+func prependReplayWatchReactor(clientset *fake.Clientset, resource string, events ...watch.Event) {
+	bookmark := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{ResourceVersion: "42"}}
+	prependWatchReactor(clientset, resource, append(events, watch.Event{Type: watch.Bookmark, Object: bookmark})...)
+}
+
+// prependWatchReactor makes watches of resource send events and end
+func prependWatchReactor(clientset *fake.Clientset, resource string, events ...watch.Event) {
+	clientset.PrependWatchReactor(resource, func(action k8stesting.Action) (bool, watch.Interface, error) {
+		watcher := watch.NewFakeWithChanSize(len(events), false)
+		for _, event := range events {
+			watcher.Action(event.Type, event.Object)
+		}
+		watcher.Stop()
+		return true, watcher, nil
+	})
+}
+
+func TestChangedNamespacesSince(t *testing.T) {
+	clientset := createTestChangedNamespaces(t)
+	prependReplayWatchReactor(clientset, "pods", watch.Event{Type: watch.Deleted, Object: CreateTestPod(testNamespace, "pod-3", "", nil)})
+	prependReplayWatchReactor(clientset, "configmaps")
+
+	changed, resourceVersion, err := ChangedNamespacesSince(clientset, "41")
+	if err != nil {
+		t.Fatalf("Error retrieving changed namespaces: %v", err)
+	}
+	if resourceVersion != "42" {
+		t.Errorf("Expected resource version 42, got %s", resourceVersion)
+	}
+	if !changed[testNamespace] || changed[otherTestNamespace] {
+		t.Errorf("Expected only %s to be changed, got %v", testNamespace, changed)
+	}
+}
+
+func TestChangedNamespacesSinceExpired(t *testing.T) {
+	clientset := createTestChangedNamespaces(t)
+	prependWatchReactor(clientset, "pods", watch.Event{Type: watch.Error, Object: &metav1.Status{Code: http.StatusGone}})
+	prependReplayWatchReactor(clientset, "configmaps")
+
+	changed, resourceVersion, err := ChangedNamespacesSince(clientset, "1")
+	if err != nil {
+		t.Fatalf("Error retrieving changed namespaces: %v", err)
+	}
+	if changed != nil {
+		t.Errorf("Expected an expired resource version to require a full scan, got %v", changed)
+	}
+	if resourceVersion != "42" {
+		t.Errorf("Expected resource version 42, got %s", resourceVersion)
+	}
+}
+
+func TestChangedNamespacesSinceIncompleteReplay(t *testing.T) {
+	clientset := createTestChangedNamespaces(t)
+	prependReplayWatchReactor(clientset, "pods")
+	// the watch ends before replaying up to the current resource version
+	prependWatchReactor(clientset, "configmaps", watch.Event{Type: watch.Added, Object: CreateTestConfigmap(testNamespace, "configmap-4")})
+
+	changed, resourceVersion, err := ChangedNamespacesSince(clientset, "41")
+	if err != nil {
+		t.Fatalf("Error retrieving changed namespaces: %v", err)
+	}
+	if changed != nil {
+		t.Errorf("Expected an incomplete replay to require a full scan, got %v", changed)
+	}
+	if resourceVersion != "42" {
+		t.Errorf("Expected resource version 42, got %s", resourceVersion)
+	}
+}
+
+func TestChangedNamespacesSinceBothResources(t *testing.T) {
+	clientset := createTestChangedNamespaces(t)
+	prependReplayWatchReactor(clientset, "pods", watch.Event{Type: watch.Modified, Object: CreateTestPod(otherTestNamespace, "pod-1", "", nil)})
+	prependReplayWatchReactor(clientset, "configmaps", watch.Event{Type: watch.Modified, Object: CreateTestConfigmap(testNamespace, "configmap-1")})
+
+	changed, _, err := ChangedNamespacesSince(clientset, "41")
+	if err != nil {
+		t.Fatalf("Error retrieving changed namespaces: %v", err)
+	}
+	if !changed[testNamespace] || !changed[otherTestNamespace] {
+		t.Errorf("Expected the changes replayed by both watches, got %v", changed)
+	}
+}
+
+func TestCollectChangedNamespacesDeadline(t *testing.T) {
+	watcher := watch.NewFake()
+	defer watcher.Stop()
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+
+	complete, err := collectChangedNamespaces(ctx, watcher, "42", map[string]bool{})
+	if err != nil {
+		t.Fatalf("Error collecting changed namespaces: %v", err)
+	}
+	if complete {
+		t.Error("Expected a replay cut short by its deadline to be incomplete")
+	}
+}
+
+func TestGetUnusedConfigmapsSinceResourceVersion(t *testing.T) {
+	clientset := createTestChangedNamespaces(t)
+	prependReplayWatchReactor(clientset, "pods")
+	prependReplayWatchReactor(clientset, "configmaps", watch.Event{Type: watch.Added, Object: CreateTestConfigmap(testNamespace, "configmap-4")})
+
+	scan := func(since string) unusedResourceEnvelope {
+		output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{SinceResourceVersion: since})
+		if err != nil {
+			t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+		}
+		var envelope unusedResourceEnvelope
+		if err := json.Unmarshal([]byte(output), &envelope); err != nil {
+			t.Fatalf("Error unmarshaling actual output: %v", err)
+		}
+		return envelope
+	}
+
+	first := scan("0")
+	if namespaces := first.Namespaces.(map[string]interface{}); len(namespaces) != 2 {
+		t.Errorf("Expected every namespace to be scanned, got %v", namespaces)
+	}
+
+	if first.ResourceVersion != "42" {
+		t.Errorf("Expected resource version 42, got %s", first.ResourceVersion)
+	}
+	// the fake API server doesn't move its resource version forward, so resume from an earlier one
+	second := scan("41")
+	namespaces := second.Namespaces.(map[string]interface{})
+	if _, ok := namespaces[otherTestNamespace]; ok {
+		t.Errorf("Expected unchanged namespace %s to be skipped, got %v", otherTestNamespace, namespaces)
+	}
+	if _, ok := namespaces[testNamespace]; !ok {
+		t.Errorf("Expected changed namespace %s to be scanned, got %v", testNamespace, namespaces)
+	}
+	if second.ResourceVersion != "42" {
+		t.Errorf("Expected resource version 42, got %s", second.ResourceVersion)
+	}
+}
@@ -0,0 +1,57 @@
+package kor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// defaultReportWebhookTimeout limits the report webhook request when no timeout is configured
+const defaultReportWebhookTimeout = 10 * time.Second
+
+// postReport sends the JSON report to opts.ReportWebhookURL, any status other than 2xx is an error
+func postReport(opts Opts, report []byte) error {
+	timeout := opts.ReportWebhookTimeout
+	if timeout <= 0 {
+		timeout = defaultReportWebhookTimeout
+	}
+
+	req, err := http.NewRequest(http.MethodPost, opts.ReportWebhookURL, bytes.NewReader(report))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrReportWebhook, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range opts.ReportWebhookHeaders {
+		req.Header.Set(key, value)
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrReportWebhook, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: webhook returned status code %d", ErrReportWebhook, resp.StatusCode)
+	}
+	return nil
+}
+
+// postReportIfConfigured posts the report when a report webhook is configured. Failures only print a warning
+// unless opts.ReportWebhookRequired is set.
+func postReportIfConfigured(opts Opts, report []byte) error {
+	if opts.ReportWebhookURL == "" {
+		return nil
+	}
+	if err := postReport(opts, report); err != nil {
+		if opts.ReportWebhookRequired {
+			return err
+		}
+		opts.printError("Failed to post report: %v\n", err)
+	}
+	return nil
+}
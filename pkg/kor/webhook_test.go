@@ -0,0 +1,93 @@
+package kor
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetUnusedConfigmapsReportWebhook(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	var body []byte
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	opts := Opts{
+		ReportWebhookURL:     server.URL,
+		ReportWebhookHeaders: map[string]string{"Authorization": "Bearer token"},
+	}
+	output, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", opts)
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	if string(body) != output {
+		t.Errorf("Expected the posted body to equal the report, got:\n%s\nwant:\n%s", body, output)
+	}
+	if authorization != "Bearer token" {
+		t.Errorf("Expected the configured Authorization header, got %q", authorization)
+	}
+}
+
+func TestGetUnusedConfigmapsReportWebhookFailure(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if _, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{ReportWebhookURL: server.URL}); err != nil {
+		t.Errorf("Expected the scan to succeed when the webhook isn't required, got %v", err)
+	}
+
+	_, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{ReportWebhookURL: server.URL, ReportWebhookRequired: true})
+	if !errors.Is(err, ErrReportWebhook) {
+		t.Errorf("Expected ErrReportWebhook when the webhook is required, got %v", err)
+	}
+}
+
+func TestGetUnusedConfigmapsReportWebhookOtherOutputs(t *testing.T) {
+	clientset := createTestConfigmaps(t)
+
+	want, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, "json", Opts{})
+	if err != nil {
+		t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		format string
+		opts   Opts
+	}{
+		{name: "tree", format: TreeOutputFormat},
+		{name: "custom resource", format: CustomResourceOutputFormat},
+		{name: "delete commands", format: "table", opts: Opts{EmitDeleteCommands: true}},
+		{name: "GitHub annotations", format: "table", opts: Opts{GitHubAnnotations: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var body []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ = io.ReadAll(r.Body)
+			}))
+			defer server.Close()
+
+			opts := test.opts
+			opts.ReportWebhookURL = server.URL
+			if _, err := GetUnusedConfigmaps(IncludeExcludeLists{}, &FilterOptions{}, clientset, test.format, opts); err != nil {
+				t.Fatalf("Error calling GetUnusedConfigmaps: %v", err)
+			}
+			if string(body) != want {
+				t.Errorf("Expected the JSON report to be posted, got:\n%s\nwant:\n%s", body, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package kor
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Reference is a reference to a ConfigMap from a pod or from the pod template of a workload
+type Reference struct {
+	// Kind is the kind of the referencing resource, such as Pod or Deployment
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Source is where in the pod spec the ConfigMap is referenced: volume, projected volume, init container volume
+	// mount, env, envFrom or init container
+	Source string `json:"source"`
+	// Key is the key of the ConfigMap read by an env var
+	Key string `json:"key,omitempty"`
+}
+
+// referenceSources are the sources reported for the kinds of references extractConfigMapRefs returns. The
+// duplicated envFrom references of regular containers aren't reported.
+var referenceSources = map[configMapRefKind]string{
+	volumeRef:               "volume",
+	projectedVolumeRef:      "projected volume",
+	initVolumeMountRef:      "init container volume mount",
+	envRef:                  "env",
+	envFromRef:              "envFrom",
+	envFromInitContainerRef: "init container",
+}
+
+// WhoReferences returns the pods, Deployments, StatefulSets, DaemonSets, Jobs and CronJobs of the namespace that
+// reference the ConfigMap, to investigate why a ConfigMap is or isn't reported as unused. Workloads are reported
+// along with the pods they created. The result is empty for a ConfigMap nothing references.
+func WhoReferences(clientset kubernetes.Interface, namespace, configMapName string) ([]Reference, error) {
+	references := []Reference{}
+	add := func(kind, name string, spec *corev1.PodSpec) {
+		seen := make(map[Reference]bool)
+		for _, ref := range extractConfigMapRefs(spec) {
+			source, reported := referenceSources[ref.kind]
+			if !reported || ref.name != configMapName {
+				continue
+			}
+			reference := Reference{Kind: kind, Name: name, Source: source, Key: ref.key}
+			if !seen[reference] {
+				seen[reference] = true
+				references = append(references, reference)
+			}
+		}
+	}
+
+	pods, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrListPods, err)
+	}
+	for i := range pods.Items {
+		add("Pod", pods.Items[i].Name, &pods.Items[i].Spec)
+	}
+
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for i := range deployments.Items {
+		add("Deployment", deployments.Items[i].Name, &deployments.Items[i].Spec.Template.Spec)
+	}
+
+	statefulsets, err := clientset.AppsV1().StatefulSets(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	for i := range statefulsets.Items {
+		add("StatefulSet", statefulsets.Items[i].Name, &statefulsets.Items[i].Spec.Template.Spec)
+	}
+
+	daemonsets, err := clientset.AppsV1().DaemonSets(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list daemonsets: %w", err)
+	}
+	for i := range daemonsets.Items {
+		add("DaemonSet", daemonsets.Items[i].Name, &daemonsets.Items[i].Spec.Template.Spec)
+	}
+
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	for i := range jobs.Items {
+		add("Job", jobs.Items[i].Name, &jobs.Items[i].Spec.Template.Spec)
+	}
+
+	cronjobs, err := clientset.BatchV1().CronJobs(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cronjobs: %w", err)
+	}
+	for i := range cronjobs.Items {
+		add("CronJob", cronjobs.Items[i].Name, &cronjobs.Items[i].Spec.JobTemplate.Spec.Template.Spec)
+	}
+
+	return references, nil
+}
@@ -0,0 +1,71 @@
+package kor
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWhoReferences(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	for _, name := range []string{"mounted-config", "orphan-config"} {
+		if _, err := clientset.CoreV1().ConfigMaps(testNamespace).Create(context.TODO(), CreateTestConfigmap(testNamespace, name), metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Error creating fake configmap: %v", err)
+		}
+	}
+
+	pod := CreateTestPod(testNamespace, "pod-1", "", []corev1.Volume{
+		{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "mounted-config"}}}},
+	})
+	pod.Spec.Containers = []corev1.Container{{
+		Name: "app",
+		Env: []corev1.EnvVar{{Name: "LEVEL", ValueFrom: &corev1.EnvVarSource{
+			ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "mounted-config"}, Key: "level"},
+		}}},
+	}}
+	pod.Spec.InitContainers = []corev1.Container{{
+		Name:         "init",
+		VolumeMounts: []corev1.VolumeMount{{Name: "config", MountPath: "/etc/config"}},
+	}}
+	if _, err := clientset.CoreV1().Pods(testNamespace).Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake pod: %v", err)
+	}
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "deployment-1"},
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:    "app",
+			EnvFrom: []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "mounted-config"}}}},
+		}}}}},
+	}
+	if _, err := clientset.AppsV1().Deployments(testNamespace).Create(context.TODO(), deployment, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Error creating fake deployment: %v", err)
+	}
+
+	references, err := WhoReferences(clientset, testNamespace, "mounted-config")
+	if err != nil {
+		t.Fatalf("Error calling WhoReferences: %v", err)
+	}
+	expected := []Reference{
+		{Kind: "Pod", Name: "pod-1", Source: "volume"},
+		{Kind: "Pod", Name: "pod-1", Source: "env", Key: "level"},
+		{Kind: "Pod", Name: "pod-1", Source: "init container volume mount"},
+		{Kind: "Deployment", Name: "deployment-1", Source: "envFrom"},
+	}
+	if !reflect.DeepEqual(references, expected) {
+		t.Errorf("Expected references %v, got %v", expected, references)
+	}
+
+	references, err = WhoReferences(clientset, testNamespace, "orphan-config")
+	if err != nil {
+		t.Fatalf("Error calling WhoReferences: %v", err)
+	}
+	if len(references) != 0 {
+		t.Errorf("Expected no references to the orphan, got %v", references)
+	}
+}